@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+	"github.com/idiomat/dodtnyt/e1/mypackage/ddbfake"
+)
+
+func TestCLI_Run(t *testing.T) {
+	johnny := &mypackage.Person{ID: "p1", Name: "Johnny", Email: "johnny@example.com"}
+	jane := &mypackage.Person{ID: "p2", Name: "Jane", Tags: []string{"vip"}}
+
+	tests := map[string]struct {
+		people     []*mypackage.Person // saved before running
+		args       []string
+		stdin      string
+		wantCode   int      // what person would exit with
+		wantOut    []string // in stdout
+		wantStderr string
+		wantIDs    []string // stored once the command ran
+	}{
+		"save json": {
+			args:    []string{"save", "--table", "people", "--json", "-"},
+			stdin:   `{"ID": "p1", "Name": "Johnny"}`,
+			wantOut: []string{`"ID": "p1"`, `"Name": "Johnny"`},
+			wantIDs: []string{"p1"},
+		},
+		"save table": {
+			args:    []string{"save", "--table", "people", "--output", "table", "--json", "-"},
+			stdin:   `{"ID": "p1", "Name": "Johnny"}`,
+			wantOut: []string{"ID  NAME", "p1  Johnny"},
+			wantIDs: []string{"p1"},
+		},
+		"save unknown field": {
+			args:     []string{"save", "--table", "people", "--json", "-"},
+			stdin:    `{"ID": "p1", "Nickname": "Johnny"}`,
+			wantCode: 1,
+		},
+		"save invalid person": {
+			args:     []string{"save", "--table", "people", "--json", "-"},
+			stdin:    `{"ID": "p1", "Name": "Johnny", "Email": "johnny@"}`,
+			wantCode: 1,
+		},
+		"save without json": {
+			args:       []string{"save", "--table", "people"},
+			wantCode:   2,
+			wantStderr: "save needs --json",
+		},
+		"get json": {
+			people:  []*mypackage.Person{johnny},
+			args:    []string{"get", "--table", "people", "p1"},
+			wantOut: []string{`"Email": "johnny@example.com"`},
+			wantIDs: []string{"p1"},
+		},
+		"get table": {
+			people:  []*mypackage.Person{johnny},
+			args:    []string{"get", "--table", "people", "--output", "table", "p1"},
+			wantOut: []string{"johnny@example.com"},
+			wantIDs: []string{"p1"},
+		},
+		"get missing": {
+			args:     []string{"get", "--table", "people", "p9"},
+			wantCode: 1,
+		},
+		"get without id": {
+			args:       []string{"get", "--table", "people"},
+			wantCode:   2,
+			wantStderr: "get takes 1 argument(s) but got 0",
+		},
+		"list json": {
+			people:  []*mypackage.Person{johnny, jane},
+			args:    []string{"list", "--table", "people"},
+			wantOut: []string{`"ID": "p1"`, `"ID": "p2"`},
+			wantIDs: []string{"p1", "p2"},
+		},
+		"list empty json": {
+			args:    []string{"list", "--table", "people"},
+			wantOut: []string{"[]"},
+		},
+		"list table": {
+			people:  []*mypackage.Person{johnny, jane},
+			args:    []string{"list", "--table", "people", "--output", "table"},
+			wantOut: []string{"p1  Johnny", "p2  Jane", "vip"},
+			wantIDs: []string{"p1", "p2"},
+		},
+		"list with argument": {
+			args:       []string{"list", "--table", "people", "p1"},
+			wantCode:   2,
+			wantStderr: "list takes 0 argument(s) but got 1",
+		},
+		"delete": {
+			people:  []*mypackage.Person{johnny, jane},
+			args:    []string{"delete", "--table", "people", "p1"},
+			wantIDs: []string{"p2"},
+		},
+		"delete missing": {
+			people:  []*mypackage.Person{jane},
+			args:    []string{"delete", "--table", "people", "p1"},
+			wantIDs: []string{"p2"},
+		},
+		"delete two ids": {
+			people:     []*mypackage.Person{johnny, jane},
+			args:       []string{"delete", "--table", "people", "p1", "p2"},
+			wantCode:   2,
+			wantStderr: "delete takes 1 argument(s) but got 2",
+			wantIDs:    []string{"p1", "p2"},
+		},
+		"no command": {
+			wantCode:   2,
+			wantStderr: "Usage: person <command>",
+		},
+		"unknown command": {
+			args:       []string{"rename"},
+			wantCode:   2,
+			wantStderr: "unknown command: rename",
+		},
+		"unknown flag": {
+			args:     []string{"get", "--tabel", "people", "p1"},
+			wantCode: 2,
+		},
+		"unknown output format": {
+			args:       []string{"get", "--table", "people", "--output", "yaml", "p1"},
+			wantCode:   2,
+			wantStderr: "unknown output format: yaml",
+		},
+		"no table": {
+			args:     []string{"get", "--table", "", "p1"},
+			wantCode: 1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := ddbfake.New()
+			if err := fake.CreateTable("people", "ID", ""); err != nil {
+				t.Fatalf("CreateTable() error = %v", err)
+			}
+			repo, err := mypackage.NewPersonRepository(fake, mypackage.Table{Name: "people"})
+			if err != nil {
+				t.Fatalf("NewPersonRepository() error = %v", err)
+			}
+			for _, p := range tc.people {
+				p := *p
+				if err := repo.Save(ctx, &p); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+
+			var stdout, stderr bytes.Buffer
+			c := &cli{
+				stdin:  strings.NewReader(tc.stdin),
+				stdout: &stdout,
+				stderr: &stderr,
+				newClient: func(region, endpoint string) (*mypackage.RetryingClient, error) {
+					return mypackage.NewRetryingClient(fake)
+				},
+			}
+			err = c.run(ctx, tc.args)
+			if code := exitCode(err); code != tc.wantCode {
+				t.Fatalf("run() error = %v, exit code %d, want %d", err, code, tc.wantCode)
+			}
+
+			for _, want := range tc.wantOut {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("stdout = %q, want it to contain %q", stdout.String(), want)
+				}
+			}
+			if out := stdout.Bytes(); len(out) > 0 && (out[0] == '[' || out[0] == '{') && !json.Valid(out) {
+				t.Errorf("stdout = %q, want valid JSON", out)
+			}
+			if !strings.Contains(stderr.String(), tc.wantStderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tc.wantStderr)
+			}
+
+			people, err := repo.List(ctx)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			ids := make(map[string]bool)
+			for _, p := range people {
+				ids[p.ID] = true
+			}
+			if len(ids) != len(tc.wantIDs) {
+				t.Errorf("stored %v, want %v", ids, tc.wantIDs)
+			}
+			for _, id := range tc.wantIDs {
+				if !ids[id] {
+					t.Errorf("stored %v, want %v", ids, tc.wantIDs)
+				}
+			}
+		})
+	}
+}
+
+func TestCLI_ImportProgress(t *testing.T) {
+	ctx := context.Background()
+	fake := ddbfake.New()
+	if err := fake.CreateTable("people", "ID", ""); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	dir := t.TempDir()
+	file, progress := filepath.Join(dir, "people.jsonl"), filepath.Join(dir, "progress.json")
+
+	run := func(args ...string) (string, int) {
+		var stderr bytes.Buffer
+		c := &cli{
+			stdin:  strings.NewReader(`{"ID": "p1", "Name": "Johnny"}`),
+			stdout: io.Discard,
+			stderr: &stderr,
+			newClient: func(region, endpoint string) (*mypackage.RetryingClient, error) {
+				return mypackage.NewRetryingClient(fake)
+			},
+		}
+		err := c.run(ctx, append([]string{"import", "--table", "people"}, args...))
+		return stderr.String(), exitCode(err)
+	}
+	write := func(lines string) {
+		if err := os.WriteFile(file, []byte(lines), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		file       string // written before running, unless empty
+		args       []string
+		wantCode   int
+		wantStderr string
+	}{
+		{
+			name:       "stdin",
+			args:       []string{"--file", "-", "--progress", progress},
+			wantCode:   2,
+			wantStderr: "--progress needs --file",
+		},
+		{
+			name:       "name without progress",
+			args:       []string{"--file", file, "--progress-name", "people"},
+			wantCode:   2,
+			wantStderr: "--progress-name needs --progress",
+		},
+		{
+			name:       "first run",
+			file:       "{\"ID\": \"p1\", \"Name\": \"Johnny\"}\n{\"ID\": \"p2\", \"Name\": \"Jane\"}\n",
+			args:       []string{"--file", file, "--progress", progress},
+			wantStderr: "imported 2, failed 0, skipped 0",
+		},
+		{
+			name:       "same file resumes",
+			args:       []string{"--file", file, "--progress", progress},
+			wantStderr: "imported 0, failed 0, skipped 2",
+		},
+		{
+			name:       "edited file starts over",
+			file:       "{\"ID\": \"p3\", \"Name\": \"Joan\"}\n{\"ID\": \"p1\", \"Name\": \"John\"}\n",
+			args:       []string{"--file", file, "--progress", progress},
+			wantStderr: "imported 2, failed 0, skipped 0",
+		},
+		{
+			name:       "named progress",
+			args:       []string{"--file", file, "--progress", progress, "--progress-name", "people"},
+			wantStderr: "imported 2, failed 0, skipped 0",
+		},
+		{
+			name:       "named progress survives edits",
+			file:       "{\"ID\": \"p3\", \"Name\": \"Joan\"}\n{\"ID\": \"p1\", \"Name\": \"John\"}\n{\"ID\": \"p4\", \"Name\": \"Jim\"}\n",
+			args:       []string{"--file", file, "--progress", progress, "--progress-name", "people"},
+			wantStderr: "imported 1, failed 0, skipped 2",
+		},
+	}
+
+	// each run continues from the progress the ones before it recorded
+	for _, tc := range tests {
+		if tc.file != "" {
+			write(tc.file)
+		}
+		stderr, code := run(tc.args...)
+		if code != tc.wantCode || !strings.Contains(stderr, tc.wantStderr) {
+			t.Errorf("%s: exit code %d, stderr %q, want %d and %q", tc.name, code, stderr, tc.wantCode, tc.wantStderr)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+)
+
+// open opens the file at path for reading, or stdin for -.
+func (c *cli) open(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(c.stdin), nil
+	}
+	return os.Open(path)
+}
+
+// create creates the file at path for writing, or stdout for -.
+func (c *cli) create(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopWriteCloser{c.stdout}, nil
+	}
+	return os.Create(path)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// fileDigest returns the SHA-256 of the contents of the file at path.
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// decodePerson reads a Person from JSON, rejecting fields a Person doesn't have.
+func decodePerson(dec *json.Decoder) (*mypackage.Person, error) {
+	dec.DisallowUnknownFields()
+	var p mypackage.Person
+	if err := dec.Decode(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (c *cli) save(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("save", flag.ContinueOnError)
+	var opts options
+	path := fs.String("json", "", "File with the Person to save as JSON, or - for stdin.")
+	if err := c.parse(fs, &opts, args); err != nil {
+		return err
+	}
+	if *path == "" {
+		fmt.Fprint(c.stderr, "save needs --json\n\n")
+		fs.Usage()
+		return errUsage
+	}
+
+	r, err := c.open(*path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	p, err := decodePerson(json.NewDecoder(r))
+	if err != nil {
+		return fmt.Errorf("invalid person in %s: %w", *path, err)
+	}
+
+	repo, err := c.repository(&opts)
+	if err != nil {
+		return err
+	}
+	if err := repo.Save(ctx, p); err != nil {
+		return err
+	}
+	return printPerson(c.stdout, opts.output, p)
+}
+
+func (c *cli) get(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	var opts options
+	if err := c.parse(fs, &opts, args, "id"); err != nil {
+		return err
+	}
+
+	repo, err := c.repository(&opts)
+	if err != nil {
+		return err
+	}
+	p, err := repo.Get(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return printPerson(c.stdout, opts.output, p)
+}
+
+func (c *cli) list(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	var opts options
+	if err := c.parse(fs, &opts, args); err != nil {
+		return err
+	}
+
+	repo, err := c.repository(&opts)
+	if err != nil {
+		return err
+	}
+	people, err := repo.List(ctx)
+	if err != nil {
+		return err
+	}
+	return printPeople(c.stdout, opts.output, people)
+}
+
+func (c *cli) delete(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	var opts options
+	if err := c.parse(fs, &opts, args, "id"); err != nil {
+		return err
+	}
+
+	repo, err := c.repository(&opts)
+	if err != nil {
+		return err
+	}
+	return repo.Delete(ctx, fs.Arg(0))
+}
+
+// importPeople saves the people of a JSON Lines or CSV file in batches.
+func (c *cli) importPeople(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	var opts options
+	path := fs.String("file", "-", "File to import, or - for stdin.")
+	format := fs.String("format", mypackage.FormatJSONL, "Format of the file (jsonl or csv).")
+	columns := fs.String("columns", "", "CSV columns of the fields not in a column named after them, e.g. Name=full_name,Address.City=city.")
+	dryRun := fs.Bool("dry-run", false, "Only validate the people in the file, without saving them.")
+	progress := fs.String("progress", "", "File recording how far the import got, so running it again resumes there.")
+	progressName := fs.String("progress-name", "", "Name the progress of the import is recorded under (defaults to a hash of the file, so an edited file starts over).")
+	report := fs.String("errors", "", "File to write a JSON line to for every record that failed.")
+	batch := fs.Int("batch-size", mypackage.DefaultImportBatchSize, "People saved at once.")
+	if err := c.parse(fs, &opts, args); err != nil {
+		return err
+	}
+
+	if *progress != "" && *path == "-" {
+		// stdin can't be read again from where an interrupted import stopped
+		fmt.Fprint(c.stderr, "--progress needs --file, not stdin\n\n")
+		fs.Usage()
+		return errUsage
+	}
+	if *progressName != "" && *progress == "" {
+		fmt.Fprint(c.stderr, "--progress-name needs --progress\n\n")
+		fs.Usage()
+		return errUsage
+	}
+
+	cols, err := mypackage.ParseColumns(*columns)
+	if err != nil {
+		return err
+	}
+	f, err := c.open(*path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := mypackage.NewPersonReader(*format, f, cols)
+	if err != nil {
+		return err
+	}
+
+	cfg := mypackage.ImportConfig{DryRun: *dryRun, BatchSize: *batch, Source: *progressName}
+	if *progress != "" {
+		if cfg.Progress, err = mypackage.NewFileCheckpoints(*progress); err != nil {
+			return err
+		}
+		if cfg.Source == "" {
+			if cfg.Source, err = fileDigest(*path); err != nil {
+				return err
+			}
+		}
+	}
+	if *report != "" {
+		// a resumed import adds to the report of the runs before it
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if *progress != "" {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		rf, err := os.OpenFile(*report, flags, 0o644)
+		if err != nil {
+			return err
+		}
+		defer rf.Close()
+		cfg.Report = rf
+	}
+
+	im, err := c.importer(&opts, cfg)
+	if err != nil {
+		return err
+	}
+
+	result, err := im.Import(ctx, r)
+	if result != nil {
+		verb := "imported"
+		if *dryRun {
+			verb = "valid"
+		}
+		fmt.Fprintf(c.stderr, "%s %d, failed %d, skipped %d already imported\n", verb, result.Imported, result.Failed, result.Skipped)
+	}
+	if err != nil {
+		return err
+	}
+	if result.Failed > 0 {
+		return fmt.Errorf("%d people failed to import", result.Failed)
+	}
+	return nil
+}
+
+// importer returns an Importer saving to the repository the options point at.
+func (c *cli) importer(opts *options, cfg mypackage.ImportConfig) (*mypackage.Importer, error) {
+	if cfg.DryRun {
+		// a dry run doesn't need the table
+		return mypackage.NewImporter(nil, cfg)
+	}
+	repo, err := c.repository(opts)
+	if err != nil {
+		return nil, err
+	}
+	return mypackage.NewImporter(repo, cfg)
+}
+
+// exportPeople writes every Person to a JSON Lines or CSV file, a page at a time.
+func (c *cli) exportPeople(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var opts options
+	path := fs.String("file", "-", "File to write, or - for stdout.")
+	format := fs.String("format", mypackage.FormatJSONL, "Format of the file (jsonl or csv).")
+	columns := fs.String("columns", "", "CSV columns of the fields not in a column named after them, e.g. Name=full_name,Address.City=city.")
+	pageSize := fs.Int64("page-size", 100, "Items read from DynamoDB at a time.")
+	if err := c.parse(fs, &opts, args); err != nil {
+		return err
+	}
+
+	cols, err := mypackage.ParseColumns(*columns)
+	if err != nil {
+		return err
+	}
+	repo, err := c.repository(&opts)
+	if err != nil {
+		return err
+	}
+	it, err := repo.Scan(mypackage.ScanOptions{PageOptions: mypackage.PageOptions{PageSize: *pageSize}})
+	if err != nil {
+		return err
+	}
+	f, err := c.create(*path)
+	if err != nil {
+		return err
+	}
+	w, err := mypackage.NewPersonWriter(*format, f, cols)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	n, err := mypackage.Export(ctx, it, w)
+	if err := errors.Join(err, f.Close()); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stderr, "exported %d people\n", n)
+	return nil
+}
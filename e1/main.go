@@ -2,7 +2,13 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -10,16 +16,167 @@ import (
 	"github.com/idiomat/dodtnyt/e1/mypackage"
 )
 
+const usage = `Usage: person <command> [flags] [args]
+
+Commands:
+  save --json file|-     save the Person in a JSON file, or read from stdin
+  get <id>               print a Person
+  list                   print every Person
+  delete <id>            delete a Person
+  import --file file|-   save every Person of a JSON Lines or CSV file
+  export --file file|-   write every Person as JSON Lines or CSV
+
+Run person <command> -h for the flags of a command.
+`
+
+// Output formats.
+const (
+	outputJSON  = "json"
+	outputTable = "table"
+)
+
+// errUsage is returned for a command line that doesn't make sense, after explaining why.
+var errUsage = errors.New("usage")
+
+// options are the flags every command takes.
+type options struct {
+	table        string
+	partitionKey string
+	keyFile      string
+	region       string
+	endpoint     string
+	output       string
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.table, "table", os.Getenv("TABLE_NAME"), "DynamoDB table people are stored in (defaults to $TABLE_NAME).")
+	fs.StringVar(&o.partitionKey, "partition-key", os.Getenv("TABLE_PARTITION_KEY"), "Partition key of the table, when it isn't ID (defaults to $TABLE_PARTITION_KEY).")
+	fs.StringVar(&o.keyFile, "key-file", os.Getenv("TABLE_KEY_FILE"), "File with the keys people are encrypted with (defaults to $TABLE_KEY_FILE).")
+	fs.StringVar(&o.region, "region", "", "AWS region (defaults to the AWS SDK configuration).")
+	fs.StringVar(&o.endpoint, "endpoint", "", "DynamoDB endpoint override, e.g. http://localhost:8000 for DynamoDB Local.")
+	fs.StringVar(&o.output, "output", outputJSON, "Output format (json or table).")
+}
+
+// clientFunc returns the DynamoDB client to use for region and endpoint.
+type clientFunc func(region, endpoint string) (*mypackage.RetryingClient, error)
+
+// cli runs commands, reading and writing through its fields.
+type cli struct {
+	stdin     io.Reader
+	stdout    io.Writer
+	stderr    io.Writer
+	newClient clientFunc
+}
+
 func main() {
-	sess, err := session.NewSession(&aws.Config{})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr, newClient: dynamoDBClient}
+	err := c.run(ctx, os.Args[1:])
+	if err != nil && !errors.Is(err, errUsage) {
+		fmt.Fprintf(os.Stderr, "person: %s\n", err)
+	}
+	os.Exit(exitCode(err))
+}
+
+// exitCode is the status person exits with after err: 2 for a usage error, 1 for any other.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, errUsage):
+		return 2
+	case err != nil:
+		return 1
+	}
+	return 0
+}
+
+func dynamoDBClient(region, endpoint string) (*mypackage.RetryingClient, error) {
+	// the RetryingClient does the retrying
+	cfg := &aws.Config{MaxRetries: aws.Int(0)}
+	if region != "" {
+		cfg.Region = aws.String(region)
+	}
+	if endpoint != "" {
+		cfg.Endpoint = aws.String(endpoint)
+	}
+	sess, err := session.NewSession(cfg)
 	if err != nil {
-		log.Fatalf("failed to create AWS session: %v", err)
+		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+	}
+	return mypackage.NewRetryingClient(dynamodb.New(sess))
+}
+
+// run runs the command args name.
+func (c *cli) run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(c.stderr, usage)
+		return errUsage
+	}
+
+	commands := map[string]func(ctx context.Context, args []string) error{
+		"save":   c.save,
+		"get":    c.get,
+		"list":   c.list,
+		"delete": c.delete,
+		"import": c.importPeople,
+		"export": c.exportPeople,
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		if args[0] != "help" && args[0] != "-h" && args[0] != "--help" {
+			fmt.Fprintf(c.stderr, "unknown command: %s\n\n", args[0])
+		}
+		fmt.Fprint(c.stderr, usage)
+		return errUsage
 	}
+	return cmd(ctx, args[1:])
+}
 
-	client := dynamodb.New(sess)
+// parse parses the flags of command, which takes the positional arguments named in argNames.
+func (c *cli) parse(fs *flag.FlagSet, opts *options, args []string, argNames ...string) error {
+	opts.register(fs)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: person %s [flags]", fs.Name())
+		for _, name := range argNames {
+			fmt.Fprintf(c.stderr, " <%s>", name)
+		}
+		fmt.Fprint(c.stderr, "\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != len(argNames) {
+		fmt.Fprintf(c.stderr, "%s takes %d argument(s) but got %d\n\n", fs.Name(), len(argNames), fs.NArg())
+		fs.Usage()
+		return errUsage
+	}
+	if opts.output != outputJSON && opts.output != outputTable {
+		fmt.Fprintf(c.stderr, "unknown output format: %s\n\n", opts.output)
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// repository returns the repository the options point at.
+func (c *cli) repository(opts *options) (*mypackage.PersonRepository, error) {
+	table := mypackage.Table{Name: opts.table, PartitionKey: opts.partitionKey}
+	if opts.keyFile != "" {
+		keys, err := mypackage.LoadKeyFile(opts.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if table.Encryption, err = mypackage.NewFieldEncrypter(keys); err != nil {
+			return nil, err
+		}
+	}
 
-	ddbSaver := mypackage.DynamoDBSaver{Client: client}
-	if err := ddbSaver.Save(context.Background(), &mypackage.Person{Name: "Johnny"}); err != nil {
-		log.Fatalf("failed to save: %v", err)
+	client, err := c.newClient(opts.region, opts.endpoint)
+	if err != nil {
+		return nil, err
 	}
+	return mypackage.NewPersonRepository(client, table)
 }
@@ -0,0 +1,296 @@
+package mypackage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// MaxBatchSize is the most items DynamoDB accepts in one BatchWriteItem request.
+const MaxBatchSize = 25
+
+const (
+	DefaultBatchConcurrency = 4
+	DefaultBatchRetries     = 5
+	DefaultBatchBackoff     = 50 * time.Millisecond
+)
+
+// ErrUnprocessed is returned for items DynamoDB still left unprocessed after every retry.
+var ErrUnprocessed = errors.New("item left unprocessed")
+
+type ddbBatchWriter interface {
+	BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+type ddbBatchGetter interface {
+	BatchGetItemWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts ...request.Option) (*dynamodb.BatchGetItemOutput, error)
+}
+
+// ddbBatchClient is what DynamoDBBatchSaver needs: BatchGetItem too, to read the CreatedAt
+// of people saved again.
+type ddbBatchClient interface {
+	ddbBatchWriter
+	ddbBatchGetter
+}
+
+// DynamoDBBatchSaver saves many people at once with BatchWriteItem.
+// Zero values for Concurrency, Retries and Backoff use the defaults.
+type DynamoDBBatchSaver struct {
+	Client      ddbBatchClient
+	Table       Table
+	Concurrency int           // batches in flight at once
+	Retries     int           // attempts to resend unprocessed items
+	Backoff     time.Duration // initial wait before resending, doubled each time
+}
+
+// ItemError is the failure to save a single Person.
+type ItemError struct {
+	Person *Person
+	Err    error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("person %s: %s", e.Person.ID, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError reports every Person SaveAll failed to save.
+type BatchError struct {
+	Failed []*ItemError
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("failed to save %d people: %s", len(e.Failed), e.Failed[0])
+}
+
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, f := range e.Failed {
+		errs[i] = f
+	}
+	return errs
+}
+
+// SaveAll saves people in batches of MaxBatchSize, resending items DynamoDB leaves unprocessed.
+// People that could not be saved are reported in a *BatchError; the others are saved regardless.
+// BatchWriteItem can't be conditional, so versions are neither checked nor incremented.
+// When several people share an ID only the last is written, as if they were saved in order.
+// A nil Person fails the whole call before anything is saved.
+// People without CreatedAt keep the one stored, which is read first, so a concurrent
+// first save of the same Person can still have its CreatedAt overwritten.
+func (s *DynamoDBBatchSaver) SaveAll(ctx context.Context, people []*Person) error {
+	if err := s.Table.validate(); err != nil {
+		return err
+	}
+
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	var (
+		mu     sync.Mutex
+		failed []*ItemError
+	)
+	fail := func(errs ...*ItemError) {
+		mu.Lock()
+		failed = append(failed, errs...)
+		mu.Unlock()
+	}
+
+	// DynamoDB rejects a batch writing an item twice, and separate batches would race
+	last := make(map[string]int, len(people))
+	for i, p := range people {
+		if p == nil {
+			return fmt.Errorf("people[%d]: %w", i, errNilPerson)
+		}
+		last[p.ID] = i
+	}
+
+	batches := make([][]*Person, 0, len(people)/MaxBatchSize+1)
+	batch := make([]*Person, 0, MaxBatchSize)
+	for i, p := range people {
+		if last[p.ID] != i {
+			continue
+		}
+		batch = append(batch, p)
+		if len(batch) == MaxBatchSize {
+			batches = append(batches, batch)
+			batch = make([]*Person, 0, MaxBatchSize)
+		}
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, batch := range batches {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(batch []*Person) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fail(s.writeBatch(ctx, batch)...)
+		}(batch)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
+
+// writeBatch writes one batch and returns the people it could not save.
+func (s *DynamoDBBatchSaver) writeBatch(ctx context.Context, batch []*Person) []*ItemError {
+	var failed []*ItemError
+
+	valid := make([]*Person, 0, len(batch))
+	for _, p := range batch {
+		if err := p.Validate(); err != nil {
+			failed = append(failed, &ItemError{Person: p, Err: err})
+			continue
+		}
+		valid = append(valid, p)
+	}
+	created, err := s.created(ctx, valid)
+	if err != nil {
+		for _, p := range valid {
+			failed = append(failed, &ItemError{Person: p, Err: err})
+		}
+		return failed
+	}
+
+	pending := make([]*dynamodb.WriteRequest, 0, len(valid))
+	byID := make(map[string]*Person, len(valid))
+	now := timestamp()
+	for _, p := range valid {
+		if p.CreatedAt.IsZero() {
+			p.CreatedAt = created[p.ID]
+		}
+		p.stamp(now)
+		item, err := s.Table.item(p)
+		if err != nil {
+			failed = append(failed, &ItemError{Person: p, Err: err})
+			continue
+		}
+		pending = append(pending, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: item}})
+		byID[p.ID] = p
+	}
+
+	failAll := func(err error) []*ItemError {
+		for _, req := range pending {
+			id := aws.StringValue(req.PutRequest.Item[KeyAttribute].S)
+			failed = append(failed, &ItemError{Person: byID[id], Err: err})
+		}
+		return failed
+	}
+
+	backoff := s.backoff()
+	table := s.Table.Name
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			if err := s.wait(ctx, attempt, &backoff); err != nil {
+				return failAll(err)
+			}
+		}
+
+		input := &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{table: pending},
+		}
+		output, err := s.Client.BatchWriteItemWithContext(ctx, input)
+		if err != nil {
+			return failAll(wrapErr("BatchWriteItem", err))
+		}
+		pending = output.UnprocessedItems[table]
+	}
+
+	return failed
+}
+
+// created reads the stored CreatedAt of the people of batch that have none, by ID.
+// People that aren't stored yet are left out.
+func (s *DynamoDBBatchSaver) created(ctx context.Context, batch []*Person) (map[string]time.Time, error) {
+	var keys []map[string]*dynamodb.AttributeValue
+	for _, p := range batch {
+		if p.CreatedAt.IsZero() {
+			keys = append(keys, s.Table.key(p.ID))
+		}
+	}
+
+	created := make(map[string]time.Time, len(keys))
+	backoff := s.backoff()
+	table := s.Table.Name
+	for attempt := 0; len(keys) > 0; attempt++ {
+		if attempt > 0 {
+			if err := s.wait(ctx, attempt, &backoff); err != nil {
+				return nil, err
+			}
+		}
+
+		input := &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]*dynamodb.KeysAndAttributes{
+				table: {Keys: keys, ConsistentRead: aws.Bool(true)},
+			},
+		}
+		output, err := s.Client.BatchGetItemWithContext(ctx, input)
+		if err != nil {
+			return nil, wrapErr("BatchGetItem", err)
+		}
+		for _, item := range output.Responses[table] {
+			id := aws.StringValue(item[s.Table.partitionKey()].S)
+			var stored struct{ CreatedAt time.Time }
+			if err := dynamodbattribute.UnmarshalMap(item, &stored); err != nil {
+				return nil, unmarshalError("person "+id, err)
+			}
+			created[id] = stored.CreatedAt
+		}
+		keys = nil
+		if unprocessed := output.UnprocessedKeys[table]; unprocessed != nil {
+			keys = unprocessed.Keys
+		}
+	}
+	return created, nil
+}
+
+func (s *DynamoDBBatchSaver) backoff() time.Duration {
+	if s.Backoff <= 0 {
+		return DefaultBatchBackoff
+	}
+	return s.Backoff
+}
+
+// wait waits before resending what a request left unprocessed for the attempt-th time,
+// doubling backoff, and returns ErrUnprocessed once the retries are used up.
+func (s *DynamoDBBatchSaver) wait(ctx context.Context, attempt int, backoff *time.Duration) error {
+	retries := s.Retries
+	if retries <= 0 {
+		retries = DefaultBatchRetries
+	}
+	if attempt > retries {
+		return ErrUnprocessed
+	}
+	// full jitter keeps concurrent batches from retrying in lockstep
+	wait := time.Duration(rand.Int63n(int64(*backoff) + 1))
+	*backoff *= 2
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
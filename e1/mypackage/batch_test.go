@@ -0,0 +1,240 @@
+package mypackage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+	"github.com/idiomat/dodtnyt/e1/mypackage/ddbfake"
+)
+
+// batchClient leaves the first `unprocessed` items of each request unprocessed
+// until it has been called `flaky` times.
+type batchClient struct {
+	mu          sync.Mutex
+	calls       int
+	flaky       int
+	unprocessed int
+	failIDs     map[string]bool // requests containing these IDs fail outright
+	written     map[string]bool
+	inFlight    int
+	maxInFlight int
+}
+
+func (c *batchClient) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	c.mu.Lock()
+	c.calls++
+	c.inFlight++
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	calls := c.calls
+	c.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+
+	output := &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]*dynamodb.WriteRequest{}}
+	for table, reqs := range input.RequestItems {
+		if len(reqs) > mypackage.MaxBatchSize {
+			return nil, fmt.Errorf("batch of %d items", len(reqs))
+		}
+		for _, req := range reqs {
+			if c.failIDs[aws.StringValue(req.PutRequest.Item["ID"].S)] {
+				return nil, errors.New("validation failed")
+			}
+		}
+		for i, req := range reqs {
+			id := aws.StringValue(req.PutRequest.Item["ID"].S)
+			if calls <= c.flaky && i < c.unprocessed {
+				output.UnprocessedItems[table] = append(output.UnprocessedItems[table], req)
+				continue
+			}
+			c.written[id] = true
+		}
+	}
+	return output, nil
+}
+
+// BatchGetItemWithContext finds none of the keys, as if every Person were new.
+func (c *batchClient) BatchGetItemWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	return &dynamodb.BatchGetItemOutput{}, nil
+}
+
+func people(n int) []*mypackage.Person {
+	ps := make([]*mypackage.Person, n)
+	for i := range ps {
+		ps[i] = &mypackage.Person{ID: fmt.Sprintf("p%d", i), Name: "Johnny"}
+	}
+	return ps
+}
+
+func TestDynamoDBBatchSaver_SaveAll(t *testing.T) {
+	tests := map[string]struct {
+		people      int
+		flaky       int
+		unprocessed int
+		failIDs     map[string]bool
+		wantFailed  int
+		wantErr     error
+	}{
+		"single batch": {
+			people: 10,
+		},
+		"many batches": {
+			people: 130,
+		},
+		"unprocessed items are resent": {
+			people:      60,
+			flaky:       4,
+			unprocessed: 5,
+		},
+		"unprocessed items give up": {
+			people:      30,
+			flaky:       100,
+			unprocessed: 2,
+			wantFailed:  4,
+			wantErr:     mypackage.ErrUnprocessed,
+		},
+		"failed batch": {
+			people:     50,
+			failIDs:    map[string]bool{"p30": true},
+			wantFailed: 25,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &batchClient{
+				flaky:       tc.flaky,
+				unprocessed: tc.unprocessed,
+				failIDs:     tc.failIDs,
+				written:     make(map[string]bool),
+			}
+			saver := &mypackage.DynamoDBBatchSaver{Client: client, Table: table, Concurrency: 2, Retries: 3, Backoff: time.Millisecond}
+
+			err := saver.SaveAll(context.Background(), people(tc.people))
+
+			var batchErr *mypackage.BatchError
+			if tc.wantFailed == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if !errors.As(err, &batchErr) || len(batchErr.Failed) != tc.wantFailed {
+				t.Fatalf("expected %d failed items but got %v", tc.wantFailed, err)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("expected %v but got %v", tc.wantErr, err)
+			}
+			if got := len(client.written) + tc.wantFailed; got != tc.people {
+				t.Errorf("expected %d written but got %d", tc.people-tc.wantFailed, len(client.written))
+			}
+			if client.maxInFlight > 2 {
+				t.Errorf("expected at most 2 batches in flight but got %d", client.maxInFlight)
+			}
+		})
+	}
+}
+
+func TestDynamoDBBatchSaver_SaveAllDuplicates(t *testing.T) {
+	fake := ddbfake.New()
+	if err := fake.CreateTable("people", "ID", ""); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	saver := &mypackage.DynamoDBBatchSaver{Client: fake, Table: table}
+
+	ps := []*mypackage.Person{
+		{ID: "p1", Name: "Johnny"},
+		{ID: "p2", Name: "Mary"},
+		{ID: "p1", Name: "John"},
+	}
+	if err := saver.SaveAll(context.Background(), ps); err != nil {
+		t.Fatalf("SaveAll() error = %v", err)
+	}
+
+	got, err := (&mypackage.DynamoDBGetter{Client: fake, Table: table}).Get(context.Background(), "p1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Name != "John" {
+		t.Errorf("expected the last p1 to be saved but got %s", got.Name)
+	}
+	if items, _ := fake.Items("people"); len(items) != 2 {
+		t.Errorf("expected 2 people stored but got %d", len(items))
+	}
+}
+
+func TestDynamoDBBatchSaver_SaveAllKeepsCreatedAt(t *testing.T) {
+	fake := newPeopleFake(t)
+	saver := &mypackage.DynamoDBBatchSaver{Client: fake, Table: table}
+	ctx := context.Background()
+
+	first := people(2)
+	if err := saver.SaveAll(ctx, first); err != nil {
+		t.Fatalf("SaveAll() error = %v", err)
+	}
+	created := first[1].CreatedAt
+
+	// p1 is saved again without its CreatedAt, p2 is new
+	again := []*mypackage.Person{{ID: "p1", Name: "John"}, {ID: "p2", Name: "Jane"}}
+	if err := saver.SaveAll(ctx, again); err != nil {
+		t.Fatalf("SaveAll() again error = %v", err)
+	}
+	if !again[0].CreatedAt.Equal(created) || !again[0].UpdatedAt.After(created) {
+		t.Errorf("expected SaveAll() to keep CreatedAt %v and bump UpdatedAt but got %+v", created, again[0])
+	}
+	if !again[1].CreatedAt.Equal(again[1].UpdatedAt) {
+		t.Errorf("expected a new person created when saved but got %+v", again[1])
+	}
+
+	got, err := (&mypackage.DynamoDBGetter{Client: fake, Table: table}).Get(ctx, "p1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Name != "John" || !got.CreatedAt.Equal(created) {
+		t.Errorf("Get() = %+v, want John created at %v", got, created)
+	}
+}
+
+func TestDynamoDBBatchSaver_SaveAllNil(t *testing.T) {
+	client := &batchClient{written: make(map[string]bool)}
+	saver := &mypackage.DynamoDBBatchSaver{Client: client, Table: table}
+	ctx := context.Background()
+
+	ps := append(people(2), nil)
+	err := saver.SaveAll(ctx, ps)
+	if !errors.Is(err, mypackage.ErrValidation) {
+		t.Fatalf("expected %v but got %v", mypackage.ErrValidation, err)
+	}
+	if len(client.written) != 0 {
+		t.Errorf("expected nothing written but got %v", client.written)
+	}
+
+	// Save fails the same way
+	single := &mypackage.DynamoDBSaver{Client: &testClient{}, Table: table}
+	if saveErr := single.Save(ctx, nil); !errors.Is(saveErr, mypackage.ErrValidation) {
+		t.Errorf("expected Save() of nil to fail with %v but got %v", mypackage.ErrValidation, saveErr)
+	}
+}
+
+func TestDynamoDBBatchSaver_SaveAllCancelled(t *testing.T) {
+	client := &batchClient{flaky: 100, unprocessed: 1, written: make(map[string]bool)}
+	saver := &mypackage.DynamoDBBatchSaver{Client: client, Table: table, Retries: 10, Backoff: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := saver.SaveAll(ctx, people(5)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v but got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,392 @@
+package mypackage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of bulk files.
+const (
+	FormatJSONL = "jsonl" // a Person per line, as JSON
+	FormatCSV   = "csv"   // a Person per row, under a header row of column names
+)
+
+// TagSeparator separates the tags of a Person in a CSV column.
+const TagSeparator = ";"
+
+// CSVFields are the Person fields a CSV file holds, in the order they are written.
+var CSVFields = []string{
+	"ID", "Name", "Email", "BirthDate",
+	"Address.Street", "Address.City", "Address.PostalCode", "Address.Country",
+	"Tags", "CreatedAt", "UpdatedAt", "Version",
+}
+
+// Columns maps Person fields, named as in CSVFields, to the CSV columns holding them.
+// Fields it doesn't map are held in a column named after the field.
+type Columns map[string]string
+
+// ParseColumns parses a column mapping written as field=column pairs separated by commas,
+// e.g. Name=full_name,Address.City=city.
+func ParseColumns(s string) (Columns, error) {
+	cols := Columns{}
+	if s == "" {
+		return cols, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid column mapping %q: want field=column", pair)
+		}
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if _, ok := cols[field]; ok {
+			return nil, fmt.Errorf("field %s is mapped twice", field)
+		}
+		cols[field] = column
+	}
+	return cols, cols.validate()
+}
+
+func (c Columns) validate() error {
+	known := make(map[string]bool, len(CSVFields))
+	for _, f := range CSVFields {
+		known[f] = true
+	}
+	for field, column := range c {
+		if !known[field] {
+			return fmt.Errorf("unknown field: %s", field)
+		}
+		if column == "" {
+			return fmt.Errorf("field %s is mapped to an empty column", field)
+		}
+	}
+	seen := make(map[string]string, len(CSVFields))
+	for _, f := range CSVFields {
+		column := c.column(f)
+		if other, ok := seen[column]; ok {
+			return fmt.Errorf("fields %s and %s are both in column %s", other, f, column)
+		}
+		seen[column] = f
+	}
+	return nil
+}
+
+// column returns the column holding field.
+func (c Columns) column(field string) string {
+	if column, ok := c[field]; ok {
+		return column
+	}
+	return field
+}
+
+// RecordError is a record of a bulk file that couldn't be read or imported.
+type RecordError struct {
+	Record int    // counting from 1, not including a CSV header
+	ID     string // of the Person, if it was read
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	if e.ID != "" {
+		return fmt.Sprintf("record %d (person %s): %v", e.Record, e.ID, e.Err)
+	}
+	return fmt.Sprintf("record %d: %v", e.Record, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// PersonReader reads people from a bulk file, one record at a time.
+type PersonReader interface {
+	// Read returns the next Person, or io.EOF after the last one.
+	// A record that can't be decoded is returned as a *RecordError, and reading can go on past it.
+	Read() (*Person, error)
+}
+
+// PersonWriter writes people to a bulk file.
+type PersonWriter interface {
+	Write(p *Person) error
+	// Flush writes anything buffered. It must be called once every Person is written.
+	Flush() error
+}
+
+// NewPersonReader returns a reader of the people in r, written in format.
+// cols is only used by FormatCSV.
+func NewPersonReader(format string, r io.Reader, cols Columns) (PersonReader, error) {
+	switch format {
+	case FormatJSONL:
+		return NewJSONLReader(r), nil
+	case FormatCSV:
+		return NewCSVReader(r, cols)
+	}
+	return nil, fmt.Errorf("unknown format: %s", format)
+}
+
+// NewPersonWriter returns a writer of people to w, in format.
+// cols is only used by FormatCSV.
+func NewPersonWriter(format string, w io.Writer, cols Columns) (PersonWriter, error) {
+	switch format {
+	case FormatJSONL:
+		return NewJSONLWriter(w), nil
+	case FormatCSV:
+		return NewCSVWriter(w, cols)
+	}
+	return nil, fmt.Errorf("unknown format: %s", format)
+}
+
+// JSONLReader reads people from JSON Lines, skipping blank lines.
+// Fields a Person doesn't have are rejected.
+type JSONLReader struct {
+	r      *bufio.Reader
+	record int
+}
+
+// NewJSONLReader returns a JSONLReader reading from r.
+func NewJSONLReader(r io.Reader) *JSONLReader {
+	return &JSONLReader{r: bufio.NewReader(r)}
+}
+
+func (jr *JSONLReader) Read() (*Person, error) {
+	for {
+		line, err := jr.r.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		jr.record++
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		var p Person
+		if err := dec.Decode(&p); err != nil {
+			return nil, &RecordError{Record: jr.record, Err: err}
+		}
+		if dec.More() {
+			return nil, &RecordError{Record: jr.record, ID: p.ID, Err: errors.New("more than one value on the line")}
+		}
+		return &p, nil
+	}
+}
+
+// JSONLWriter writes people as JSON Lines.
+type JSONLWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewJSONLWriter returns a JSONLWriter writing to w.
+func NewJSONLWriter(w io.Writer) *JSONLWriter {
+	bw := bufio.NewWriter(w)
+	return &JSONLWriter{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (jw *JSONLWriter) Write(p *Person) error {
+	return jw.enc.Encode(p)
+}
+
+func (jw *JSONLWriter) Flush() error {
+	return jw.w.Flush()
+}
+
+// CSVReader reads people from CSV, finding the column of each field in the header row.
+// Columns that don't hold a field are rejected, and fields without a column are left empty.
+// Tags are separated by TagSeparator, and times are in RFC 3339 format.
+type CSVReader struct {
+	r      *csv.Reader
+	cols   Columns
+	fields []string // of each column, read from the header
+	record int
+}
+
+// NewCSVReader returns a CSVReader reading from r, with the fields in the columns cols maps them to.
+func NewCSVReader(r io.Reader, cols Columns) (*CSVReader, error) {
+	if err := cols.validate(); err != nil {
+		return nil, err
+	}
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	return &CSVReader{r: cr, cols: cols}, nil
+}
+
+// header reads the header row.
+func (cr *CSVReader) header() error {
+	header, err := cr.r.Read()
+	if errors.Is(err, io.EOF) {
+		return errors.New("missing CSV header")
+	}
+	if err != nil {
+		return fmt.Errorf("invalid CSV header: %w", err)
+	}
+
+	byColumn := make(map[string]string, len(CSVFields))
+	for _, f := range CSVFields {
+		byColumn[cr.cols.column(f)] = f
+	}
+	cr.fields = make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, column := range header {
+		field, ok := byColumn[column]
+		if !ok {
+			return fmt.Errorf("unknown CSV column: %s", column)
+		}
+		if seen[column] {
+			return fmt.Errorf("duplicate CSV column: %s", column)
+		}
+		seen[column] = true
+		cr.fields[i] = field
+	}
+	return nil
+}
+
+func (cr *CSVReader) Read() (*Person, error) {
+	if cr.fields == nil {
+		if err := cr.header(); err != nil {
+			return nil, err
+		}
+	}
+
+	row, err := cr.r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	cr.record++
+	var pErr *csv.ParseError
+	if errors.As(err, &pErr) {
+		return nil, &RecordError{Record: cr.record, Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Person{}
+	addr := &Address{}
+	var errs []error
+	for i, value := range row {
+		if err := setField(p, addr, cr.fields[i], value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", cr.cols.column(cr.fields[i]), err))
+		}
+	}
+	if *addr != (Address{}) {
+		p.Address = addr
+	}
+	if len(errs) > 0 {
+		return nil, &RecordError{Record: cr.record, ID: p.ID, Err: errors.Join(errs...)}
+	}
+	return p, nil
+}
+
+// setField sets field of p, or of its address, to value read from CSV.
+func setField(p *Person, addr *Address, field, value string) error {
+	var err error
+	switch field {
+	case "ID":
+		p.ID = value
+	case "Name":
+		p.Name = value
+	case "Email":
+		p.Email = value
+	case "BirthDate":
+		p.BirthDate = value
+	case "Address.Street":
+		addr.Street = value
+	case "Address.City":
+		addr.City = value
+	case "Address.PostalCode":
+		addr.PostalCode = value
+	case "Address.Country":
+		addr.Country = value
+	case "Tags":
+		if value != "" {
+			p.Tags = strings.Split(value, TagSeparator)
+		}
+	case "CreatedAt":
+		p.CreatedAt, err = parseTime(value)
+	case "UpdatedAt":
+		p.UpdatedAt, err = parseTime(value)
+	case "Version":
+		if value != "" {
+			p.Version, err = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return err
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// CSVWriter writes people as CSV, with every field of CSVFields in the column cols maps it to.
+type CSVWriter struct {
+	w      *csv.Writer
+	cols   Columns
+	header bool // written
+}
+
+// NewCSVWriter returns a CSVWriter writing to w.
+func NewCSVWriter(w io.Writer, cols Columns) (*CSVWriter, error) {
+	if err := cols.validate(); err != nil {
+		return nil, err
+	}
+	return &CSVWriter{w: csv.NewWriter(w), cols: cols}, nil
+}
+
+func (cw *CSVWriter) writeHeader() error {
+	if cw.header {
+		return nil
+	}
+	header := make([]string, len(CSVFields))
+	for i, f := range CSVFields {
+		header[i] = cw.cols.column(f)
+	}
+	cw.header = true
+	return cw.w.Write(header)
+}
+
+func (cw *CSVWriter) Write(p *Person) error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	var addr Address
+	if p.Address != nil {
+		addr = *p.Address
+	}
+	return cw.w.Write([]string{
+		p.ID, p.Name, p.Email, p.BirthDate,
+		addr.Street, addr.City, addr.PostalCode, addr.Country,
+		strings.Join(p.Tags, TagSeparator), formatTime(p.CreatedAt), formatTime(p.UpdatedAt),
+		strconv.FormatInt(p.Version, 10),
+	})
+}
+
+// Flush writes the header too, if no Person was written.
+func (cw *CSVWriter) Flush() error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
@@ -0,0 +1,262 @@
+package mypackage_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+)
+
+func TestParseColumns(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		want    mypackage.Columns
+		wantErr string
+	}{
+		"empty": {
+			in:   "",
+			want: mypackage.Columns{},
+		},
+		"mapped": {
+			in:   "Name=full_name, Address.City=city",
+			want: mypackage.Columns{"Name": "full_name", "Address.City": "city"},
+		},
+		"no column": {
+			in:      "Name",
+			wantErr: `invalid column mapping "Name": want field=column`,
+		},
+		"unknown field": {
+			in:      "Nickname=nick",
+			wantErr: "unknown field: Nickname",
+		},
+		"mapped twice": {
+			in:      "Name=a,Name=b",
+			wantErr: "field Name is mapped twice",
+		},
+		"empty column": {
+			in:      "Name=",
+			wantErr: "field Name is mapped to an empty column",
+		},
+		"shared column": {
+			in:      "Name=Email",
+			wantErr: "fields Name and Email are both in column Email",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := mypackage.ParseColumns(tc.in)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("ParseColumns() error = %v, want %s", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseColumns() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseColumns() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func bulkPeople() []*mypackage.Person {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC)
+	return []*mypackage.Person{
+		{
+			ID:        "p1",
+			Name:      "Johnny, \"Jr\"",
+			Email:     "johnny@example.com",
+			BirthDate: "1990-01-02",
+			Address:   &mypackage.Address{Street: "Rua 1", City: "Lisbon", PostalCode: "1000-001", Country: "PT"},
+			Tags:      []string{"a", "b"},
+			CreatedAt: created,
+			UpdatedAt: created.Add(time.Hour),
+			Version:   3,
+		},
+		{ID: "p2", Name: "Mary"},
+	}
+}
+
+func TestBulk_RoundTrip(t *testing.T) {
+	tests := map[string]struct {
+		format string
+		cols   mypackage.Columns
+	}{
+		"jsonl":          {format: mypackage.FormatJSONL},
+		"csv":            {format: mypackage.FormatCSV},
+		"mapped columns": {format: mypackage.FormatCSV, cols: mypackage.Columns{"Name": "full_name", "Address.City": "city"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := mypackage.NewPersonWriter(tc.format, &buf, tc.cols)
+			if err != nil {
+				t.Fatalf("NewPersonWriter() error = %v", err)
+			}
+			for _, p := range bulkPeople() {
+				if err := w.Write(p); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("Flush() error = %v", err)
+			}
+
+			r, err := mypackage.NewPersonReader(tc.format, &buf, tc.cols)
+			if err != nil {
+				t.Fatalf("NewPersonReader() error = %v", err)
+			}
+			var got []*mypackage.Person
+			for {
+				p, err := r.Read()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Read() error = %v", err)
+				}
+				got = append(got, p)
+			}
+			if want := bulkPeople(); !reflect.DeepEqual(got, want) {
+				t.Errorf("read back %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCSVWriter_Header(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := mypackage.NewCSVWriter(&buf, mypackage.Columns{"ID": "id"})
+	if err != nil {
+		t.Fatalf("NewCSVWriter() error = %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	want := "id,Name,Email,BirthDate,Address.Street,Address.City,Address.PostalCode,Address.Country,Tags,CreatedAt,UpdatedAt,Version\n"
+	if buf.String() != want {
+		t.Errorf("wrote %q, want %q", buf.String(), want)
+	}
+}
+
+// readRecords reads every record, describing each as its ID or error.
+func readRecords(r mypackage.PersonReader) ([]string, error) {
+	var got []string
+	for {
+		p, err := r.Read()
+		var rErr *mypackage.RecordError
+		switch {
+		case errors.Is(err, io.EOF):
+			return got, nil
+		case errors.As(err, &rErr):
+			got = append(got, rErr.Error())
+		case err != nil:
+			return got, err
+		default:
+			got = append(got, p.ID)
+		}
+	}
+}
+
+func TestPersonReader_Read(t *testing.T) {
+	tests := map[string]struct {
+		format  string
+		cols    mypackage.Columns
+		in      string
+		want    []string
+		wantErr string
+	}{
+		"jsonl": {
+			format: mypackage.FormatJSONL,
+			in:     "{\"ID\":\"p1\"}\n\n  \n{\"ID\":\"p2\"}",
+			want:   []string{"p1", "p2"},
+		},
+		"jsonl bad records": {
+			format: mypackage.FormatJSONL,
+			in:     "{\"ID\":\"p1\",\"Nickname\":\"J\"}\n{\"ID\":\n{\"ID\":\"p3\"} {}\n{\"ID\":\"p4\"}\n",
+			want: []string{
+				`record 1: json: unknown field "Nickname"`,
+				"record 2: unexpected EOF",
+				"record 3 (person p3): more than one value on the line",
+				"p4",
+			},
+		},
+		"csv": {
+			format: mypackage.FormatCSV,
+			cols:   mypackage.Columns{"ID": "id"},
+			in:     "Name,id\nJohnny,p1\nMary,p2\n",
+			want:   []string{"p1", "p2"},
+		},
+		"csv bad records": {
+			format: mypackage.FormatCSV,
+			in:     "ID,Version,CreatedAt\np1,x,\np2\np3,1,yesterday\np4,2,\n",
+			want: []string{
+				`record 1 (person p1): Version: strconv.ParseInt: parsing "x": invalid syntax`,
+				"record 2: record on line 3: wrong number of fields",
+				`record 3 (person p3): CreatedAt: parsing time "yesterday" as "2006-01-02T15:04:05.999999999Z07:00": cannot parse "yesterday" as "2006"`,
+				"p4",
+			},
+		},
+		"csv unknown column": {
+			format:  mypackage.FormatCSV,
+			in:      "ID,Nickname\np1,J\n",
+			wantErr: "unknown CSV column: Nickname",
+		},
+		"csv duplicate column": {
+			format:  mypackage.FormatCSV,
+			in:      "ID,ID\np1,p1\n",
+			wantErr: "duplicate CSV column: ID",
+		},
+		"csv unmapped column": {
+			format:  mypackage.FormatCSV,
+			cols:    mypackage.Columns{"ID": "id"},
+			in:      "ID\np1\n",
+			wantErr: "unknown CSV column: ID",
+		},
+		"csv without header": {
+			format:  mypackage.FormatCSV,
+			in:      "",
+			wantErr: "missing CSV header",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, err := mypackage.NewPersonReader(tc.format, strings.NewReader(tc.in), tc.cols)
+			if err != nil {
+				t.Fatalf("NewPersonReader() error = %v", err)
+			}
+			got, err := readRecords(r)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("Read() error = %v, want %s", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("read %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewPersonReader_UnknownFormat(t *testing.T) {
+	if _, err := mypackage.NewPersonReader("xml", strings.NewReader(""), nil); err == nil || err.Error() != "unknown format: xml" {
+		t.Errorf("NewPersonReader() error = %v, want unknown format: xml", err)
+	}
+	if _, err := mypackage.NewPersonWriter("xml", io.Discard, nil); err == nil || err.Error() != "unknown format: xml" {
+		t.Errorf("NewPersonWriter() error = %v, want unknown format: xml", err)
+	}
+}
@@ -2,8 +2,11 @@ package mypackage
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/request"
@@ -18,29 +21,242 @@ type ddbClient interface {
 	PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error)
 }
 
+// ddbSaverClient is what DynamoDBSaver needs: UpdateItem too, to save a Person
+// again without overwriting when it was created.
+type ddbSaverClient interface {
+	ddbClient
+	ddbUpdater
+}
+
+// VersionAttribute is the name of the attribute holding a Person's version.
+const VersionAttribute = "Version"
+
+var (
+	// ErrVersionConflict is returned when a Person was changed by someone else since it was read.
+	ErrVersionConflict = errors.New("person was modified concurrently")
+	// ErrAlreadyExists is returned by Create when a Person with the same ID exists.
+	ErrAlreadyExists = errors.New("person already exists")
+)
+
 // DynamoDBSaver interacts with DynamoDB.
+// When Versioned is set, Save only overwrites a Person whose stored version matches
+// the one being saved, and increments it.
 type DynamoDBSaver struct {
-	Client ddbClient
+	Client    ddbSaverClient
+	Table     Table
+	Versioned bool
+}
+
+// NewDynamoDBSaver returns a DynamoDBSaver writing to table.
+func NewDynamoDBSaver(client ddbSaverClient, table Table) (*DynamoDBSaver, error) {
+	s := &DynamoDBSaver{Client: client, Table: table}
+	return s, s.validate()
 }
 
-// Person captures demographics.
-type Person struct {
-	Name string
+func (s *DynamoDBSaver) validate() error {
+	if s.Client == nil {
+		return errors.New("client is required")
+	}
+	return s.Table.validate()
 }
 
-// Save saves.
+// Save validates and saves p, setting its timestamps.
+// Saving a Person without CreatedAt keeps the one stored, if any.
+// A versioned save of a Person with version 0 only succeeds if it doesn't exist yet.
 func (s *DynamoDBSaver) Save(ctx context.Context, p *Person) error {
-	item, err := dynamodbattribute.MarshalMap(p)
+	put, err := s.prepareSave(p)
+	if err != nil {
+		return err
+	}
+	return s.put(ctx, p, put)
+}
+
+// Create saves a Person only if no Person with its ID exists, returning ErrAlreadyExists otherwise.
+func (s *DynamoDBSaver) Create(ctx context.Context, p *Person) error {
+	put, err := s.prepareCreate(p)
+	if err != nil {
+		return err
+	}
+	return s.put(ctx, p, put)
+}
+
+// preparedPut is a PutItem saving a Person, ready to be sent alone or in a transaction.
+// A Person that may exist and has no CreatedAt is written with update instead, keeping the stored one.
+type preparedPut struct {
+	input   *dynamodb.PutItemInput
+	update  *dynamodb.UpdateItemInput
+	person  Person // the Person once written
+	condErr error  // what a failed condition means
+}
+
+func (s *DynamoDBSaver) prepareSave(p *Person) (*preparedPut, error) {
+	if p == nil {
+		return nil, errNilPerson
+	}
+	if !s.Versioned {
+		return s.preparePut(p, p.Version, nil, nil)
+	}
+	if p.Version == 0 {
+		return s.preparePut(p, 1, s.Table.notExists(), fmt.Errorf("%s at version 0: %w", p.ID, ErrVersionConflict))
+	}
+	cond := &expression{
+		expr:   "#version = :version",
+		names:  map[string]*string{"#version": aws.String(VersionAttribute)},
+		values: map[string]*dynamodb.AttributeValue{":version": {N: aws.String(fmt.Sprint(p.Version))}},
+	}
+	return s.preparePut(p, p.Version+1, cond, fmt.Errorf("%s at version %d: %w", p.ID, p.Version, ErrVersionConflict))
+}
+
+func (s *DynamoDBSaver) prepareCreate(p *Person) (*preparedPut, error) {
+	version := p.Version
+	if s.Versioned {
+		version = 1
+	}
+	return s.preparePut(p, version, s.Table.notExists(), fmt.Errorf("%s: %w", p.ID, ErrAlreadyExists))
+}
+
+// expression is a condition along with the placeholders it uses.
+type expression struct {
+	expr   string
+	names  map[string]*string
+	values map[string]*dynamodb.AttributeValue
+	create bool // only holds when the item doesn't exist
+}
+
+func (t Table) notExists() *expression {
+	return &expression{
+		expr:   "attribute_not_exists(#key)",
+		names:  map[string]*string{"#key": aws.String(t.partitionKey())},
+		create: true,
+	}
+}
+
+// upsert returns an UpdateItem replacing the stored Person with item, like a PutItem would,
+// except that a stored CreatedAt is kept.
+func (t Table) upsert(item map[string]*dynamodb.AttributeValue, cond *expression) *dynamodb.UpdateItemInput {
+	pk := t.partitionKey()
+	names := map[string]*string{"#created": aws.String("CreatedAt")}
+	values := map[string]*dynamodb.AttributeValue{":created": item["CreatedAt"]}
+	if cond != nil {
+		for k, v := range cond.names {
+			names[k] = v
+		}
+		for k, v := range cond.values {
+			values[k] = v
+		}
+	}
+
+	// sorted so the same Person always produces the same expression
+	attrs := make([]string, 0, len(personAttrs))
+	for attr := range personAttrs {
+		attrs = append(attrs, attr)
+	}
+	for attr := range item {
+		if !personAttrs[attr] {
+			attrs = append(attrs, attr)
+		}
+	}
+	sort.Strings(attrs)
+
+	set := []string{"#created = if_not_exists(#created, :created)"}
+	var remove []string
+	for i, attr := range attrs {
+		if attr == pk || attr == "CreatedAt" {
+			continue
+		}
+		name := fmt.Sprintf("#a%d", i)
+		names[name] = aws.String(attr)
+		v, ok := item[attr]
+		if !ok {
+			// an empty omitempty field, which a PutItem would leave out
+			remove = append(remove, name)
+			continue
+		}
+		placeholder := fmt.Sprintf(":v%d", i)
+		values[placeholder] = v
+		set = append(set, name+" = "+placeholder)
+	}
+	expr := "SET " + strings.Join(set, ", ")
+	if len(remove) > 0 {
+		expr += " REMOVE " + strings.Join(remove, ", ")
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		Key:                       map[string]*dynamodb.AttributeValue{pk: item[pk]},
+		TableName:                 aws.String(t.Name),
+		UpdateExpression:          aws.String(expr),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnValues:              aws.String(dynamodb.ReturnValueAllNew),
+	}
+	if cond != nil {
+		input.ConditionExpression = aws.String(cond.expr)
+	}
+	return input
+}
+
+func (s *DynamoDBSaver) preparePut(p *Person, version int64, cond *expression, condErr error) (*preparedPut, error) {
+	if err := s.Table.validate(); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	next := *p
+	next.Version = version
+	next.stamp(timestamp())
+	item, err := s.Table.item(&next)
 	if err != nil {
-		return fmt.Errorf("failed to marshal shoutout for storage: %s", err)
+		return nil, err
 	}
 
+	if p.CreatedAt.IsZero() && (cond == nil || !cond.create) {
+		return &preparedPut{update: s.Table.upsert(item, cond), person: next, condErr: condErr}, nil
+	}
 	input := &dynamodb.PutItemInput{
 		Item:      item,
-		TableName: aws.String(os.Getenv("TABLE_NAME")),
+		TableName: aws.String(s.Table.Name),
+	}
+	if cond != nil {
+		input.ConditionExpression = aws.String(cond.expr)
+		input.ExpressionAttributeNames = cond.names
+		if len(cond.values) > 0 {
+			input.ExpressionAttributeValues = cond.values
+		}
 	}
+	return &preparedPut{input: input, person: next, condErr: condErr}, nil
+}
 
-	_, err = s.Client.PutItemWithContext(ctx, input)
+func (s *DynamoDBSaver) put(ctx context.Context, p *Person, put *preparedPut) error {
+	if put.update != nil {
+		return s.upsert(ctx, p, put)
+	}
+	if _, err := s.Client.PutItemWithContext(ctx, put.input); err != nil {
+		err = wrapErr("PutItem", err)
+		if put.condErr != nil && errors.Is(err, ErrConditionFailed) {
+			return fmt.Errorf("%w: %w", put.condErr, err)
+		}
+		return err
+	}
+	*p = put.person
+	return nil
+}
 
-	return err
+func (s *DynamoDBSaver) upsert(ctx context.Context, p *Person, put *preparedPut) error {
+	output, err := s.Client.UpdateItemWithContext(ctx, put.update)
+	if err != nil {
+		err = wrapErr("UpdateItem", err)
+		if put.condErr != nil && errors.Is(err, ErrConditionFailed) {
+			return fmt.Errorf("%w: %w", put.condErr, err)
+		}
+		return err
+	}
+	var stored struct{ CreatedAt time.Time }
+	if err := dynamodbattribute.UnmarshalMap(output.Attributes, &stored); err != nil {
+		return unmarshalError("person "+p.ID, err)
+	}
+	*p = put.person
+	p.CreatedAt = stored.CreatedAt
+	return nil
 }
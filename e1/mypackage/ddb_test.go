@@ -3,35 +3,54 @@ package mypackage_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/idiomat/dodtnyt/e1/mypackage"
 )
 
+var table = mypackage.Table{Name: "people"}
+
 // Note how our testClient does not need to depend on the `mypackage.ddbClient` interface here.
 type testClient struct {
 	output *dynamodb.PutItemOutput
 	err    error
+	input  *dynamodb.PutItemInput
+	update *dynamodb.UpdateItemInput
 }
 
 // We only need our client to satisfy just the bits we need from the DynamoDB client interface implicitly.
 func (c *testClient) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	c.input = input
 	return c.output, c.err
 }
 
+// UpdateItemWithContext returns the attributes it was asked to set, as if the item were new.
+func (c *testClient) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	c.update = input
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &dynamodb.UpdateItemOutput{Attributes: map[string]*dynamodb.AttributeValue{
+		"CreatedAt": input.ExpressionAttributeValues[":created"],
+	}}, nil
+}
+
 func TestDynamoDBSaver(t *testing.T) {
 	tests := map[string]struct {
 		person *mypackage.Person
 		err    error // We can even mock out errors to test sad paths
 	}{
 		"happy path": {
-			person: &mypackage.Person{Name: "Johnny"},
+			person: &mypackage.Person{ID: "p1", Name: "Johnny"},
 		},
 		"sad path": {
-			person: &mypackage.Person{Name: "Johnny"},
+			person: &mypackage.Person{ID: "p1", Name: "Johnny"},
 			err:    errors.New("failed to save"),
 		},
 	}
@@ -39,7 +58,7 @@ func TestDynamoDBSaver(t *testing.T) {
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
 			client := &testClient{err: tc.err}
-			saver := &mypackage.DynamoDBSaver{Client: client}
+			saver := &mypackage.DynamoDBSaver{Client: client, Table: table}
 			ctx := context.Background()
 			if err := saver.Save(ctx, tc.person); err != tc.err {
 				t.Errorf("expected %v but got %v", tc.err, err)
@@ -47,3 +66,85 @@ func TestDynamoDBSaver(t *testing.T) {
 		})
 	}
 }
+
+func TestDynamoDBSaver_Versioned(t *testing.T) {
+	conflict := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "condition failed", nil)
+	// a Person read back has its CreatedAt, so it is saved again with PutItem
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := map[string]struct {
+		person      *mypackage.Person
+		create      bool
+		err         error
+		wantCond    string
+		wantVersion int64
+		wantErr     error
+	}{
+		"new person": {
+			person:      &mypackage.Person{ID: "p1", Name: "Johnny"},
+			wantCond:    "attribute_not_exists(#key)",
+			wantVersion: 1,
+		},
+		"existing person": {
+			person:      &mypackage.Person{ID: "p1", Name: "Johnny", Version: 3, CreatedAt: created},
+			wantCond:    "#version = :version",
+			wantVersion: 4,
+		},
+		"version conflict": {
+			person:      &mypackage.Person{ID: "p1", Name: "Johnny", Version: 3, CreatedAt: created},
+			err:         conflict,
+			wantCond:    "#version = :version",
+			wantVersion: 3,
+			wantErr:     mypackage.ErrVersionConflict,
+		},
+		"create": {
+			person:      &mypackage.Person{ID: "p1", Name: "Johnny", Version: 7},
+			create:      true,
+			wantCond:    "attribute_not_exists(#key)",
+			wantVersion: 1,
+		},
+		"create existing person": {
+			person:   &mypackage.Person{ID: "p1", Name: "Johnny"},
+			create:   true,
+			err:      conflict,
+			wantCond: "attribute_not_exists(#key)",
+			wantErr:  mypackage.ErrAlreadyExists,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &testClient{output: &dynamodb.PutItemOutput{}, err: tc.err}
+			saver := &mypackage.DynamoDBSaver{Client: client, Table: table, Versioned: true}
+			stored := tc.person.Version
+
+			save := saver.Save
+			if tc.create {
+				save = saver.Create
+			}
+			if err := save(context.Background(), tc.person); !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v but got %v", tc.wantErr, err)
+			}
+
+			if cond := aws.StringValue(client.input.ConditionExpression); cond != tc.wantCond {
+				t.Errorf("expected condition %q but got %q", tc.wantCond, cond)
+			}
+			if tc.wantCond == "#version = :version" {
+				if v := aws.StringValue(client.input.ExpressionAttributeValues[":version"].N); v != fmt.Sprint(stored) {
+					t.Errorf("expected condition on version %d but got %s", stored, v)
+				}
+			}
+			if tc.wantErr == nil {
+				if v := aws.StringValue(client.input.Item["Version"].N); v != fmt.Sprint(tc.wantVersion) {
+					t.Errorf("expected stored version %d but got %s", tc.wantVersion, v)
+				}
+			}
+			if tc.person.Version != tc.wantVersion && tc.wantErr == nil {
+				t.Errorf("expected person at version %d but got %d", tc.wantVersion, tc.person.Version)
+			}
+			if tc.wantErr != nil && tc.person.Version != stored {
+				t.Errorf("expected version to stay %d after failure but got %d", stored, tc.person.Version)
+			}
+		})
+	}
+}
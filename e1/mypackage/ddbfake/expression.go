@@ -0,0 +1,948 @@
+package ddbfake
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota // attribute names, keywords, functions and list indexes
+	tokName                   // #name placeholder
+	tokValue                  // :value placeholder
+	tokPunct
+	tokEOF
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func tokenize(expr string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#' || c == ':':
+			j := i + 1
+			for j < len(expr) && isIdentByte(expr[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("invalid placeholder at position %d", i)
+			}
+			kind := tokName
+			if c == ':' {
+				kind = tokValue
+			}
+			toks = append(toks, token{kind: kind, text: expr[i:j], pos: i})
+			i = j
+		case isIdentByte(c):
+			j := i
+			for j < len(expr) && isIdentByte(expr[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: expr[i:j], pos: i})
+			i = j
+		case c == '<' || c == '>':
+			n := 1
+			if i+1 < len(expr) && (expr[i+1] == '=' || (c == '<' && expr[i+1] == '>')) {
+				n = 2
+			}
+			toks = append(toks, token{kind: tokPunct, text: expr[i : i+n], pos: i})
+			i += n
+		case strings.IndexByte("=(),.[]+-", c) >= 0:
+			toks = append(toks, token{kind: tokPunct, text: expr[i : i+1], pos: i})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(expr)}), nil
+}
+
+// resolver substitutes placeholders and tracks which ones a request used,
+// since DynamoDB rejects requests with unused placeholders.
+type resolver struct {
+	names      map[string]*string
+	values     map[string]*dynamodb.AttributeValue
+	usedNames  map[string]bool
+	usedValues map[string]bool
+}
+
+func newResolver(names map[string]*string, values map[string]*dynamodb.AttributeValue) *resolver {
+	return &resolver{
+		names:      names,
+		values:     values,
+		usedNames:  make(map[string]bool),
+		usedValues: make(map[string]bool),
+	}
+}
+
+func (r *resolver) name(placeholder string) (string, error) {
+	name, ok := r.names[placeholder]
+	if !ok || name == nil {
+		return "", fmt.Errorf("an expression attribute name used in the document path is not defined; attribute name: %s", placeholder)
+	}
+	r.usedNames[placeholder] = true
+	return *name, nil
+}
+
+func (r *resolver) value(placeholder string) (*dynamodb.AttributeValue, error) {
+	v, ok := r.values[placeholder]
+	if !ok || typeOf(v) == "" {
+		return nil, fmt.Errorf("an expression attribute value used in expression is not defined; attribute value: %s", placeholder)
+	}
+	r.usedValues[placeholder] = true
+	return v, nil
+}
+
+func (r *resolver) checkUnused() error {
+	for placeholder := range r.names {
+		if !r.usedNames[placeholder] {
+			return fmt.Errorf("value provided in ExpressionAttributeNames unused in expressions: keys: {%s}", placeholder)
+		}
+	}
+	for placeholder := range r.values {
+		if !r.usedValues[placeholder] {
+			return fmt.Errorf("value provided in ExpressionAttributeValues unused in expressions: keys: {%s}", placeholder)
+		}
+	}
+	return nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+	r    *resolver
+}
+
+func newParser(expr string, r *resolver) (*parser, error) {
+	toks, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{toks: toks, r: r}, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) peekAt(n int) token {
+	if p.pos+n >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.pos+n]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokIdent && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) punct(s string) bool {
+	if t := p.peek(); t.kind == tokPunct && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.punct(s) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf("syntax error; unexpected end of expression")
+	}
+	return fmt.Errorf("syntax error; token: %q, near position %d", t.text, t.pos)
+}
+
+func (p *parser) end() error {
+	if p.peek().kind != tokEOF {
+		return p.unexpected()
+	}
+	return nil
+}
+
+// isCall reports whether the next tokens are a call to fn.
+func (p *parser) isCall(fn string) bool {
+	t := p.peek()
+	next := p.peekAt(1)
+	return t.kind == tokIdent && strings.EqualFold(t.text, fn) && next.kind == tokPunct && next.text == "("
+}
+
+// pathElem is a map key or, if index >= 0, a list index.
+type pathElem struct {
+	name  string
+	index int
+}
+
+type path []pathElem
+
+func (p path) String() string {
+	var b strings.Builder
+	for i, e := range p {
+		switch {
+		case e.index >= 0:
+			fmt.Fprintf(&b, "[%d]", e.index)
+		case i > 0:
+			b.WriteString("." + e.name)
+		default:
+			b.WriteString(e.name)
+		}
+	}
+	return b.String()
+}
+
+func (p *parser) pathName() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokIdent:
+		return t.text, nil
+	case tokName:
+		return p.r.name(t.text)
+	}
+	p.pos--
+	return "", p.unexpected()
+}
+
+func (p *parser) path() (path, error) {
+	name, err := p.pathName()
+	if err != nil {
+		return nil, err
+	}
+	result := path{{name: name, index: -1}}
+	for {
+		switch {
+		case p.punct("."):
+			name, err := p.pathName()
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, pathElem{name: name, index: -1})
+		case p.punct("["):
+			t := p.next()
+			index, err := strconv.Atoi(t.text)
+			if t.kind != tokIdent || err != nil || index < 0 {
+				p.pos--
+				return nil, p.unexpected()
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			result = append(result, pathElem{index: index})
+		default:
+			return result, nil
+		}
+	}
+}
+
+func (p path) get(it item) *dynamodb.AttributeValue {
+	cur := &dynamodb.AttributeValue{M: it}
+	for _, e := range p {
+		if e.index >= 0 {
+			if e.index >= len(cur.L) {
+				return nil
+			}
+			cur = cur.L[e.index]
+			continue
+		}
+		if cur.M == nil {
+			return nil
+		}
+		v, ok := cur.M[e.name]
+		if !ok {
+			return nil
+		}
+		cur = v
+	}
+	return cur
+}
+
+func (p path) set(it item, v *dynamodb.AttributeValue) error {
+	parent := path(p[:len(p)-1]).get(it)
+	last := p[len(p)-1]
+	switch {
+	case last.index >= 0 && typeOf(parent) == "L":
+		if last.index >= len(parent.L) {
+			parent.L = append(parent.L, v)
+		} else {
+			parent.L[last.index] = v
+		}
+		return nil
+	case last.index < 0 && typeOf(parent) == "M":
+		parent.M[last.name] = v
+		return nil
+	}
+	return fmt.Errorf("the document path provided in the update expression is invalid for update: %s", p)
+}
+
+func (p path) remove(it item) {
+	parent := path(p[:len(p)-1]).get(it)
+	last := p[len(p)-1]
+	switch {
+	case last.index >= 0 && typeOf(parent) == "L":
+		if last.index < len(parent.L) {
+			parent.L = append(parent.L[:last.index], parent.L[last.index+1:]...)
+		}
+	case last.index < 0 && typeOf(parent) == "M":
+		delete(parent.M, last.name)
+	}
+}
+
+// operand yields a value from an item, or nil if it doesn't exist.
+type operand interface {
+	eval(it item) *dynamodb.AttributeValue
+}
+
+type pathOperand path
+
+func (o pathOperand) eval(it item) *dynamodb.AttributeValue {
+	return path(o).get(it)
+}
+
+type valueOperand struct {
+	v *dynamodb.AttributeValue
+}
+
+func (o valueOperand) eval(it item) *dynamodb.AttributeValue {
+	return o.v
+}
+
+type sizeOperand path
+
+func (o sizeOperand) eval(it item) *dynamodb.AttributeValue {
+	n, ok := size(path(o).get(it))
+	if !ok {
+		return nil
+	}
+	return &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(n))}
+}
+
+func (p *parser) operand() (operand, error) {
+	if t := p.peek(); t.kind == tokValue {
+		p.pos++
+		v, err := p.r.value(t.text)
+		if err != nil {
+			return nil, err
+		}
+		return valueOperand{v: v}, nil
+	}
+	if p.isCall("size") {
+		p.pos += 2
+		pth, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		return sizeOperand(pth), p.expect(")")
+	}
+	pth, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+	return pathOperand(pth), nil
+}
+
+// condition is a parsed condition, key condition or filter expression.
+type condition interface {
+	eval(it item) bool
+}
+
+type andCondition struct{ left, right condition }
+
+func (c andCondition) eval(it item) bool { return c.left.eval(it) && c.right.eval(it) }
+
+type orCondition struct{ left, right condition }
+
+func (c orCondition) eval(it item) bool { return c.left.eval(it) || c.right.eval(it) }
+
+type notCondition struct{ c condition }
+
+func (c notCondition) eval(it item) bool { return !c.c.eval(it) }
+
+type comparison struct {
+	op          string
+	left, right operand
+}
+
+func (c comparison) eval(it item) bool {
+	a, b := c.left.eval(it), c.right.eval(it)
+	if c.op == "<>" {
+		return !equal(a, b)
+	}
+	if c.op == "=" {
+		return equal(a, b)
+	}
+	cmp, ok := compare(a, b)
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+type between struct {
+	v, lo, hi operand
+}
+
+func (c between) eval(it item) bool {
+	v := c.v.eval(it)
+	lo, ok := compare(v, c.lo.eval(it))
+	if !ok || lo < 0 {
+		return false
+	}
+	hi, ok := compare(v, c.hi.eval(it))
+	return ok && hi <= 0
+}
+
+type in struct {
+	v    operand
+	list []operand
+}
+
+func (c in) eval(it item) bool {
+	v := c.v.eval(it)
+	for _, o := range c.list {
+		if equal(v, o.eval(it)) {
+			return true
+		}
+	}
+	return false
+}
+
+// function is one of the boolean condition functions.
+type function struct {
+	name string
+	path path
+	arg  operand
+}
+
+func (c function) eval(it item) bool {
+	v := c.path.get(it)
+	switch c.name {
+	case "attribute_exists":
+		return v != nil
+	case "attribute_not_exists":
+		return v == nil
+	case "attribute_type":
+		t := c.arg.eval(it)
+		return v != nil && t.S != nil && typeOf(v) == *t.S
+	case "begins_with":
+		prefix := c.arg.eval(it)
+		switch {
+		case typeOf(v) == "S" && typeOf(prefix) == "S":
+			return strings.HasPrefix(*v.S, *prefix.S)
+		case typeOf(v) == "B" && typeOf(prefix) == "B":
+			return len(prefix.B) <= len(v.B) && string(v.B[:len(prefix.B)]) == string(prefix.B)
+		}
+		return false
+	case "contains":
+		elem := c.arg.eval(it)
+		switch typeOf(v) {
+		case "S":
+			return typeOf(elem) == "S" && strings.Contains(*v.S, *elem.S)
+		case "SS", "NS", "BS":
+			return containsElem(setElems(v), elem)
+		case "L":
+			return containsElem(v.L, elem)
+		}
+		return false
+	}
+	return false
+}
+
+var functionArgs = map[string]int{
+	"attribute_exists":     1,
+	"attribute_not_exists": 1,
+	"attribute_type":       2,
+	"begins_with":          2,
+	"contains":             2,
+}
+
+// parseCondition parses a complete condition expression.
+func parseCondition(expr string, r *resolver) (condition, error) {
+	p, err := newParser(expr, r)
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	return c, p.end()
+}
+
+func (p *parser) or() (condition, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orCondition{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (condition, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = andCondition{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) not() (condition, error) {
+	if p.keyword("NOT") {
+		c, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return notCondition{c: c}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (condition, error) {
+	if p.punct("(") {
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(")")
+	}
+
+	for name, args := range functionArgs {
+		if !p.isCall(name) {
+			continue
+		}
+		p.pos += 2
+		pth, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		fn := function{name: name, path: pth}
+		if args == 2 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			if fn.arg, err = p.operand(); err != nil {
+				return nil, err
+			}
+		}
+		return fn, p.expect(")")
+	}
+
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tokPunct {
+		switch t.text {
+		case "=", "<>", "<", "<=", ">", ">=":
+			p.pos++
+			right, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			return comparison{op: t.text, left: left, right: right}, nil
+		}
+	}
+
+	if p.keyword("BETWEEN") {
+		lo, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("AND") {
+			return nil, p.unexpected()
+		}
+		hi, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return between{v: left, lo: lo, hi: hi}, nil
+	}
+
+	if p.keyword("IN") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		c := in{v: left}
+		for {
+			o, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			c.list = append(c.list, o)
+			if !p.punct(",") {
+				break
+			}
+		}
+		return c, p.expect(")")
+	}
+
+	return nil, p.unexpected()
+}
+
+// update is a parsed update expression.
+type update struct {
+	set    []setAction
+	remove []path
+	add    []valueAction
+	delete []valueAction
+}
+
+type setAction struct {
+	path  path
+	value setValue
+}
+
+type valueAction struct {
+	path  path
+	value operand
+}
+
+// touches reports whether any action changes the top-level attribute name.
+func (u *update) touches(name string) bool {
+	var paths []path
+	for _, a := range u.set {
+		paths = append(paths, a.path)
+	}
+	paths = append(paths, u.remove...)
+	for _, a := range append(u.add, u.delete...) {
+		paths = append(paths, a.path)
+	}
+	for _, p := range paths {
+		if p[0].name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setValue is the right-hand side of a SET action.
+type setValue interface {
+	eval(it item) (*dynamodb.AttributeValue, error)
+}
+
+type plainValue struct{ o operand }
+
+func (v plainValue) eval(it item) (*dynamodb.AttributeValue, error) {
+	res := v.o.eval(it)
+	if res == nil {
+		return nil, fmt.Errorf("the provided expression refers to an attribute that does not exist in the item")
+	}
+	return res, nil
+}
+
+type arithmetic struct {
+	op          string
+	left, right setValue
+}
+
+func (v arithmetic) eval(it item) (*dynamodb.AttributeValue, error) {
+	a, err := v.left.eval(it)
+	if err != nil {
+		return nil, err
+	}
+	b, err := v.right.eval(it)
+	if err != nil {
+		return nil, err
+	}
+	if typeOf(a) != "N" || typeOf(b) != "N" {
+		return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+	}
+	x, err := parseNumber(*a.N)
+	if err != nil {
+		return nil, err
+	}
+	y, err := parseNumber(*b.N)
+	if err != nil {
+		return nil, err
+	}
+	if v.op == "-" {
+		y.Neg(y)
+	}
+	return &dynamodb.AttributeValue{N: aws.String(formatNumber(x.Add(x, y)))}, nil
+}
+
+type ifNotExists struct {
+	path     path
+	fallback setValue
+}
+
+func (v ifNotExists) eval(it item) (*dynamodb.AttributeValue, error) {
+	if existing := v.path.get(it); existing != nil {
+		return existing, nil
+	}
+	return v.fallback.eval(it)
+}
+
+type listAppend struct {
+	left, right setValue
+}
+
+func (v listAppend) eval(it item) (*dynamodb.AttributeValue, error) {
+	a, err := v.left.eval(it)
+	if err != nil {
+		return nil, err
+	}
+	b, err := v.right.eval(it)
+	if err != nil {
+		return nil, err
+	}
+	if typeOf(a) != "L" || typeOf(b) != "L" {
+		return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+	}
+	l := make([]*dynamodb.AttributeValue, 0, len(a.L)+len(b.L))
+	return &dynamodb.AttributeValue{L: append(append(l, a.L...), b.L...)}, nil
+}
+
+// parseUpdate parses a complete update expression.
+func parseUpdate(expr string, r *resolver) (*update, error) {
+	p, err := newParser(expr, r)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &update{}
+	seen := make(map[string]bool)
+	for p.peek().kind != tokEOF {
+		t := p.next()
+		clause := strings.ToUpper(t.text)
+		if t.kind != tokIdent || seen[clause] {
+			p.pos--
+			return nil, p.unexpected()
+		}
+		seen[clause] = true
+
+		for {
+			pth, err := p.path()
+			if err != nil {
+				return nil, err
+			}
+			switch clause {
+			case "SET":
+				if err := p.expect("="); err != nil {
+					return nil, err
+				}
+				v, err := p.setValue()
+				if err != nil {
+					return nil, err
+				}
+				u.set = append(u.set, setAction{path: pth, value: v})
+			case "REMOVE":
+				u.remove = append(u.remove, pth)
+			case "ADD", "DELETE":
+				v, err := p.operand()
+				if err != nil {
+					return nil, err
+				}
+				action := valueAction{path: pth, value: v}
+				if clause == "ADD" {
+					u.add = append(u.add, action)
+				} else {
+					u.delete = append(u.delete, action)
+				}
+			default:
+				return nil, fmt.Errorf("syntax error; token: %q, near position %d", t.text, t.pos)
+			}
+			if !p.punct(",") {
+				break
+			}
+		}
+	}
+	if len(seen) == 0 {
+		return nil, fmt.Errorf("update expression must not be empty")
+	}
+	return u, nil
+}
+
+func (p *parser) setValue() (setValue, error) {
+	left, err := p.setTerm()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"+", "-"} {
+		if p.punct(op) {
+			right, err := p.setTerm()
+			if err != nil {
+				return nil, err
+			}
+			return arithmetic{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) setTerm() (setValue, error) {
+	switch {
+	case p.isCall("if_not_exists"):
+		p.pos += 2
+		pth, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		fallback, err := p.setValue()
+		if err != nil {
+			return nil, err
+		}
+		return ifNotExists{path: pth, fallback: fallback}, p.expect(")")
+	case p.isCall("list_append"):
+		p.pos += 2
+		left, err := p.setValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		right, err := p.setValue()
+		if err != nil {
+			return nil, err
+		}
+		return listAppend{left: left, right: right}, p.expect(")")
+	}
+	o, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return plainValue{o: o}, nil
+}
+
+// apply returns a copy of it with the update applied, and the top-level attributes it touched.
+// Every value is computed from the item as it was before the update, as DynamoDB does.
+func (u *update) apply(it item) (item, map[string]bool, error) {
+	next := copyItem(it)
+	if next == nil {
+		next = item{}
+	}
+	touched := make(map[string]bool)
+
+	for _, a := range u.set {
+		v, err := a.value.eval(it)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := a.path.set(next, copyValue(v)); err != nil {
+			return nil, nil, err
+		}
+		touched[a.path[0].name] = true
+	}
+
+	for _, pth := range u.remove {
+		pth.remove(next)
+		touched[pth[0].name] = true
+	}
+
+	for _, a := range u.add {
+		v := a.value.eval(it)
+		existing := a.path.get(it)
+		var res *dynamodb.AttributeValue
+		switch {
+		case existing == nil && (typeOf(v) == "N" || isSet(v)):
+			res = copyValue(v)
+		case typeOf(existing) == "N" && typeOf(v) == "N":
+			var err error
+			res, err = arithmetic{op: "+", left: plainValue{valueOperand{existing}}, right: plainValue{valueOperand{v}}}.eval(it)
+			if err != nil {
+				return nil, nil, err
+			}
+		case typeOf(existing) == typeOf(v) && isSet(v):
+			elems := setElems(existing)
+			for _, e := range setElems(v) {
+				if !containsElem(elems, e) {
+					elems = append(elems, e)
+				}
+			}
+			res = makeSet(typeOf(v), elems)
+		default:
+			return nil, nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+		}
+		if err := a.path.set(next, res); err != nil {
+			return nil, nil, err
+		}
+		touched[a.path[0].name] = true
+	}
+
+	for _, a := range u.delete {
+		v := a.value.eval(it)
+		existing := a.path.get(it)
+		if existing == nil {
+			continue
+		}
+		if typeOf(existing) != typeOf(v) || !isSet(v) {
+			return nil, nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+		}
+		var elems []*dynamodb.AttributeValue
+		remove := setElems(v)
+		for _, e := range setElems(existing) {
+			if !containsElem(remove, e) {
+				elems = append(elems, e)
+			}
+		}
+		if len(elems) == 0 {
+			a.path.remove(next)
+		} else if err := a.path.set(next, makeSet(typeOf(v), elems)); err != nil {
+			return nil, nil, err
+		}
+		touched[a.path[0].name] = true
+	}
+
+	return next, touched, nil
+}
@@ -0,0 +1,198 @@
+package ddbfake_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/idiomat/dodtnyt/e1/mypackage/ddbfake"
+)
+
+func s(v string) *dynamodb.AttributeValue { return &dynamodb.AttributeValue{S: aws.String(v)} }
+func n(v string) *dynamodb.AttributeValue { return &dynamodb.AttributeValue{N: aws.String(v)} }
+
+// person is the item every expression test starts from.
+func person() map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"ID":      s("p1"),
+		"Name":    s("Johnny"),
+		"Age":     n("42"),
+		"Tags":    {SS: aws.StringSlice([]string{"admin", "dev"})},
+		"Aliases": {L: []*dynamodb.AttributeValue{s("J"), s("Jo")}},
+		"Address": {M: map[string]*dynamodb.AttributeValue{"City": s("Lisbon")}},
+	}
+}
+
+func newFake(t *testing.T) *ddbfake.Fake {
+	t.Helper()
+	fake := ddbfake.New()
+	if err := fake.CreateTable("people", "ID", ""); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if _, err := fake.PutItemWithContext(context.Background(), &dynamodb.PutItemInput{TableName: aws.String("people"), Item: person()}); err != nil {
+		t.Fatalf("PutItem() error = %v", err)
+	}
+	return fake
+}
+
+func errCode(err error) string {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code()
+	}
+	return ""
+}
+
+func TestConditionExpression(t *testing.T) {
+	tests := map[string]struct {
+		expr      string
+		names     map[string]*string
+		values    map[string]*dynamodb.AttributeValue
+		want      bool
+		wantValid string // the error code for invalid expressions
+	}{
+		"equal":               {expr: "#n = :v", names: map[string]*string{"#n": aws.String("Name")}, values: map[string]*dynamodb.AttributeValue{":v": s("Johnny")}, want: true},
+		"not equal":           {expr: "Age <> :v", values: map[string]*dynamodb.AttributeValue{":v": n("42")}},
+		"numbers compare":     {expr: "Age > :v", values: map[string]*dynamodb.AttributeValue{":v": n("9")}, want: true},
+		"types don't order":   {expr: "Age > :v", values: map[string]*dynamodb.AttributeValue{":v": s("9")}},
+		"missing not equal":   {expr: "Nope <> :v", values: map[string]*dynamodb.AttributeValue{":v": s("x")}, want: true},
+		"between":             {expr: "Age BETWEEN :lo AND :hi", values: map[string]*dynamodb.AttributeValue{":lo": n("40"), ":hi": n("42.0")}, want: true},
+		"in":                  {expr: "Name IN (:a, :b)", values: map[string]*dynamodb.AttributeValue{":a": s("Jane"), ":b": s("Johnny")}, want: true},
+		"exists":              {expr: "attribute_exists(ID) AND attribute_not_exists(Nope)", want: true},
+		"not":                 {expr: "NOT attribute_exists(ID)"},
+		"or with parens":      {expr: "(Age < :v OR begins_with(Name, :p)) AND NOT contains(Tags, :t)", values: map[string]*dynamodb.AttributeValue{":v": n("1"), ":p": s("Jo"), ":t": s("ops")}, want: true},
+		"contains set":        {expr: "contains(Tags, :t)", values: map[string]*dynamodb.AttributeValue{":t": s("dev")}, want: true},
+		"contains list":       {expr: "contains(Aliases, :t)", values: map[string]*dynamodb.AttributeValue{":t": s("Jo")}, want: true},
+		"nested paths":        {expr: "Address.City = :c AND Aliases[1] = :a", values: map[string]*dynamodb.AttributeValue{":c": s("Lisbon"), ":a": s("Jo")}, want: true},
+		"size":                {expr: "size(Tags) = :two AND size(Name) > :two", values: map[string]*dynamodb.AttributeValue{":two": n("2")}, want: true},
+		"attribute type":      {expr: "attribute_type(Age, :t)", values: map[string]*dynamodb.AttributeValue{":t": s("N")}, want: true},
+		"undefined value":     {expr: "Age = :nope", wantValid: ddbfake.ErrCodeValidationException},
+		"unused value":        {expr: "attribute_exists(ID)", values: map[string]*dynamodb.AttributeValue{":v": n("1")}, wantValid: ddbfake.ErrCodeValidationException},
+		"unused name":         {expr: "attribute_exists(ID)", names: map[string]*string{"#n": aws.String("Name")}, wantValid: ddbfake.ErrCodeValidationException},
+		"syntax error":        {expr: "Age = = :v", values: map[string]*dynamodb.AttributeValue{":v": n("1")}, wantValid: ddbfake.ErrCodeValidationException},
+		"missing parenthesis": {expr: "attribute_exists(ID", wantValid: ddbfake.ErrCodeValidationException},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake := newFake(t)
+
+			_, err := fake.PutItemWithContext(context.Background(), &dynamodb.PutItemInput{
+				TableName:                 aws.String("people"),
+				Item:                      person(),
+				ConditionExpression:       aws.String(tc.expr),
+				ExpressionAttributeNames:  tc.names,
+				ExpressionAttributeValues: tc.values,
+			})
+
+			switch {
+			case tc.wantValid != "":
+				if errCode(err) != tc.wantValid {
+					t.Errorf("PutItem() error = %v, want %s", err, tc.wantValid)
+				}
+			case tc.want && err != nil:
+				t.Errorf("PutItem() error = %v, want condition to hold", err)
+			case !tc.want && errCode(err) != dynamodb.ErrCodeConditionalCheckFailedException:
+				t.Errorf("PutItem() error = %v, want condition to fail", err)
+			}
+		})
+	}
+}
+
+func TestUpdateExpression(t *testing.T) {
+	tests := map[string]struct {
+		expr    string
+		values  map[string]*dynamodb.AttributeValue
+		want    map[string]*dynamodb.AttributeValue // attributes expected after the update
+		gone    []string                            // attributes expected to be removed
+		wantErr bool
+	}{
+		"set": {
+			expr:   "SET Name = :n, Address.City = :c",
+			values: map[string]*dynamodb.AttributeValue{":n": s("John"), ":c": s("Porto")},
+			want:   map[string]*dynamodb.AttributeValue{"Name": s("John"), "Address": {M: map[string]*dynamodb.AttributeValue{"City": s("Porto")}}},
+		},
+		"arithmetic": {
+			expr:   "SET Age = Age + :one, Score = if_not_exists(Score, :zero) - :half",
+			values: map[string]*dynamodb.AttributeValue{":one": n("1"), ":zero": n("0"), ":half": n("0.5")},
+			want:   map[string]*dynamodb.AttributeValue{"Age": n("43"), "Score": n("-0.5")},
+		},
+		"list append": {
+			expr:   "SET Aliases = list_append(Aliases, :more)",
+			values: map[string]*dynamodb.AttributeValue{":more": {L: []*dynamodb.AttributeValue{s("JJ")}}},
+			want:   map[string]*dynamodb.AttributeValue{"Aliases": {L: []*dynamodb.AttributeValue{s("J"), s("Jo"), s("JJ")}}},
+		},
+		"remove": {
+			expr: "REMOVE Address, Aliases[0]",
+			want: map[string]*dynamodb.AttributeValue{"Aliases": {L: []*dynamodb.AttributeValue{s("Jo")}}},
+			gone: []string{"Address"},
+		},
+		"add and delete": {
+			expr:   "ADD Age :one, Visits :one DELETE Tags :admin",
+			values: map[string]*dynamodb.AttributeValue{":one": n("1"), ":admin": {SS: aws.StringSlice([]string{"admin"})}},
+			want:   map[string]*dynamodb.AttributeValue{"Age": n("43"), "Visits": n("1"), "Tags": {SS: aws.StringSlice([]string{"dev"})}},
+		},
+		"add to set": {
+			expr:   "ADD Tags :ops",
+			values: map[string]*dynamodb.AttributeValue{":ops": {SS: aws.StringSlice([]string{"ops", "dev"})}},
+			want:   map[string]*dynamodb.AttributeValue{"Tags": {SS: aws.StringSlice([]string{"admin", "dev", "ops"})}},
+		},
+		"key can't change": {
+			expr:    "SET ID = :id",
+			values:  map[string]*dynamodb.AttributeValue{":id": s("p2")},
+			wantErr: true,
+		},
+		"wrong type": {
+			expr:    "SET Name = Name + :one",
+			values:  map[string]*dynamodb.AttributeValue{":one": n("1")},
+			wantErr: true,
+		},
+		"missing operand": {
+			expr:    "SET Name = Nope",
+			wantErr: true,
+		},
+		"repeated clause": {
+			expr:    "SET Name = :n SET Age = :n",
+			values:  map[string]*dynamodb.AttributeValue{":n": s("x")},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake := newFake(t)
+
+			output, err := fake.UpdateItemWithContext(context.Background(), &dynamodb.UpdateItemInput{
+				TableName:                 aws.String("people"),
+				Key:                       map[string]*dynamodb.AttributeValue{"ID": s("p1")},
+				UpdateExpression:          aws.String(tc.expr),
+				ExpressionAttributeValues: tc.values,
+				ReturnValues:              aws.String(dynamodb.ReturnValueAllNew),
+			})
+			if tc.wantErr {
+				if errCode(err) != ddbfake.ErrCodeValidationException {
+					t.Errorf("UpdateItem() error = %v, want %s", err, ddbfake.ErrCodeValidationException)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateItem() error = %v", err)
+			}
+
+			for attr, want := range tc.want {
+				if got := output.Attributes[attr]; !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %v, want %v", attr, got, want)
+				}
+			}
+			for _, attr := range tc.gone {
+				if got, ok := output.Attributes[attr]; ok {
+					t.Errorf("%s = %v, want it removed", attr, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,943 @@
+// Package ddbfake is an in-memory stand-in for DynamoDB, so code built on the SDK
+// can be tested for real without a network.
+//
+// It evaluates condition, key-condition, filter and update expressions with
+// DynamoDB's semantics, including its rejection of unused placeholders.
+// Secondary indexes, projection expressions, reserved words and size limits
+// are not supported.
+package ddbfake
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ErrCodeValidationException is the code of errors for requests DynamoDB would reject.
+const ErrCodeValidationException = "ValidationException"
+
+const (
+	maxBatchWriteItems = 25
+	maxBatchGetKeys    = 100
+	maxTransactItems   = 100
+)
+
+// Fake is an in-memory DynamoDB. It is safe for concurrent use.
+type Fake struct {
+	// Hook, if set, is called before every operation with its name, e.g. "PutItem", and its input.
+	// A non-nil error is returned in place of performing the operation, to simulate failures.
+	Hook func(op string, input interface{}) error
+	// Unprocessed, if set, decides which BatchWriteItem requests are returned
+	// as unprocessed rather than applied, to simulate throttling.
+	Unprocessed func(table string, req *dynamodb.WriteRequest) bool
+
+	mu     sync.Mutex
+	tables map[string]*table
+}
+
+// New returns a Fake without any tables.
+func New() *Fake {
+	return &Fake{tables: make(map[string]*table)}
+}
+
+// CreateTable adds an empty table keyed on partitionKey and, unless it is empty, sortKey.
+func (f *Fake) CreateTable(name, partitionKey, sortKey string) error {
+	if name == "" || partitionKey == "" {
+		return validationError("table name and partition key are required")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.tables[name]; ok {
+		return &dynamodb.ResourceInUseException{Message_: aws.String("Table already exists: " + name)}
+	}
+	f.tables[name] = &table{
+		partitionKey: partitionKey,
+		sortKey:      sortKey,
+		items:        make(map[string]item),
+	}
+	return nil
+}
+
+// Items returns a copy of every item in the named table, in key order.
+func (f *Fake) Items(name string) ([]map[string]*dynamodb.AttributeValue, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, err := f.table(aws.String(name))
+	if err != nil {
+		return nil, err
+	}
+	var items []map[string]*dynamodb.AttributeValue
+	for _, it := range t.sorted() {
+		items = append(items, copyItem(it))
+	}
+	return items, nil
+}
+
+func validationError(format string, args ...interface{}) error {
+	return awserr.New(ErrCodeValidationException, fmt.Sprintf(format, args...), nil)
+}
+
+func (f *Fake) before(ctx context.Context, op string, input interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return awserr.New(request.CanceledErrorCode, "request context canceled", err)
+	}
+	if f.Hook != nil {
+		return f.Hook(op, input)
+	}
+	return nil
+}
+
+func (f *Fake) table(name *string) (*table, error) {
+	t, ok := f.tables[aws.StringValue(name)]
+	if !ok {
+		return nil, &dynamodb.ResourceNotFoundException{Message_: aws.String("Requested resource not found")}
+	}
+	return t, nil
+}
+
+type table struct {
+	partitionKey string
+	sortKey      string
+	items        map[string]item
+}
+
+func (t *table) keyAttrs() []string {
+	if t.sortKey == "" {
+		return []string{t.partitionKey}
+	}
+	return []string{t.partitionKey, t.sortKey}
+}
+
+// keyString identifies the item with the given key attributes.
+func (t *table) keyString(it item) (string, error) {
+	var b strings.Builder
+	for _, attr := range t.keyAttrs() {
+		v := it[attr]
+		switch typeOf(v) {
+		case "S":
+			fmt.Fprintf(&b, "S%d:%s", len(*v.S), *v.S)
+		case "N":
+			n, err := parseNumber(*v.N)
+			if err != nil {
+				return "", validationError("%s", err)
+			}
+			fmt.Fprintf(&b, "N:%s;", formatNumber(n))
+		case "B":
+			fmt.Fprintf(&b, "B%d:%x", len(v.B), v.B)
+		case "":
+			return "", validationError("One of the required keys was not given a value: %s", attr)
+		default:
+			return "", validationError("The provided key element does not match the schema: %s", attr)
+		}
+	}
+	return b.String(), nil
+}
+
+// key validates a request's Key, which must hold exactly the key attributes.
+func (t *table) key(key item) (string, error) {
+	if len(key) != len(t.keyAttrs()) {
+		return "", validationError("The provided key element does not match the schema")
+	}
+	return t.keyString(key)
+}
+
+func (t *table) keyOf(it item) item {
+	key := make(item, 2)
+	for _, attr := range t.keyAttrs() {
+		key[attr] = copyValue(it[attr])
+	}
+	return key
+}
+
+// less orders items by partition and then by sort key.
+func (t *table) less(a, b item) bool {
+	for _, attr := range t.keyAttrs() {
+		x, y := a[attr], b[attr]
+		if tx, ty := typeOf(x), typeOf(y); tx != ty {
+			return tx < ty
+		}
+		if c, _ := compare(x, y); c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
+
+func (t *table) sorted() []item {
+	items := make([]item, 0, len(t.items))
+	for _, it := range t.items {
+		items = append(items, it)
+	}
+	sort.Slice(items, func(i, j int) bool { return t.less(items[i], items[j]) })
+	return items
+}
+
+func (t *table) segment(it item, total int64) int64 {
+	p, _ := t.keyString(item{t.partitionKey: it[t.partitionKey]})
+	h := fnv.New32a()
+	h.Write([]byte(p))
+	return int64(h.Sum32()) % total
+}
+
+func validateValue(v *dynamodb.AttributeValue) error {
+	switch typeOf(v) {
+	case "":
+		return validationError("Supplied AttributeValue is empty, must contain exactly one of the supported datatypes")
+	case "N":
+		if _, err := parseNumber(*v.N); err != nil {
+			return validationError("%s", err)
+		}
+	case "NS":
+		for _, n := range v.NS {
+			if _, err := parseNumber(aws.StringValue(n)); err != nil {
+				return validationError("%s", err)
+			}
+		}
+	case "L":
+		for _, e := range v.L {
+			if err := validateValue(e); err != nil {
+				return err
+			}
+		}
+	case "M":
+		for _, e := range v.M {
+			if err := validateValue(e); err != nil {
+				return err
+			}
+		}
+	}
+	if isSet(v) && len(setElems(v)) == 0 {
+		return validationError("A set may not be empty")
+	}
+	return nil
+}
+
+func validateItem(it item) error {
+	for _, v := range it {
+		if err := validateValue(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write is a validated put, update, delete or condition check on one item.
+type write struct {
+	table *table
+	key   string
+	cond  condition
+	// apply returns the item's new state from its current one, or nil to delete it.
+	apply func(old item) (item, error)
+	// returnOnFailure holds the item in the error when the condition fails.
+	returnOnFailure bool
+}
+
+func (w *write) conditionHolds() bool {
+	return w.cond == nil || w.cond.eval(w.table.items[w.key])
+}
+
+func (w *write) conditionFailed() error {
+	err := &dynamodb.ConditionalCheckFailedException{Message_: aws.String("The conditional request failed")}
+	if old := w.table.items[w.key]; w.returnOnFailure && old != nil {
+		err.Item = copyItem(old)
+	}
+	return err
+}
+
+// commit applies the write and returns the item before and after it.
+func (w *write) commit() (old, next item, err error) {
+	old = w.table.items[w.key]
+	if next, err = w.apply(old); err != nil {
+		return nil, nil, err
+	}
+	if next == nil {
+		delete(w.table.items, w.key)
+	} else {
+		w.table.items[w.key] = next
+	}
+	return old, next, nil
+}
+
+// parseOptionalCondition parses a condition expression if the request has one.
+func parseOptionalCondition(expr *string, r *resolver) (condition, error) {
+	if expr == nil {
+		return nil, nil
+	}
+	c, err := parseCondition(*expr, r)
+	if err != nil {
+		return nil, validationError("Invalid ConditionExpression: %s", err)
+	}
+	return c, nil
+}
+
+func returnOnFailure(v *string) bool {
+	return aws.StringValue(v) == dynamodb.ReturnValuesOnConditionCheckFailureAllOld
+}
+
+func (f *Fake) preparePut(tableName *string, it item, condExpr *string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (*write, error) {
+	t, err := f.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.keyString(it)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateItem(it); err != nil {
+		return nil, err
+	}
+
+	r := newResolver(names, values)
+	cond, err := parseOptionalCondition(condExpr, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkUnused(); err != nil {
+		return nil, validationError("%s", err)
+	}
+
+	next := copyItem(it)
+	return &write{
+		table: t,
+		key:   key,
+		cond:  cond,
+		apply: func(item) (item, error) { return next, nil },
+	}, nil
+}
+
+func (f *Fake) prepareUpdate(tableName *string, key item, updateExpr, condExpr *string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (*write, error) {
+	t, err := f.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	k, err := t.key(key)
+	if err != nil {
+		return nil, err
+	}
+	if updateExpr == nil {
+		return nil, validationError("UpdateExpression is required")
+	}
+
+	r := newResolver(names, values)
+	u, err := parseUpdate(*updateExpr, r)
+	if err != nil {
+		return nil, validationError("Invalid UpdateExpression: %s", err)
+	}
+	cond, err := parseOptionalCondition(condExpr, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkUnused(); err != nil {
+		return nil, validationError("%s", err)
+	}
+	for _, attr := range t.keyAttrs() {
+		if u.touches(attr) {
+			return nil, validationError("Cannot update attribute %s. This attribute is part of the key", attr)
+		}
+	}
+
+	return &write{
+		table: t,
+		key:   k,
+		cond:  cond,
+		apply: func(old item) (item, error) {
+			if old == nil {
+				old = t.keyOf(key)
+			}
+			next, _, err := u.apply(old)
+			if err != nil {
+				return nil, validationError("%s", err)
+			}
+			if err := validateItem(next); err != nil {
+				return nil, err
+			}
+			return next, nil
+		},
+	}, nil
+}
+
+func (f *Fake) prepareDelete(tableName *string, key item, condExpr *string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (*write, error) {
+	t, err := f.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	k, err := t.key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	r := newResolver(names, values)
+	cond, err := parseOptionalCondition(condExpr, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkUnused(); err != nil {
+		return nil, validationError("%s", err)
+	}
+
+	return &write{
+		table: t,
+		key:   k,
+		cond:  cond,
+		apply: func(item) (item, error) { return nil, nil },
+	}, nil
+}
+
+// PutItemWithContext creates or replaces an item.
+func (f *Fake) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	if err := f.before(ctx, "PutItem", input); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w, err := f.preparePut(input.TableName, input.Item, input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	w.returnOnFailure = returnOnFailure(input.ReturnValuesOnConditionCheckFailure)
+	if !w.conditionHolds() {
+		return nil, w.conditionFailed()
+	}
+	old, _, err := w.commit()
+	if err != nil {
+		return nil, err
+	}
+
+	output := &dynamodb.PutItemOutput{}
+	switch rv := aws.StringValue(input.ReturnValues); rv {
+	case "", dynamodb.ReturnValueNone:
+	case dynamodb.ReturnValueAllOld:
+		output.Attributes = copyItem(old)
+	default:
+		return nil, validationError("ReturnValues %s is not valid for PutItem", rv)
+	}
+	return output, nil
+}
+
+// GetItemWithContext returns an item by key, or an output without Item if there is none.
+func (f *Fake) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	if err := f.before(ctx, "GetItem", input); err != nil {
+		return nil, err
+	}
+	if input.ProjectionExpression != nil {
+		return nil, validationError("ddbfake: ProjectionExpression is not supported")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.key(input.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.GetItemOutput{Item: copyItem(t.items[key])}, nil
+}
+
+// UpdateItemWithContext modifies an item, creating it if it doesn't exist.
+func (f *Fake) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	if err := f.before(ctx, "UpdateItem", input); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w, err := f.prepareUpdate(input.TableName, input.Key, input.UpdateExpression, input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	w.returnOnFailure = returnOnFailure(input.ReturnValuesOnConditionCheckFailure)
+	if !w.conditionHolds() {
+		return nil, w.conditionFailed()
+	}
+	old, next, err := w.commit()
+	if err != nil {
+		return nil, err
+	}
+
+	output := &dynamodb.UpdateItemOutput{}
+	switch rv := aws.StringValue(input.ReturnValues); rv {
+	case "", dynamodb.ReturnValueNone:
+	case dynamodb.ReturnValueAllOld:
+		output.Attributes = copyItem(old)
+	case dynamodb.ReturnValueAllNew:
+		output.Attributes = copyItem(next)
+	case dynamodb.ReturnValueUpdatedOld, dynamodb.ReturnValueUpdatedNew:
+		from := next
+		if rv == dynamodb.ReturnValueUpdatedOld {
+			from = old
+		}
+		// only the attributes the update changed
+		output.Attributes = item{}
+		for name, v := range from {
+			if !equal(old[name], next[name]) {
+				output.Attributes[name] = copyValue(v)
+			}
+		}
+	default:
+		return nil, validationError("ReturnValues %s is not valid for UpdateItem", rv)
+	}
+	return output, nil
+}
+
+// DeleteItemWithContext removes an item. Deleting a missing item succeeds.
+func (f *Fake) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	if err := f.before(ctx, "DeleteItem", input); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w, err := f.prepareDelete(input.TableName, input.Key, input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	w.returnOnFailure = returnOnFailure(input.ReturnValuesOnConditionCheckFailure)
+	if !w.conditionHolds() {
+		return nil, w.conditionFailed()
+	}
+	old, _, err := w.commit()
+	if err != nil {
+		return nil, err
+	}
+
+	output := &dynamodb.DeleteItemOutput{}
+	switch rv := aws.StringValue(input.ReturnValues); rv {
+	case "", dynamodb.ReturnValueNone:
+	case dynamodb.ReturnValueAllOld:
+		output.Attributes = copyItem(old)
+	default:
+		return nil, validationError("ReturnValues %s is not valid for DeleteItem", rv)
+	}
+	return output, nil
+}
+
+// page holds the result of reading items in order, as Query and Scan do.
+type page struct {
+	items        []map[string]*dynamodb.AttributeValue
+	scanned      int64
+	lastKey      item
+	countOnly    bool
+	filter       condition
+	limit        int64
+	exclusiveKey item
+}
+
+// read evaluates up to limit items from candidates, which must be ordered by less,
+// starting after exclusiveKey, and keeps those matching the filter.
+func (p *page) read(t *table, candidates []item, less func(a, b item) bool) {
+	start := 0
+	if p.exclusiveKey != nil {
+		start = sort.Search(len(candidates), func(i int) bool { return less(p.exclusiveKey, candidates[i]) })
+	}
+	for i := start; i < len(candidates); i++ {
+		if p.limit > 0 && p.scanned == p.limit {
+			p.lastKey = t.keyOf(candidates[i-1])
+			return
+		}
+		p.scanned++
+		if p.filter != nil && !p.filter.eval(candidates[i]) {
+			continue
+		}
+		if !p.countOnly {
+			p.items = append(p.items, copyItem(candidates[i]))
+		}
+	}
+}
+
+func isPartitionEquality(c condition, pk string) bool {
+	switch c := c.(type) {
+	case comparison:
+		if c.op != "=" {
+			return false
+		}
+		for _, o := range []operand{c.left, c.right} {
+			if p, ok := o.(pathOperand); ok && len(p) == 1 && p[0].name == pk {
+				return true
+			}
+		}
+	case andCondition:
+		return isPartitionEquality(c.left, pk) || isPartitionEquality(c.right, pk)
+	}
+	return false
+}
+
+func (f *Fake) newPage(t *table, filterExpr *string, r *resolver, selectAttrs *string, limit *int64, exclusiveKey item) (*page, error) {
+	p := &page{limit: aws.Int64Value(limit), exclusiveKey: exclusiveKey}
+	if limit != nil && p.limit <= 0 {
+		return nil, validationError("Limit must be greater than or equal to 1")
+	}
+	if exclusiveKey != nil {
+		if _, err := t.key(exclusiveKey); err != nil {
+			return nil, validationError("The provided starting key is invalid")
+		}
+	}
+	switch s := aws.StringValue(selectAttrs); s {
+	case "", dynamodb.SelectAllAttributes:
+	case dynamodb.SelectCount:
+		p.countOnly = true
+	default:
+		return nil, validationError("ddbfake: Select %s is not supported", s)
+	}
+	if filterExpr != nil {
+		c, err := parseCondition(*filterExpr, r)
+		if err != nil {
+			return nil, validationError("Invalid FilterExpression: %s", err)
+		}
+		p.filter = c
+	}
+	if err := r.checkUnused(); err != nil {
+		return nil, validationError("%s", err)
+	}
+	return p, nil
+}
+
+// QueryWithContext returns the items of one partition matching the key condition, in sort key order.
+func (f *Fake) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	if err := f.before(ctx, "Query", input); err != nil {
+		return nil, err
+	}
+	if input.IndexName != nil {
+		return nil, validationError("ddbfake: secondary indexes are not supported")
+	}
+	if input.ProjectionExpression != nil {
+		return nil, validationError("ddbfake: ProjectionExpression is not supported")
+	}
+	if input.KeyConditionExpression == nil {
+		return nil, validationError("KeyConditionExpression is required")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	r := newResolver(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	keyCond, err := parseCondition(*input.KeyConditionExpression, r)
+	if err != nil {
+		return nil, validationError("Invalid KeyConditionExpression: %s", err)
+	}
+	if !isPartitionEquality(keyCond, t.partitionKey) {
+		return nil, validationError("Query condition missed key schema element: %s", t.partitionKey)
+	}
+	p, err := f.newPage(t, input.FilterExpression, r, input.Select, input.Limit, input.ExclusiveStartKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []item
+	for _, it := range t.sorted() {
+		if keyCond.eval(it) {
+			candidates = append(candidates, it)
+		}
+	}
+	less := t.less
+	if input.ScanIndexForward != nil && !*input.ScanIndexForward {
+		for i, j := 0, len(candidates)-1; i < j; i, j = i+1, j-1 {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		}
+		less = func(a, b item) bool { return t.less(b, a) }
+	}
+	p.read(t, candidates, less)
+
+	return &dynamodb.QueryOutput{
+		Items:            p.items,
+		Count:            aws.Int64(int64(len(p.items))),
+		ScannedCount:     aws.Int64(p.scanned),
+		LastEvaluatedKey: p.lastKey,
+	}, nil
+}
+
+// ScanWithContext returns every item, or those in one segment of a parallel scan, in key order.
+func (f *Fake) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	if err := f.before(ctx, "Scan", input); err != nil {
+		return nil, err
+	}
+	if input.IndexName != nil {
+		return nil, validationError("ddbfake: secondary indexes are not supported")
+	}
+	if input.ProjectionExpression != nil {
+		return nil, validationError("ddbfake: ProjectionExpression is not supported")
+	}
+
+	total := aws.Int64Value(input.TotalSegments)
+	segment := aws.Int64Value(input.Segment)
+	if (input.Segment == nil) != (input.TotalSegments == nil) {
+		return nil, validationError("Segment and TotalSegments must be provided together")
+	}
+	if input.TotalSegments != nil && (total < 1 || segment < 0 || segment >= total) {
+		return nil, validationError("Segment must be less than TotalSegments")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, err := f.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	r := newResolver(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	p, err := f.newPage(t, input.FilterExpression, r, input.Select, input.Limit, input.ExclusiveStartKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []item
+	for _, it := range t.sorted() {
+		if total == 0 || t.segment(it, total) == segment {
+			candidates = append(candidates, it)
+		}
+	}
+	p.read(t, candidates, t.less)
+
+	return &dynamodb.ScanOutput{
+		Items:            p.items,
+		Count:            aws.Int64(int64(len(p.items))),
+		ScannedCount:     aws.Int64(p.scanned),
+		LastEvaluatedKey: p.lastKey,
+	}, nil
+}
+
+// BatchGetItemWithContext returns up to 100 items by key across tables.
+// It never leaves keys unprocessed.
+func (f *Fake) BatchGetItemWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	if err := f.before(ctx, "BatchGetItem", input); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	responses := make(map[string][]map[string]*dynamodb.AttributeValue)
+	count := 0
+	for name, ka := range input.RequestItems {
+		if ka == nil || len(ka.Keys) == 0 {
+			return nil, validationError("Keys must have at least 1 item")
+		}
+		if ka.ProjectionExpression != nil || ka.AttributesToGet != nil {
+			return nil, validationError("ddbfake: ProjectionExpression is not supported")
+		}
+		t, err := f.table(aws.String(name))
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, k := range ka.Keys {
+			count++
+			key, err := t.key(k)
+			if err != nil {
+				return nil, err
+			}
+			if seen[key] {
+				return nil, validationError("Provided list of item keys contains duplicates")
+			}
+			seen[key] = true
+			if it, ok := t.items[key]; ok {
+				responses[name] = append(responses[name], copyItem(it))
+			}
+		}
+	}
+	if count == 0 || count > maxBatchGetKeys {
+		return nil, validationError("Member must have length less than or equal to %d and at least 1", maxBatchGetKeys)
+	}
+	return &dynamodb.BatchGetItemOutput{
+		Responses:       responses,
+		UnprocessedKeys: map[string]*dynamodb.KeysAndAttributes{},
+	}, nil
+}
+
+// BatchWriteItemWithContext puts and deletes up to 25 items across tables.
+// Requests chosen by Unprocessed are returned in UnprocessedItems instead.
+func (f *Fake) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	if err := f.before(ctx, "BatchWriteItem", input); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var writes []*write
+	unprocessed := make(map[string][]*dynamodb.WriteRequest)
+	seen := make(map[*table]map[string]bool)
+	count := 0
+	for name, reqs := range input.RequestItems {
+		for _, req := range reqs {
+			count++
+			var (
+				w   *write
+				err error
+			)
+			switch {
+			case req.PutRequest != nil && req.DeleteRequest == nil:
+				w, err = f.preparePut(aws.String(name), req.PutRequest.Item, nil, nil, nil)
+			case req.DeleteRequest != nil && req.PutRequest == nil:
+				w, err = f.prepareDelete(aws.String(name), req.DeleteRequest.Key, nil, nil, nil)
+			default:
+				err = validationError("Supplied WriteRequest must contain exactly one of PutRequest or DeleteRequest")
+			}
+			if err != nil {
+				return nil, err
+			}
+			if seen[w.table] == nil {
+				seen[w.table] = make(map[string]bool)
+			}
+			if seen[w.table][w.key] {
+				return nil, validationError("Provided list of item keys contains duplicates")
+			}
+			seen[w.table][w.key] = true
+
+			if f.Unprocessed != nil && f.Unprocessed(name, req) {
+				unprocessed[name] = append(unprocessed[name], req)
+				continue
+			}
+			writes = append(writes, w)
+		}
+	}
+	if count == 0 || count > maxBatchWriteItems {
+		return nil, validationError("Member must have length less than or equal to %d and at least 1", maxBatchWriteItems)
+	}
+
+	for _, w := range writes {
+		if _, _, err := w.commit(); err != nil {
+			return nil, err
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{UnprocessedItems: unprocessed}, nil
+}
+
+// TransactWriteItemsWithContext applies up to 100 writes atomically: either every
+// condition holds and all of them are applied, or none is and the returned
+// *dynamodb.TransactionCanceledException gives the reason for each one.
+func (f *Fake) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	if err := f.before(ctx, "TransactWriteItems", input); err != nil {
+		return nil, err
+	}
+	if n := len(input.TransactItems); n == 0 || n > maxTransactItems {
+		return nil, validationError("Member must have length less than or equal to %d and at least 1", maxTransactItems)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	writes := make([]*write, len(input.TransactItems))
+	seen := make(map[*table]map[string]bool)
+	for i, ti := range input.TransactItems {
+		var (
+			w   *write
+			err error
+		)
+		switch {
+		case ti.Put != nil:
+			p := ti.Put
+			w, err = f.preparePut(p.TableName, p.Item, p.ConditionExpression, p.ExpressionAttributeNames, p.ExpressionAttributeValues)
+			if w != nil {
+				w.returnOnFailure = returnOnFailure(p.ReturnValuesOnConditionCheckFailure)
+			}
+		case ti.Update != nil:
+			u := ti.Update
+			w, err = f.prepareUpdate(u.TableName, u.Key, u.UpdateExpression, u.ConditionExpression, u.ExpressionAttributeNames, u.ExpressionAttributeValues)
+			if w != nil {
+				w.returnOnFailure = returnOnFailure(u.ReturnValuesOnConditionCheckFailure)
+			}
+		case ti.Delete != nil:
+			d := ti.Delete
+			w, err = f.prepareDelete(d.TableName, d.Key, d.ConditionExpression, d.ExpressionAttributeNames, d.ExpressionAttributeValues)
+			if w != nil {
+				w.returnOnFailure = returnOnFailure(d.ReturnValuesOnConditionCheckFailure)
+			}
+		case ti.ConditionCheck != nil:
+			c := ti.ConditionCheck
+			if c.ConditionExpression == nil {
+				return nil, validationError("ConditionCheck requires a ConditionExpression")
+			}
+			w, err = f.prepareDelete(c.TableName, c.Key, c.ConditionExpression, c.ExpressionAttributeNames, c.ExpressionAttributeValues)
+			if w != nil {
+				w.apply = func(old item) (item, error) { return old, nil }
+				w.returnOnFailure = returnOnFailure(c.ReturnValuesOnConditionCheckFailure)
+			}
+		default:
+			err = validationError("TransactItem must contain one of Put, Update, Delete or ConditionCheck")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if seen[w.table] == nil {
+			seen[w.table] = make(map[string]bool)
+		}
+		if seen[w.table][w.key] {
+			return nil, validationError("Transaction request cannot include multiple operations on one item")
+		}
+		seen[w.table][w.key] = true
+		writes[i] = w
+	}
+
+	reasons := make([]*dynamodb.CancellationReason, len(writes))
+	cancelled := false
+	for i, w := range writes {
+		reasons[i] = &dynamodb.CancellationReason{Code: aws.String("None")}
+		if !w.conditionHolds() {
+			cancelled = true
+			reasons[i] = &dynamodb.CancellationReason{
+				Code:    aws.String("ConditionalCheckFailed"),
+				Message: aws.String("The conditional request failed"),
+			}
+			if w.returnOnFailure {
+				reasons[i].Item = copyItem(w.table.items[w.key])
+			}
+		}
+	}
+	if cancelled {
+		codes := make([]string, len(reasons))
+		for i, r := range reasons {
+			codes[i] = *r.Code
+		}
+		return nil, &dynamodb.TransactionCanceledException{
+			Message_:            aws.String("Transaction cancelled, please refer cancellation reasons for specific reasons [" + strings.Join(codes, ", ") + "]"),
+			CancellationReasons: reasons,
+		}
+	}
+
+	// apply every write to copies first, so a failing update leaves nothing half done
+	type result struct {
+		w    *write
+		next item
+	}
+	results := make([]result, len(writes))
+	for i, w := range writes {
+		next, err := w.apply(w.table.items[w.key])
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result{w: w, next: next}
+	}
+	for _, r := range results {
+		if r.next == nil {
+			delete(r.w.table.items, r.w.key)
+		} else {
+			r.w.table.items[r.w.key] = r.next
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
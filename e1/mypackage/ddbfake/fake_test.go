@@ -0,0 +1,407 @@
+package ddbfake_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/idiomat/dodtnyt/e1/mypackage/ddbfake"
+)
+
+// newEvents returns a fake with a table of events keyed on User and Seq.
+func newEvents(t *testing.T, users, perUser int) *ddbfake.Fake {
+	t.Helper()
+	fake := ddbfake.New()
+	if err := fake.CreateTable("events", "User", "Seq"); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	for u := 0; u < users; u++ {
+		for i := 1; i <= perUser; i++ {
+			_, err := fake.PutItemWithContext(context.Background(), &dynamodb.PutItemInput{
+				TableName: aws.String("events"),
+				Item: map[string]*dynamodb.AttributeValue{
+					"User": s(fmt.Sprintf("u%d", u)),
+					"Seq":  n(fmt.Sprint(i)),
+					"Kind": s([]string{"login", "logout"}[i%2]),
+				},
+			})
+			if err != nil {
+				t.Fatalf("PutItem() error = %v", err)
+			}
+		}
+	}
+	return fake
+}
+
+func TestFake_GetPutDelete(t *testing.T) {
+	fake := newFake(t)
+	ctx := context.Background()
+	key := map[string]*dynamodb.AttributeValue{"ID": s("p1")}
+
+	got, err := fake.GetItemWithContext(ctx, &dynamodb.GetItemInput{TableName: aws.String("people"), Key: key})
+	if err != nil {
+		t.Fatalf("GetItem() error = %v", err)
+	}
+	if aws.StringValue(got.Item["Name"].S) != "Johnny" {
+		t.Errorf("GetItem() = %v, want Johnny", got.Item)
+	}
+
+	// the fake keeps its own copies
+	got.Item["Name"].S = aws.String("changed")
+	again, _ := fake.GetItemWithContext(ctx, &dynamodb.GetItemInput{TableName: aws.String("people"), Key: key})
+	if aws.StringValue(again.Item["Name"].S) != "Johnny" {
+		t.Errorf("GetItem() returned the stored item instead of a copy")
+	}
+
+	deleted, err := fake.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName:    aws.String("people"),
+		Key:          key,
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+	})
+	if err != nil {
+		t.Fatalf("DeleteItem() error = %v", err)
+	}
+	if aws.StringValue(deleted.Attributes["Name"].S) != "Johnny" {
+		t.Errorf("DeleteItem() old attributes = %v", deleted.Attributes)
+	}
+	gone, _ := fake.GetItemWithContext(ctx, &dynamodb.GetItemInput{TableName: aws.String("people"), Key: key})
+	if gone.Item != nil {
+		t.Errorf("GetItem() after delete = %v, want nothing", gone.Item)
+	}
+
+	tests := map[string]struct {
+		err  error
+		code string
+	}{
+		"unknown table": {
+			err: func() error {
+				_, err := fake.GetItemWithContext(ctx, &dynamodb.GetItemInput{TableName: aws.String("nope"), Key: key})
+				return err
+			}(),
+			code: dynamodb.ErrCodeResourceNotFoundException,
+		},
+		"extra key attribute": {
+			err: func() error {
+				_, err := fake.GetItemWithContext(ctx, &dynamodb.GetItemInput{TableName: aws.String("people"), Key: person()})
+				return err
+			}(),
+			code: ddbfake.ErrCodeValidationException,
+		},
+		"item without key": {
+			err: func() error {
+				_, err := fake.PutItemWithContext(ctx, &dynamodb.PutItemInput{TableName: aws.String("people"), Item: map[string]*dynamodb.AttributeValue{"Name": s("x")}})
+				return err
+			}(),
+			code: ddbfake.ErrCodeValidationException,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if errCode(tc.err) != tc.code {
+				t.Errorf("error = %v, want %s", tc.err, tc.code)
+			}
+		})
+	}
+}
+
+func TestFake_UpdateCreatesItem(t *testing.T) {
+	fake := newFake(t)
+
+	output, err := fake.UpdateItemWithContext(context.Background(), &dynamodb.UpdateItemInput{
+		TableName:                 aws.String("people"),
+		Key:                       map[string]*dynamodb.AttributeValue{"ID": s("p2")},
+		UpdateExpression:          aws.String("SET Name = :n"),
+		ConditionExpression:       aws.String("attribute_not_exists(ID)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":n": s("Jane")},
+		ReturnValues:              aws.String(dynamodb.ReturnValueAllNew),
+	})
+	if err != nil {
+		t.Fatalf("UpdateItem() error = %v", err)
+	}
+	if aws.StringValue(output.Attributes["ID"].S) != "p2" || aws.StringValue(output.Attributes["Name"].S) != "Jane" {
+		t.Errorf("UpdateItem() = %v, want the new item with its key", output.Attributes)
+	}
+}
+
+func TestFake_Query(t *testing.T) {
+	tests := map[string]struct {
+		keyCond  string
+		filter   string
+		values   map[string]*dynamodb.AttributeValue
+		backward bool
+		limit    int64
+		want     []string // Seq of every item, across pages
+		wantErr  bool
+	}{
+		"partition": {
+			keyCond: "#u = :u",
+			values:  map[string]*dynamodb.AttributeValue{":u": s("u1")},
+			want:    []string{"1", "2", "3", "4", "5"},
+		},
+		"sort key range backwards": {
+			keyCond:  "#u = :u AND Seq BETWEEN :lo AND :hi",
+			values:   map[string]*dynamodb.AttributeValue{":u": s("u1"), ":lo": n("2"), ":hi": n("4")},
+			backward: true,
+			want:     []string{"4", "3", "2"},
+		},
+		"filtered pages": {
+			keyCond: "#u = :u",
+			filter:  "Kind = :k",
+			values:  map[string]*dynamodb.AttributeValue{":u": s("u0"), ":k": s("logout")},
+			limit:   2,
+			want:    []string{"1", "3", "5"},
+		},
+		"backward pages": {
+			keyCond:  "#u = :u AND Seq > :lo",
+			values:   map[string]*dynamodb.AttributeValue{":u": s("u0"), ":lo": n("1")},
+			backward: true,
+			limit:    3,
+			want:     []string{"5", "4", "3", "2"},
+		},
+		"partition key required": {
+			keyCond: "Seq = :s",
+			values:  map[string]*dynamodb.AttributeValue{":s": n("1")},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake := newEvents(t, 2, 5)
+
+			input := &dynamodb.QueryInput{
+				TableName:                 aws.String("events"),
+				KeyConditionExpression:    aws.String(tc.keyCond),
+				ExpressionAttributeValues: tc.values,
+				ScanIndexForward:          aws.Bool(!tc.backward),
+			}
+			if tc.keyCond[0] == '#' {
+				input.ExpressionAttributeNames = map[string]*string{"#u": aws.String("User")}
+			}
+			if tc.filter != "" {
+				input.FilterExpression = aws.String(tc.filter)
+			}
+			if tc.limit > 0 {
+				input.Limit = aws.Int64(tc.limit)
+			}
+
+			var got []string
+			for pages := 0; ; pages++ {
+				if pages > 10 {
+					t.Fatalf("Query() never stopped paginating")
+				}
+				output, err := fake.QueryWithContext(context.Background(), input)
+				if tc.wantErr {
+					if errCode(err) != ddbfake.ErrCodeValidationException {
+						t.Errorf("Query() error = %v, want %s", err, ddbfake.ErrCodeValidationException)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Query() error = %v", err)
+				}
+				if tc.limit > 0 && aws.Int64Value(output.ScannedCount) > tc.limit {
+					t.Errorf("Query() scanned %d items, limit %d", aws.Int64Value(output.ScannedCount), tc.limit)
+				}
+				for _, it := range output.Items {
+					got = append(got, aws.StringValue(it["Seq"].N))
+				}
+				if output.LastEvaluatedKey == nil {
+					break
+				}
+				input.ExclusiveStartKey = output.LastEvaluatedKey
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("Query() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFake_ParallelScan(t *testing.T) {
+	fake := newEvents(t, 20, 2)
+
+	seen := make(map[string]bool)
+	for segment := int64(0); segment < 3; segment++ {
+		input := &dynamodb.ScanInput{
+			TableName:     aws.String("events"),
+			Segment:       aws.Int64(segment),
+			TotalSegments: aws.Int64(3),
+			Limit:         aws.Int64(4),
+		}
+		for {
+			output, err := fake.ScanWithContext(context.Background(), input)
+			if err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			for _, it := range output.Items {
+				key := aws.StringValue(it["User"].S) + "/" + aws.StringValue(it["Seq"].N)
+				if seen[key] {
+					t.Errorf("Scan() returned %s twice", key)
+				}
+				seen[key] = true
+			}
+			if output.LastEvaluatedKey == nil {
+				break
+			}
+			input.ExclusiveStartKey = output.LastEvaluatedKey
+		}
+	}
+	if len(seen) != 40 {
+		t.Errorf("segments returned %d items, want 40", len(seen))
+	}
+
+	_, err := fake.ScanWithContext(context.Background(), &dynamodb.ScanInput{TableName: aws.String("events"), Segment: aws.Int64(3), TotalSegments: aws.Int64(3)})
+	if errCode(err) != ddbfake.ErrCodeValidationException {
+		t.Errorf("Scan() of an invalid segment error = %v", err)
+	}
+}
+
+func TestFake_BatchWriteItem(t *testing.T) {
+	fake := newFake(t)
+	fake.Unprocessed = func(table string, req *dynamodb.WriteRequest) bool {
+		return req.PutRequest != nil && aws.StringValue(req.PutRequest.Item["ID"].S) == "p3"
+	}
+
+	put := func(id string) *dynamodb.WriteRequest {
+		return &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: map[string]*dynamodb.AttributeValue{"ID": s(id)}}}
+	}
+	output, err := fake.BatchWriteItemWithContext(context.Background(), &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]*dynamodb.WriteRequest{"people": {
+			put("p2"),
+			put("p3"),
+			{DeleteRequest: &dynamodb.DeleteRequest{Key: map[string]*dynamodb.AttributeValue{"ID": s("p1")}}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("BatchWriteItem() error = %v", err)
+	}
+	if len(output.UnprocessedItems["people"]) != 1 {
+		t.Errorf("BatchWriteItem() unprocessed = %v, want p3", output.UnprocessedItems)
+	}
+
+	items, _ := fake.Items("people")
+	if len(items) != 1 || aws.StringValue(items[0]["ID"].S) != "p2" {
+		t.Errorf("Items() = %v, want only p2", items)
+	}
+
+	_, err = fake.BatchWriteItemWithContext(context.Background(), &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]*dynamodb.WriteRequest{"people": {put("p4"), put("p4")}},
+	})
+	if errCode(err) != ddbfake.ErrCodeValidationException {
+		t.Errorf("BatchWriteItem() with duplicate keys error = %v", err)
+	}
+}
+
+func TestFake_BatchGetItem(t *testing.T) {
+	fake := newFake(t)
+
+	key := func(id string) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{"ID": s(id)}
+	}
+	output, err := fake.BatchGetItemWithContext(context.Background(), &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{"people": {Keys: []map[string]*dynamodb.AttributeValue{key("p1"), key("p9")}}},
+	})
+	if err != nil {
+		t.Fatalf("BatchGetItem() error = %v", err)
+	}
+	if got := output.Responses["people"]; len(got) != 1 || aws.StringValue(got[0]["ID"].S) != "p1" {
+		t.Errorf("BatchGetItem() = %v, want only p1", got)
+	}
+
+	_, err = fake.BatchGetItemWithContext(context.Background(), &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{"people": {Keys: []map[string]*dynamodb.AttributeValue{key("p1"), key("p1")}}},
+	})
+	if errCode(err) != ddbfake.ErrCodeValidationException {
+		t.Errorf("BatchGetItem() with duplicate keys error = %v", err)
+	}
+}
+
+func TestFake_TransactWriteItems(t *testing.T) {
+	fake := newFake(t)
+	ctx := context.Background()
+
+	counter := &dynamodb.TransactWriteItem{Update: &dynamodb.Update{
+		TableName:                 aws.String("people"),
+		Key:                       map[string]*dynamodb.AttributeValue{"ID": s("count")},
+		UpdateExpression:          aws.String("ADD Total :one"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":one": n("1")},
+	}}
+	create := func(id string) *dynamodb.TransactWriteItem {
+		return &dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+			TableName:           aws.String("people"),
+			Item:                map[string]*dynamodb.AttributeValue{"ID": s(id)},
+			ConditionExpression: aws.String("attribute_not_exists(ID)"),
+		}}
+	}
+
+	if _, err := fake.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{create("p2"), counter},
+	}); err != nil {
+		t.Fatalf("TransactWriteItems() error = %v", err)
+	}
+
+	// p1 exists, so nothing is written
+	_, err := fake.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{create("p3"), create("p1"), counter},
+	})
+	var cancelled *dynamodb.TransactionCanceledException
+	if !errors.As(err, &cancelled) {
+		t.Fatalf("TransactWriteItems() error = %v, want cancellation", err)
+	}
+	var codes []string
+	for _, r := range cancelled.CancellationReasons {
+		codes = append(codes, aws.StringValue(r.Code))
+	}
+	if fmt.Sprint(codes) != "[None ConditionalCheckFailed None]" {
+		t.Errorf("cancellation reasons = %v", codes)
+	}
+
+	items, _ := fake.Items("people")
+	ids := make([]string, 0, len(items))
+	for _, it := range items {
+		ids = append(ids, aws.StringValue(it["ID"].S))
+		if aws.StringValue(it["ID"].S) == "count" && aws.StringValue(it["Total"].N) != "1" {
+			t.Errorf("counter = %v, want 1", it["Total"])
+		}
+	}
+	if fmt.Sprint(ids) != "[count p1 p2]" {
+		t.Errorf("Items() = %v, want [count p1 p2]", ids)
+	}
+
+	_, err = fake.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{create("p4"), create("p4")},
+	})
+	if errCode(err) != ddbfake.ErrCodeValidationException {
+		t.Errorf("TransactWriteItems() on one item twice error = %v", err)
+	}
+}
+
+func TestFake_Hook(t *testing.T) {
+	fake := newFake(t)
+	throttled := errors.New("throttled")
+	fake.Hook = func(op string, input interface{}) error {
+		if op == "GetItem" {
+			return throttled
+		}
+		return nil
+	}
+
+	_, err := fake.GetItemWithContext(context.Background(), &dynamodb.GetItemInput{
+		TableName: aws.String("people"),
+		Key:       map[string]*dynamodb.AttributeValue{"ID": s("p1")},
+	})
+	if err != throttled {
+		t.Errorf("GetItem() error = %v, want %v", err, throttled)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := fake.ScanWithContext(ctx, &dynamodb.ScanInput{TableName: aws.String("people")}); err == nil {
+		t.Errorf("Scan() with a cancelled context expected error")
+	}
+}
@@ -0,0 +1,245 @@
+package ddbfake
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type item = map[string]*dynamodb.AttributeValue
+
+// typeOf returns the DynamoDB type descriptor of v, e.g. "S" or "NS".
+func typeOf(v *dynamodb.AttributeValue) string {
+	switch {
+	case v == nil:
+		return ""
+	case v.S != nil:
+		return "S"
+	case v.N != nil:
+		return "N"
+	case v.B != nil:
+		return "B"
+	case v.BOOL != nil:
+		return "BOOL"
+	case v.NULL != nil:
+		return "NULL"
+	case v.SS != nil:
+		return "SS"
+	case v.NS != nil:
+		return "NS"
+	case v.BS != nil:
+		return "BS"
+	case v.L != nil:
+		return "L"
+	case v.M != nil:
+		return "M"
+	}
+	return ""
+}
+
+func isSet(v *dynamodb.AttributeValue) bool {
+	t := typeOf(v)
+	return t == "SS" || t == "NS" || t == "BS"
+}
+
+func parseNumber(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return nil, fmt.Errorf("invalid number: %q", s)
+	}
+	return r, nil
+}
+
+// formatNumber prints r with as few decimals as represent it exactly.
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	for prec := 1; prec < 38; prec++ {
+		s := r.FloatString(prec)
+		if back, _ := new(big.Rat).SetString(s); back.Cmp(r) == 0 {
+			return s
+		}
+	}
+	return r.FloatString(38)
+}
+
+// compare orders two scalars of the same type. ok is false if they can't be ordered.
+func compare(a, b *dynamodb.AttributeValue) (c int, ok bool) {
+	if typeOf(a) != typeOf(b) {
+		return 0, false
+	}
+	switch typeOf(a) {
+	case "S":
+		return strings.Compare(*a.S, *b.S), true
+	case "B":
+		return bytes.Compare(a.B, b.B), true
+	case "N":
+		x, err := parseNumber(*a.N)
+		if err != nil {
+			return 0, false
+		}
+		y, err := parseNumber(*b.N)
+		if err != nil {
+			return 0, false
+		}
+		return x.Cmp(y), true
+	}
+	return 0, false
+}
+
+func equal(a, b *dynamodb.AttributeValue) bool {
+	t := typeOf(a)
+	if t == "" || t != typeOf(b) {
+		return false
+	}
+	switch t {
+	case "S", "N", "B":
+		c, ok := compare(a, b)
+		return ok && c == 0
+	case "BOOL":
+		return *a.BOOL == *b.BOOL
+	case "NULL":
+		return true
+	case "SS", "NS", "BS":
+		as, bs := setElems(a), setElems(b)
+		if len(as) != len(bs) {
+			return false
+		}
+		for _, x := range as {
+			if !containsElem(bs, x) {
+				return false
+			}
+		}
+		return true
+	case "L":
+		if len(a.L) != len(b.L) {
+			return false
+		}
+		for i := range a.L {
+			if !equal(a.L[i], b.L[i]) {
+				return false
+			}
+		}
+		return true
+	case "M":
+		if len(a.M) != len(b.M) {
+			return false
+		}
+		for k, v := range a.M {
+			if !equal(v, b.M[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// setElems returns the elements of a set as scalar values.
+func setElems(v *dynamodb.AttributeValue) []*dynamodb.AttributeValue {
+	var elems []*dynamodb.AttributeValue
+	for _, s := range v.SS {
+		elems = append(elems, &dynamodb.AttributeValue{S: s})
+	}
+	for _, n := range v.NS {
+		elems = append(elems, &dynamodb.AttributeValue{N: n})
+	}
+	for _, b := range v.BS {
+		elems = append(elems, &dynamodb.AttributeValue{B: b})
+	}
+	return elems
+}
+
+// makeSet builds a set of type t ("SS", "NS" or "BS") from scalar elements.
+func makeSet(t string, elems []*dynamodb.AttributeValue) *dynamodb.AttributeValue {
+	v := &dynamodb.AttributeValue{}
+	for _, e := range elems {
+		switch t {
+		case "SS":
+			v.SS = append(v.SS, aws.String(*e.S))
+		case "NS":
+			v.NS = append(v.NS, aws.String(*e.N))
+		case "BS":
+			v.BS = append(v.BS, append([]byte(nil), e.B...))
+		}
+	}
+	return v
+}
+
+func containsElem(elems []*dynamodb.AttributeValue, v *dynamodb.AttributeValue) bool {
+	for _, e := range elems {
+		if equal(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// size implements the size() function.
+func size(v *dynamodb.AttributeValue) (int, bool) {
+	switch typeOf(v) {
+	case "S":
+		return len(*v.S), true
+	case "B":
+		return len(v.B), true
+	case "SS", "NS", "BS":
+		return len(setElems(v)), true
+	case "L":
+		return len(v.L), true
+	case "M":
+		return len(v.M), true
+	}
+	return 0, false
+}
+
+func copyValue(v *dynamodb.AttributeValue) *dynamodb.AttributeValue {
+	if v == nil {
+		return nil
+	}
+	c := &dynamodb.AttributeValue{}
+	if v.S != nil {
+		c.S = aws.String(*v.S)
+	}
+	if v.N != nil {
+		c.N = aws.String(*v.N)
+	}
+	if v.B != nil {
+		c.B = append([]byte{}, v.B...)
+	}
+	if v.BOOL != nil {
+		c.BOOL = aws.Bool(*v.BOOL)
+	}
+	if v.NULL != nil {
+		c.NULL = aws.Bool(*v.NULL)
+	}
+	if v.SS != nil || v.NS != nil || v.BS != nil {
+		set := makeSet(typeOf(v), setElems(v))
+		c.SS, c.NS, c.BS = set.SS, set.NS, set.BS
+	}
+	if v.L != nil {
+		c.L = make([]*dynamodb.AttributeValue, len(v.L))
+		for i, e := range v.L {
+			c.L[i] = copyValue(e)
+		}
+	}
+	if v.M != nil {
+		c.M = copyItem(v.M)
+	}
+	return c
+}
+
+func copyItem(it item) item {
+	if it == nil {
+		return nil
+	}
+	c := make(item, len(it))
+	for k, v := range it {
+		c[k] = copyValue(v)
+	}
+	return c
+}
@@ -0,0 +1,282 @@
+package mypackage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Modes of the encrypt tag, which marks the Person fields to encrypt.
+const (
+	// EncryptRandomized encrypts with a random nonce, so equal values are stored differently.
+	EncryptRandomized = "randomized"
+	// EncryptDeterministic stores equal values the same way under the same key,
+	// so the attribute can be compared for equality. It reveals which people share a value.
+	EncryptDeterministic = "deterministic"
+)
+
+var (
+	// ErrUnknownKey is returned when a key ID isn't known to the KeyProvider.
+	ErrUnknownKey = errors.New("unknown encryption key")
+	// ErrDecrypt is returned when an encrypted attribute can't be decrypted.
+	ErrDecrypt = errors.New("failed to decrypt")
+)
+
+// encryptedAttrs maps the attributes of Person fields with an encrypt tag to its mode.
+var encryptedAttrs = func() map[string]string {
+	attrs := make(map[string]string)
+	t := reflect.TypeOf(Person{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		mode, ok := f.Tag.Lookup("encrypt")
+		if !ok {
+			continue
+		}
+		if mode != EncryptRandomized && mode != EncryptDeterministic {
+			panic(fmt.Sprintf("Person.%s: unknown encryption mode %q", f.Name, mode))
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("dynamodbav"), ",")
+		if name == "" {
+			name = f.Name
+		}
+		attrs[name] = mode
+	}
+	return attrs
+}()
+
+// KeyProvider supplies the AES keys attributes are encrypted with.
+type KeyProvider interface {
+	// CurrentKey returns the key new values are encrypted with, and its ID.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key with the given ID, or an error matching ErrUnknownKey.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider holding its keys in memory.
+// Keys that were current before a rotation are kept so the values they encrypted can still be read.
+type StaticKeys struct {
+	Current string            `json:"current"`
+	Keys    map[string][]byte `json:"keys"` // 16, 24 or 32 bytes long for AES-128, AES-192 or AES-256
+}
+
+// NewStaticKeys returns StaticKeys holding a single key.
+func NewStaticKeys(id string, key []byte) (*StaticKeys, error) {
+	k := &StaticKeys{Current: id, Keys: map[string][]byte{id: key}}
+	return k, k.validate()
+}
+
+// LoadKeyFile reads StaticKeys from a JSON file with the current key ID and base64 encoded keys, e.g.
+//
+//	{"current": "k2", "keys": {"k1": "...", "k2": "..."}}
+func LoadKeyFile(path string) (*StaticKeys, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var k StaticKeys
+	if err := json.Unmarshal(raw, &k); err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	if err := k.validate(); err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	return &k, nil
+}
+
+func (k *StaticKeys) validate() error {
+	if _, ok := k.Keys[k.Current]; !ok {
+		return fmt.Errorf("current key %q: %w", k.Current, ErrUnknownKey)
+	}
+	for id, key := range k.Keys {
+		if id == "" || len(id) > 255 {
+			return fmt.Errorf("invalid key ID: %q", id)
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return fmt.Errorf("key %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (k *StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := k.Key(k.Current)
+	return k.Current, key, err
+}
+
+func (k *StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%q: %w", id, ErrUnknownKey)
+	}
+	return key, nil
+}
+
+// FieldEncrypter encrypts the Person attributes tagged with encrypt using AES-GCM.
+// An encrypted attribute is stored as a binary value holding the ID of the key it was
+// encrypted with, the nonce and the sealed attribute, which is bound to the attribute name.
+// Values that aren't binary were written before encryption was enabled, and are read as they are.
+type FieldEncrypter struct {
+	Keys KeyProvider
+}
+
+// NewFieldEncrypter returns a FieldEncrypter using the keys of keys.
+func NewFieldEncrypter(keys KeyProvider) (*FieldEncrypter, error) {
+	e := &FieldEncrypter{Keys: keys}
+	return e, e.validate()
+}
+
+func (e *FieldEncrypter) validate() error {
+	if e.Keys == nil {
+		return errors.New("key provider is required")
+	}
+	return nil
+}
+
+const envelopeVersion = 1
+
+// encryptItem encrypts the attributes of item that are tagged with encrypt, in place.
+func (e *FieldEncrypter) encryptItem(item map[string]*dynamodb.AttributeValue) error {
+	for attr := range encryptedAttrs {
+		v, ok := item[attr]
+		if !ok {
+			continue
+		}
+		sealed, err := e.encrypt(attr, v)
+		if err != nil {
+			return err
+		}
+		item[attr] = sealed
+	}
+	return nil
+}
+
+// encrypt encrypts v if attr is tagged with encrypt, and returns it as it is otherwise.
+func (e *FieldEncrypter) encrypt(attr string, v *dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	mode, ok := encryptedAttrs[attr]
+	if !ok {
+		return v, nil
+	}
+	id, key, err := e.Keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+	// AttributeValues marshal to JSON as they are, with sorted map keys, so this can't fail
+	plaintext, _ := json.Marshal(v)
+
+	nonce := make([]byte, gcm.NonceSize())
+	if mode == EncryptDeterministic {
+		// the nonce is derived from the value, so equal values get equal ciphertexts (SIV style)
+		mac := hmac.New(sha256.New, nonceKey(key))
+		mac.Write([]byte(attr))
+		mac.Write([]byte{0})
+		mac.Write(plaintext)
+		copy(nonce, mac.Sum(nil))
+	} else if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 0, 2+len(id)+len(nonce)+len(plaintext)+gcm.Overhead())
+	b = append(b, envelopeVersion, byte(len(id)))
+	b = append(b, id...)
+	b = append(b, nonce...)
+	b = gcm.Seal(b, nonce, plaintext, []byte(attr))
+	return &dynamodb.AttributeValue{B: b}, nil
+}
+
+// decryptItem returns a copy of item with the attributes tagged with encrypt decrypted.
+func (e *FieldEncrypter) decryptItem(item map[string]*dynamodb.AttributeValue) (map[string]*dynamodb.AttributeValue, error) {
+	out := make(map[string]*dynamodb.AttributeValue, len(item))
+	for attr, v := range item {
+		out[attr] = v
+		if _, ok := encryptedAttrs[attr]; !ok || v.B == nil {
+			continue
+		}
+		plain, err := e.decrypt(attr, v.B)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", attr, err)
+		}
+		out[attr] = plain
+	}
+	return out, nil
+}
+
+func (e *FieldEncrypter) decrypt(attr string, b []byte) (*dynamodb.AttributeValue, error) {
+	if len(b) < 2 || b[0] != envelopeVersion {
+		return nil, fmt.Errorf("%w: malformed value", ErrDecrypt)
+	}
+	n := 2 + int(b[1]) // the key ID follows its length
+	if len(b) < n {
+		return nil, fmt.Errorf("%w: malformed value", ErrDecrypt)
+	}
+	id, b := string(b[2:n]), b[n:]
+	key, err := e.Keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+	if len(b) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: malformed value", ErrDecrypt)
+	}
+	plaintext, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], []byte(attr))
+	if err != nil {
+		return nil, fmt.Errorf("%w with key %s: %w", ErrDecrypt, id, err)
+	}
+	var v dynamodb.AttributeValue
+	if err := json.Unmarshal(plaintext, &v); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+	return &v, nil
+}
+
+// QueryValue returns what an attribute encrypted with EncryptDeterministic holds when its value is v,
+// for comparing it in an Expression. Values encrypted with a key that is no longer current don't match.
+func (e *FieldEncrypter) QueryValue(attr string, v interface{}) ([]byte, error) {
+	if err := e.validate(); err != nil {
+		return nil, err
+	}
+	if encryptedAttrs[attr] != EncryptDeterministic {
+		return nil, fmt.Errorf("attribute %s isn't encrypted deterministically", attr)
+	}
+	av, err := dynamodbattribute.Marshal(v)
+	if err != nil {
+		return nil, marshalError("attribute "+attr, err)
+	}
+	sealed, err := e.encrypt(attr, av)
+	if err != nil {
+		return nil, err
+	}
+	return sealed.B, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonceKey derives the key deterministic nonces are computed with, so key isn't used for both.
+func nonceKey(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("person attribute nonce"))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,314 @@
+package mypackage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+	"github.com/idiomat/dodtnyt/e1/mypackage/ddbfake"
+)
+
+var (
+	key1 = bytes.Repeat([]byte{1}, 32)
+	key2 = bytes.Repeat([]byte{2}, 16)
+)
+
+// newEncryptedRepository returns a repository over a fake, encrypting with keys.
+func newEncryptedRepository(t *testing.T, fake *ddbfake.Fake, keys mypackage.KeyProvider) *mypackage.PersonRepository {
+	t.Helper()
+	enc, err := mypackage.NewFieldEncrypter(keys)
+	if err != nil {
+		t.Fatalf("NewFieldEncrypter() error = %v", err)
+	}
+	repo, err := mypackage.NewPersonRepository(fake, mypackage.Table{Name: "people", Encryption: enc})
+	if err != nil {
+		t.Fatalf("NewPersonRepository() error = %v", err)
+	}
+	return repo
+}
+
+func newPeopleFake(t *testing.T) *ddbfake.Fake {
+	t.Helper()
+	fake := ddbfake.New()
+	if err := fake.CreateTable("people", "ID", ""); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	return fake
+}
+
+// stored returns the item of the person with the given ID as the fake holds it.
+func stored(t *testing.T, fake *ddbfake.Fake, id string) map[string]*dynamodb.AttributeValue {
+	t.Helper()
+	items, err := fake.Items("people")
+	if err != nil {
+		t.Fatalf("Items() error = %v", err)
+	}
+	for _, item := range items {
+		if v := item["ID"]; v != nil && v.S != nil && *v.S == id {
+			return item
+		}
+	}
+	t.Fatalf("%s isn't stored", id)
+	return nil
+}
+
+func TestFieldEncrypter(t *testing.T) {
+	fake := newPeopleFake(t)
+	keys, err := mypackage.NewStaticKeys("k1", key1)
+	if err != nil {
+		t.Fatalf("NewStaticKeys() error = %v", err)
+	}
+	repo := newEncryptedRepository(t, fake, keys)
+	ctx := context.Background()
+
+	johnny := &mypackage.Person{
+		ID:        "p1",
+		Name:      "Johnny",
+		Email:     "johnny@example.com",
+		BirthDate: "1990-05-17",
+		Address:   &mypackage.Address{City: "Lisboa", Country: "PT"},
+		Tags:      []string{"vip"},
+	}
+	if err := repo.Save(ctx, johnny); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	item := stored(t, fake, "p1")
+	for _, attr := range []string{"Name", "Email", "BirthDate", "Address"} {
+		if v := item[attr]; v == nil || v.B == nil || bytes.Contains(v.B, []byte("Johnny")) || bytes.Contains(v.B, []byte("Lisboa")) {
+			t.Errorf("expected %s to be stored encrypted but got %v", attr, v)
+		}
+	}
+	if v := item["Tags"]; v == nil || len(v.SS) != 1 {
+		t.Errorf("expected Tags to be stored in plaintext but got %v", v)
+	}
+
+	got, err := repo.Get(ctx, "p1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, johnny) {
+		t.Errorf("Get() = %+v, want %+v", got, johnny)
+	}
+
+	// equal emails are stored the same way, so they can be looked up
+	jane := &mypackage.Person{ID: "p2", Name: "Jane", Email: "johnny@example.com"}
+	if err := repo.Save(ctx, jane); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if a, b := stored(t, fake, "p1"), stored(t, fake, "p2"); !bytes.Equal(a["Email"].B, b["Email"].B) || bytes.Equal(a["Name"].B, b["Name"].B) {
+		t.Errorf("expected only the deterministic attribute to be stored the same way")
+	}
+	email, err := repo.DynamoDBGetter.Table.Encryption.QueryValue("Email", "johnny@example.com")
+	if err != nil {
+		t.Fatalf("QueryValue() error = %v", err)
+	}
+	it, err := repo.Scan(mypackage.ScanOptions{Filter: &mypackage.Expression{
+		Expr:   "#email = :email",
+		Names:  map[string]string{"#email": "Email"},
+		Values: map[string]interface{}{":email": email},
+	}})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	found, err := it.Next(ctx)
+	if err != nil || len(found) != 2 || found[0].Name == "" {
+		t.Errorf("expected to find both people by email but got %v, %v", found, err)
+	}
+	if _, err := repo.DynamoDBGetter.Table.Encryption.QueryValue("Name", "Johnny"); err == nil {
+		t.Errorf("expected QueryValue() of a randomized attribute to fail")
+	}
+
+	updated, err := repo.Update(ctx, "p1", 0, map[string]interface{}{"Email": "john@example.com"})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if updated.Email != "john@example.com" || updated.Name != "Johnny" {
+		t.Errorf("Update() = %+v, want the new email", updated)
+	}
+	if v := stored(t, fake, "p1")["Email"]; v.B == nil {
+		t.Errorf("expected the updated email to be stored encrypted but got %v", v)
+	}
+}
+
+func TestFieldEncrypter_Decrypt(t *testing.T) {
+	longID := strings.Repeat("k", 255) // the longest an envelope holds
+	longKeys := &mypackage.StaticKeys{Current: longID, Keys: map[string][]byte{longID: key1}}
+
+	tests := map[string]struct {
+		writer  *mypackage.StaticKeys // what the writer has, k1 if nil
+		keys    *mypackage.StaticKeys // what the reader has
+		tamper  bool
+		corrupt []byte // stored instead of the encrypted name
+		wantErr error
+	}{
+		"longest key ID": {
+			writer: longKeys,
+			keys:   longKeys,
+		},
+		"truncated key ID": {
+			keys:    longKeys,
+			corrupt: []byte{1, 255, 'k'},
+			wantErr: mypackage.ErrDecrypt,
+		},
+		"no ciphertext after the longest key ID": {
+			keys:    longKeys,
+			corrupt: append([]byte{1, 255}, longID...),
+			wantErr: mypackage.ErrDecrypt,
+		},
+		"rotated key": {
+			keys: &mypackage.StaticKeys{Current: "k2", Keys: map[string][]byte{"k1": key1, "k2": key2}},
+		},
+		"retired key": {
+			keys:    &mypackage.StaticKeys{Current: "k2", Keys: map[string][]byte{"k2": key2}},
+			wantErr: mypackage.ErrUnknownKey,
+		},
+		"wrong key": {
+			keys:    &mypackage.StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": key2}},
+			wantErr: mypackage.ErrDecrypt,
+		},
+		"tampered": {
+			keys:    &mypackage.StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": key1}},
+			tamper:  true,
+			wantErr: mypackage.ErrDecrypt,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake := newPeopleFake(t)
+			writerKeys := tc.writer
+			if writerKeys == nil {
+				writerKeys = &mypackage.StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": key1}}
+			}
+			writer := newEncryptedRepository(t, fake, writerKeys)
+			ctx := context.Background()
+			if err := writer.Save(ctx, &mypackage.Person{ID: "p1", Name: "Johnny"}); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			if tc.tamper || tc.corrupt != nil {
+				item := stored(t, fake, "p1")
+				item["Name"].B[len(item["Name"].B)-1] ^= 1
+				if tc.corrupt != nil {
+					item["Name"].B = tc.corrupt
+				}
+				if _, err := fake.PutItemWithContext(ctx, &dynamodb.PutItemInput{TableName: aws.String("people"), Item: item}); err != nil {
+					t.Fatalf("PutItem() error = %v", err)
+				}
+			}
+
+			got, err := newEncryptedRepository(t, fake, tc.keys).Get(ctx, "p1")
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v but got %v", tc.wantErr, err)
+			}
+			if tc.wantErr == nil && got.Name != "Johnny" {
+				t.Errorf("expected Johnny but got %+v", got)
+			}
+		})
+	}
+}
+
+func TestFieldEncrypter_Plaintext(t *testing.T) {
+	fake := newPeopleFake(t)
+	ctx := context.Background()
+	plain, err := mypackage.NewPersonRepository(fake, mypackage.Table{Name: "people"})
+	if err != nil {
+		t.Fatalf("NewPersonRepository() error = %v", err)
+	}
+	if err := plain.Save(ctx, &mypackage.Person{ID: "p1", Name: "Johnny"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// people written before encryption was enabled are read as they are
+	got, err := newEncryptedRepository(t, fake, &mypackage.StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": key1}}).Get(ctx, "p1")
+	if err != nil || got.Name != "Johnny" {
+		t.Errorf("Get() = %+v, %v, want Johnny", got, err)
+	}
+}
+
+func TestIdempotentSaver_Encrypted(t *testing.T) {
+	s, fake, _ := newIdempotentSaver(t)
+	enc, err := mypackage.NewFieldEncrypter(&mypackage.StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": key1}})
+	if err != nil {
+		t.Fatalf("NewFieldEncrypter() error = %v", err)
+	}
+	s.Table.Encryption = enc
+	ctx := context.Background()
+
+	if err := s.Save(ctx, "k1", &mypackage.Person{ID: "p1", Name: "Johnny"}); err == nil {
+		t.Errorf("expected an encrypted table to need a fingerprint key")
+	}
+
+	s.FingerprintKey = []byte("fingerprint key")
+	if err := s.Save(ctx, "k1", &mypackage.Person{ID: "p1", Name: "Johnny"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	items, _ := fake.Items("idempotency")
+	if result := items[0]["Result"]; result == nil || result.M["Name"].B == nil {
+		t.Errorf("expected the recorded person to be encrypted but got %v", result)
+	}
+
+	// the fingerprint depends on the key, so it can't be computed from a guessed Person
+	other, otherFake, _ := newIdempotentSaver(t)
+	other.Table.Encryption = enc
+	other.FingerprintKey = []byte("another key")
+	if err := other.Save(ctx, "k1", &mypackage.Person{ID: "p1", Name: "Johnny"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	otherItems, _ := otherFake.Items("idempotency")
+	if fp := aws.StringValue(items[0]["Fingerprint"].S); fp == "" || fp == aws.StringValue(otherItems[0]["Fingerprint"].S) {
+		t.Errorf("expected fingerprints to differ between keys but both are %q", fp)
+	}
+
+	retry := &mypackage.Person{ID: "p1", Name: "Johnny"}
+	if err := s.Save(ctx, "k1", retry); err != nil || retry.Version != 1 {
+		t.Errorf("expected the retry to get the recorded person but got %+v, %v", retry, err)
+	}
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		wantErr bool
+	}{
+		"valid":           {content: `{"current": "k2", "keys": {"k1": "AQEBAQEBAQEBAQEBAQEBAQ==", "k2": "AgICAgICAgICAgICAgICAg=="}}`},
+		"unknown current": {content: `{"current": "k3", "keys": {"k1": "AQEBAQEBAQEBAQEBAQEBAQ=="}}`, wantErr: true},
+		"short key":       {content: `{"current": "k1", "keys": {"k1": "AQEB"}}`, wantErr: true},
+		"not json":        {content: `current=k1`, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			if err := os.WriteFile(path, []byte(tc.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			keys, err := mypackage.LoadKeyFile(path)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v but got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			id, key, err := keys.CurrentKey()
+			if err != nil || id != "k2" || !bytes.Equal(key, bytes.Repeat([]byte{2}, 16)) {
+				t.Errorf("CurrentKey() = %s, %v, %v", id, key, err)
+			}
+		})
+	}
+
+	if _, err := mypackage.LoadKeyFile(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v but got %v", os.ErrNotExist, err)
+	}
+	if _, err := mypackage.NewStaticKeys("", key1); err == nil || !strings.Contains(err.Error(), "key ID") {
+		t.Errorf("expected an empty key ID to be rejected but got %v", err)
+	}
+}
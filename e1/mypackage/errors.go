@@ -0,0 +1,98 @@
+package mypackage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Every error DynamoDB returns matches one of these with errors.Is when its code is known.
+var (
+	// ErrThrottled is returned when DynamoDB rejected a request for exceeding capacity or rate limits.
+	ErrThrottled = errors.New("request throttled")
+	// ErrConditionFailed is returned when the condition of a write didn't hold.
+	ErrConditionFailed = errors.New("condition failed")
+	// ErrResourceNotFound is returned when the table or index doesn't exist.
+	ErrResourceNotFound = errors.New("table or index not found")
+	// ErrValidation is returned when DynamoDB rejected a request as invalid,
+	// and matched by a *ValidationError for an invalid Person.
+	ErrValidation = errors.New("invalid request")
+	// ErrMarshal is returned when a value can't be converted to or from DynamoDB attributes.
+	ErrMarshal = errors.New("marshaling failed")
+)
+
+var errKinds = map[string]error{
+	dynamodb.ErrCodeProvisionedThroughputExceededException: ErrThrottled,
+	dynamodb.ErrCodeRequestLimitExceeded:                   ErrThrottled,
+	"ThrottlingException":                                  ErrThrottled,
+	dynamodb.ErrCodeConditionalCheckFailedException:        ErrConditionFailed,
+	dynamodb.ErrCodeResourceNotFoundException:              ErrResourceNotFound,
+	"ValidationException":                                  ErrValidation,
+}
+
+// DynamoDBError is a request DynamoDB failed. It unwraps to the awserr.Error it returned
+// and, for the codes we know, to ErrThrottled, ErrConditionFailed, ErrResourceNotFound or ErrValidation.
+type DynamoDBError struct {
+	Op   string // the DynamoDB operation, e.g. PutItem
+	Code string
+	Err  awserr.Error
+
+	kind error
+}
+
+func (e *DynamoDBError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Op, e.Err)
+}
+
+// Unwrap also returns the error that caused Err, like the context error of a cancelled request,
+// as awserr.Error doesn't unwrap to it.
+func (e *DynamoDBError) Unwrap() []error {
+	errs := []error{e.Err}
+	if e.kind != nil {
+		errs = append(errs, e.kind)
+	}
+	if orig := e.Err.OrigErr(); orig != nil {
+		errs = append(errs, orig)
+	}
+	return errs
+}
+
+// wrapErr turns an error DynamoDB returned for op into a *DynamoDBError.
+// Other errors, like a cancelled context, are returned as they are.
+func wrapErr(op string, err error) error {
+	var dErr *DynamoDBError
+	if errors.As(err, &dErr) {
+		return err
+	}
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return err
+	}
+	return &DynamoDBError{Op: op, Code: aerr.Code(), Err: aerr, kind: errKinds[aerr.Code()]}
+}
+
+// MarshalError is returned when a value can't be converted to or from DynamoDB attributes.
+// It matches ErrMarshal with errors.Is.
+type MarshalError struct {
+	Op   string // marshal or unmarshal
+	What string // what was being converted, e.g. person p1
+	Err  error
+}
+
+func marshalError(what string, err error) error {
+	return &MarshalError{Op: "marshal", What: what, Err: err}
+}
+
+func unmarshalError(what string, err error) error {
+	return &MarshalError{Op: "unmarshal", What: what, Err: err}
+}
+
+func (e *MarshalError) Error() string {
+	return fmt.Sprintf("failed to %s %s: %v", e.Op, e.What, e.Err)
+}
+
+func (e *MarshalError) Unwrap() []error {
+	return []error{ErrMarshal, e.Err}
+}
@@ -0,0 +1,122 @@
+package mypackage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+)
+
+func TestDynamoDBError(t *testing.T) {
+	tests := map[string]struct {
+		code string
+		want error
+	}{
+		"throttled":          {code: dynamodb.ErrCodeProvisionedThroughputExceededException, want: mypackage.ErrThrottled},
+		"request limit":      {code: dynamodb.ErrCodeRequestLimitExceeded, want: mypackage.ErrThrottled},
+		"throttling":         {code: "ThrottlingException", want: mypackage.ErrThrottled},
+		"condition failed":   {code: dynamodb.ErrCodeConditionalCheckFailedException, want: mypackage.ErrConditionFailed},
+		"resource not found": {code: dynamodb.ErrCodeResourceNotFoundException, want: mypackage.ErrResourceNotFound},
+		"validation":         {code: "ValidationException", want: mypackage.ErrValidation},
+		"unknown":            {code: dynamodb.ErrCodeInternalServerError},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cause := awserr.New(tc.code, "request failed", nil)
+			saver := &mypackage.DynamoDBSaver{Client: &testClient{err: cause}, Table: table}
+
+			err := saver.Save(context.Background(), &mypackage.Person{ID: "p1", Name: "Johnny"})
+			if tc.want != nil && !errors.Is(err, tc.want) {
+				t.Errorf("expected %v but got %v", tc.want, err)
+			}
+			if !errors.Is(err, cause) {
+				t.Errorf("expected the awserr.Error to be wrapped but got %v", err)
+			}
+
+			var dErr *mypackage.DynamoDBError
+			if !errors.As(err, &dErr) {
+				t.Fatalf("expected a *DynamoDBError but got %T", err)
+			}
+			if dErr.Op != "UpdateItem" || dErr.Code != tc.code {
+				t.Errorf("expected UpdateItem failing with %s but got %s failing with %s", tc.code, dErr.Op, dErr.Code)
+			}
+			var aerr awserr.Error
+			if !errors.As(err, &aerr) || aerr.Code() != tc.code {
+				t.Errorf("expected an awserr.Error with code %s but got %v", tc.code, err)
+			}
+		})
+	}
+}
+
+func TestDynamoDBError_Cancelled(t *testing.T) {
+	cause := awserr.New(request.CanceledErrorCode, "request context canceled", context.Canceled)
+	saver := &mypackage.DynamoDBSaver{Client: &testClient{err: cause}, Table: table}
+
+	if err := saver.Save(context.Background(), &mypackage.Person{ID: "p1", Name: "Johnny"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+}
+
+func TestDynamoDBError_VersionConflict(t *testing.T) {
+	cause := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "condition failed", nil)
+	saver := &mypackage.DynamoDBSaver{Client: &testClient{err: cause}, Table: table, Versioned: true}
+
+	err := saver.Save(context.Background(), &mypackage.Person{ID: "p1", Name: "Johnny", Version: 2})
+	for _, want := range []error{mypackage.ErrVersionConflict, mypackage.ErrConditionFailed, cause} {
+		if !errors.Is(err, want) {
+			t.Errorf("expected %v to match %v", err, want)
+		}
+	}
+}
+
+// unmarshalable can't be stored, as dynamodbattribute accepts almost anything.
+type unmarshalable struct{}
+
+func (unmarshalable) MarshalDynamoDBAttributeValue(*dynamodb.AttributeValue) error {
+	return errors.New("can't be stored")
+}
+
+func TestMarshalError(t *testing.T) {
+	tests := map[string]struct {
+		call func() error
+		op   string
+	}{
+		"marshal": {
+			call: func() error {
+				updater := &mypackage.DynamoDBUpdater{Client: &updateClient{}, Table: table}
+				_, err := updater.Update(context.Background(), "p1", 0, map[string]interface{}{"Name": unmarshalable{}})
+				return err
+			},
+			op: "marshal",
+		},
+		"unmarshal": {
+			call: func() error {
+				bad := item("p1", "Johnny")
+				bad["Name"] = &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{"First": {S: aws.String("Johnny")}}}
+				getter := &mypackage.DynamoDBGetter{Client: &getClient{output: &dynamodb.GetItemOutput{Item: bad}}, Table: table}
+				_, err := getter.Get(context.Background(), "p1")
+				return err
+			},
+			op: "unmarshal",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.call()
+			if !errors.Is(err, mypackage.ErrMarshal) {
+				t.Fatalf("expected %v but got %v", mypackage.ErrMarshal, err)
+			}
+			var mErr *mypackage.MarshalError
+			if !errors.As(err, &mErr) || mErr.Op != tc.op || mErr.Err == nil {
+				t.Errorf("expected a *MarshalError failing to %s but got %v", tc.op, err)
+			}
+		})
+	}
+}
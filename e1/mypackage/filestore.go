@@ -0,0 +1,225 @@
+package mypackage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ErrStoreClosed is returned when a FileStore is used after it was closed.
+var ErrStoreClosed = errors.New("file store closed")
+
+// fileEntry is a line of a FileStore: a saved Person, or the ID of a deleted one.
+type fileEntry struct {
+	Person  *Person `json:",omitempty"`
+	Deleted string  `json:",omitempty"`
+}
+
+// FileStore stores people in an append-only JSON Lines file, which suits local development and tests.
+// Every Save and Delete appends a line, and the file is read back when the store is opened,
+// keeping the latest Person of each ID in memory. It is safe for concurrent use, but not for
+// several stores, or processes, sharing a file.
+// When Versioned is set, Save only overwrites a Person whose stored version matches
+// the one being saved, and increments it.
+type FileStore struct {
+	Versioned bool
+
+	mu     sync.RWMutex
+	file   *os.File
+	size   int64 // of the complete lines in file
+	people map[string]*Person
+}
+
+// NewFileStore opens the store in the file at path, creating it if it doesn't exist.
+// A line left incomplete by a crash while writing it is discarded.
+func NewFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStore{file: f, people: make(map[string]*Person)}
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// load replays the file, and leaves it positioned to append after its last complete line.
+func (s *FileStore) load() error {
+	r := bufio.NewReader(s.file)
+	var offset int64
+	for line := 1; ; line++ {
+		raw, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a write that didn't finish, or nothing at all
+			s.size = offset
+			return s.rewind()
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(raw))
+
+		var entry fileEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		switch {
+		case entry.Person != nil:
+			s.people[entry.Person.ID] = entry.Person
+		case entry.Deleted != "":
+			delete(s.people, entry.Deleted)
+		default:
+			return fmt.Errorf("line %d: empty entry", line)
+		}
+	}
+}
+
+func (s *FileStore) validate() error {
+	if s.file == nil {
+		return ErrStoreClosed
+	}
+	return nil
+}
+
+// appendEntry writes entry as a line. The caller holds the write lock.
+func (s *FileStore) appendEntry(entry fileEntry) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line := append(raw, '\n')
+	if _, err := s.file.Write(line); err != nil {
+		// don't leave part of the line for the next one to be appended to
+		_ = s.rewind()
+		return err
+	}
+	s.size += int64(len(line))
+	return nil
+}
+
+// rewind drops whatever follows the complete lines of the file.
+func (s *FileStore) rewind() error {
+	if err := s.file.Truncate(s.size); err != nil {
+		return err
+	}
+	_, err := s.file.Seek(s.size, io.SeekStart)
+	return err
+}
+
+// Save validates and saves p, setting its timestamps.
+// Saving a Person without CreatedAt keeps the one stored, if any.
+// A versioned save of a Person with version 0 only succeeds if it doesn't exist yet.
+func (s *FileStore) Save(ctx context.Context, p *Person) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.validate(); err != nil {
+		return err
+	}
+	current, ok := s.people[p.ID]
+	if s.Versioned {
+		var stored int64
+		if ok {
+			stored = current.Version
+		}
+		if stored != p.Version {
+			return fmt.Errorf("%s at version %d: %w", p.ID, p.Version, ErrVersionConflict)
+		}
+	}
+
+	next := *p
+	if next.CreatedAt.IsZero() && ok {
+		next.CreatedAt = current.CreatedAt
+	}
+	next.stamp(timestamp())
+	if s.Versioned {
+		next.Version++
+	}
+	if err := s.appendEntry(fileEntry{Person: &next}); err != nil {
+		return err
+	}
+	s.people[p.ID] = next.clone()
+	*p = next
+	return nil
+}
+
+// Get returns the Person with the given ID, or ErrNotFound.
+func (s *FileStore) Get(ctx context.Context, id string) (*Person, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	p, ok := s.people[id]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+	return p.clone(), nil
+}
+
+// Delete removes the Person with the given ID. Deleting a missing Person is not an error.
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.validate(); err != nil {
+		return err
+	}
+	if _, ok := s.people[id]; !ok {
+		return nil
+	}
+	if err := s.appendEntry(fileEntry{Deleted: id}); err != nil {
+		return err
+	}
+	delete(s.people, id)
+	return nil
+}
+
+// List returns every Person, ordered by ID.
+func (s *FileStore) List(ctx context.Context) ([]*Person, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	people := make([]*Person, 0, len(s.people))
+	for _, p := range s.people {
+		people = append(people, p.clone())
+	}
+	sort.Slice(people, func(i, j int) bool { return people[i].ID < people[j].ID })
+	return people, nil
+}
+
+// Close flushes the file to disk and closes it. The store can't be used afterwards.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := errors.Join(s.file.Sync(), s.file.Close())
+	s.file = nil
+	return err
+}
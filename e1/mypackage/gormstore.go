@@ -0,0 +1,178 @@
+package mypackage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// personRecord is how a Person is stored in a SQL database.
+type personRecord struct {
+	ID        string `gorm:"primaryKey"`
+	Name      string
+	Email     string `gorm:"index"`
+	BirthDate string
+	Address   *Address  `gorm:"serializer:json"`
+	Tags      []string  `gorm:"serializer:json"`
+	CreatedAt time.Time `gorm:"autoCreateTime:false"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime:false"`
+	Version   int64
+}
+
+func (personRecord) TableName() string {
+	return "people"
+}
+
+func (r *personRecord) person() *Person {
+	return &Person{
+		ID:        r.ID,
+		Name:      r.Name,
+		Email:     r.Email,
+		BirthDate: r.BirthDate,
+		Address:   r.Address,
+		Tags:      r.Tags,
+		CreatedAt: r.CreatedAt.UTC(),
+		UpdatedAt: r.UpdatedAt.UTC(),
+		Version:   r.Version,
+	}
+}
+
+// GormStore stores people in a SQL database through gorm, like Postgres.
+// When Versioned is set, Save only overwrites a Person whose stored version matches
+// the one being saved, and increments it.
+type GormStore struct {
+	DB        *gorm.DB
+	Versioned bool
+}
+
+// NewGormStore returns a GormStore using db.
+func NewGormStore(db *gorm.DB) (*GormStore, error) {
+	s := &GormStore{DB: db}
+	return s, s.validate()
+}
+
+func (s *GormStore) validate() error {
+	if s.DB == nil {
+		return errors.New("db is required")
+	}
+	return nil
+}
+
+// Migrate creates or updates the people table.
+func (s *GormStore) Migrate() error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	return s.DB.AutoMigrate(&personRecord{})
+}
+
+// Save validates and saves p, setting its timestamps.
+// Saving a Person without CreatedAt keeps the one stored, if any.
+// A versioned save of a Person with version 0 only succeeds if it doesn't exist yet.
+func (s *GormStore) Save(ctx context.Context, p *Person) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	next := *p
+	// Postgres keeps microseconds, so what is saved is what is read back
+	next.stamp(timestamp().Truncate(time.Microsecond))
+	if s.Versioned {
+		next.Version++
+	}
+	rec := &personRecord{
+		ID:        next.ID,
+		Name:      next.Name,
+		Email:     next.Email,
+		BirthDate: next.BirthDate,
+		Address:   next.Address,
+		Tags:      next.Tags,
+		CreatedAt: next.CreatedAt,
+		UpdatedAt: next.UpdatedAt,
+		Version:   next.Version,
+	}
+
+	db := s.DB.WithContext(ctx)
+	// without CreatedAt the stored one is kept, and read back into rec
+	keep := p.CreatedAt.IsZero()
+	if keep {
+		db = db.Clauses(clause.Returning{Columns: []clause.Column{{Name: "created_at"}}})
+	}
+	var result *gorm.DB
+	switch {
+	case !s.Versioned && keep:
+		result = db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns(updatedColumns),
+		}).Create(rec)
+	case !s.Versioned:
+		result = db.Clauses(clause.OnConflict{UpdateAll: true}).Create(rec)
+	case p.Version == 0:
+		result = db.Clauses(clause.OnConflict{DoNothing: true}).Create(rec)
+	case keep:
+		result = db.Model(&personRecord{}).Where("id = ? AND version = ?", p.ID, p.Version).Select("*").Omit("created_at").Updates(rec)
+	default:
+		result = db.Model(&personRecord{}).Where("id = ? AND version = ?", p.ID, p.Version).Select("*").Updates(rec)
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	if s.Versioned && result.RowsAffected == 0 {
+		return fmt.Errorf("%s at version %d: %w", p.ID, p.Version, ErrVersionConflict)
+	}
+	if keep {
+		next.CreatedAt = rec.CreatedAt.UTC()
+	}
+	*p = next
+	return nil
+}
+
+// updatedColumns are the columns saving an existing Person again overwrites, all but its ID and CreatedAt.
+var updatedColumns = []string{"name", "email", "birth_date", "address", "tags", "updated_at", "version"}
+
+// Get returns the Person with the given ID, or ErrNotFound.
+func (s *GormStore) Get(ctx context.Context, id string) (*Person, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	var rec personRecord
+	err := s.DB.WithContext(ctx).Where("id = ?", id).Take(&rec).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec.person(), nil
+}
+
+// Delete removes the Person with the given ID. Deleting a missing Person is not an error.
+func (s *GormStore) Delete(ctx context.Context, id string) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	return s.DB.WithContext(ctx).Where("id = ?", id).Delete(&personRecord{}).Error
+}
+
+// List returns every Person, ordered by ID.
+func (s *GormStore) List(ctx context.Context) ([]*Person, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	var recs []personRecord
+	if err := s.DB.WithContext(ctx).Order("id").Find(&recs).Error; err != nil {
+		return nil, err
+	}
+	people := make([]*Person, len(recs))
+	for i := range recs {
+		people[i] = recs[i].person()
+	}
+	return people, nil
+}
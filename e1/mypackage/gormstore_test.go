@@ -0,0 +1,96 @@
+package mypackage_test
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+	"github.com/testcontainers/testcontainers-go"
+	tpg "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var db *gorm.DB
+var runIntegrationTests = flag.Bool("integration", false, "run integration tests")
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	if *runIntegrationTests {
+		ctx := context.Background()
+		var err error
+
+		pgc, err := tpg.RunContainer(ctx,
+			testcontainers.WithImage("postgres:16-alpine"),
+			tpg.WithDatabase("test"),
+			tpg.WithUsername("user"),
+			tpg.WithPassword("password"),
+			testcontainers.WithWaitStrategy(
+				wait.ForLog("database system is ready to accept connections").
+					WithOccurrence(2).
+					WithStartupTimeout(5*time.Second)),
+		)
+		if err != nil {
+			slog.Error("failed to start postgres container", "error", err)
+			os.Exit(1)
+		}
+
+		defer pgc.Terminate(ctx) // nolint:errcheck
+
+		dsn, err := pgc.ConnectionString(ctx, "sslmode=disable")
+		if err != nil {
+			slog.Error("failed to get connection string", "error", err)
+			os.Exit(1)
+		}
+
+		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		if err != nil {
+			slog.Error("failed to connect to database", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestPersonStore_Gorm_Integration(t *testing.T) {
+	if !*runIntegrationTests {
+		t.Skip("skipping integration test")
+	}
+
+	newStore := func(t *testing.T) *mypackage.GormStore {
+		s, err := mypackage.NewGormStore(db)
+		if err != nil {
+			t.Fatalf("NewGormStore() error = %v", err)
+		}
+		if err := s.Migrate(); err != nil {
+			t.Fatalf("Migrate() error = %v", err)
+		}
+		// every test starts with an empty table
+		if err := db.Exec("TRUNCATE people").Error; err != nil {
+			t.Fatalf("failed to empty people: %v", err)
+		}
+		return s
+	}
+
+	testPersonStore(t, func(t *testing.T) mypackage.PersonStore {
+		s := newStore(t)
+		s.Versioned = true
+		return s
+	})
+	t.Run("save again unversioned", func(t *testing.T) {
+		testResave(t, newStore(t))
+	})
+}
+
+func TestNewGormStore(t *testing.T) {
+	if _, err := mypackage.NewGormStore(nil); err == nil {
+		t.Errorf("expected error for nil db")
+	}
+}
@@ -0,0 +1,356 @@
+package mypackage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// ExpiresAttribute holds when an idempotency record expires, in seconds since the epoch.
+// The idempotency table should have DynamoDB TTL enabled on it.
+const ExpiresAttribute = "Expires"
+
+const (
+	DefaultIdempotencyTTL = 24 * time.Hour
+	DefaultLease          = 30 * time.Second
+	DefaultPollInterval   = 50 * time.Millisecond
+)
+
+// ErrKeyReused is returned when an idempotency key is used again for a different Person.
+var ErrKeyReused = errors.New("idempotency key reused for a different person")
+
+const (
+	statusPending = "pending"
+	statusDone    = "done"
+)
+
+type ddbIdempotencyClient interface {
+	ddbClient
+	ddbGetter
+	ddbDeleter
+}
+
+// idempotencyRecord is what the idempotency table holds for a key, besides the key itself.
+type idempotencyRecord struct {
+	Status      string
+	Fingerprint string // of the Person first saved with the key
+	Owner       string // the call holding a pending key
+	LockedUntil int64  // when a pending key can be taken over, in milliseconds since the epoch
+	Expires     int64
+	Result      *Person `dynamodbav:",omitempty"`
+	Error       string  `dynamodbav:",omitempty"`
+}
+
+// ReplayedError is the version conflict the first Save with an idempotency key ran into.
+type ReplayedError struct {
+	Key     string
+	Message string
+}
+
+func (e *ReplayedError) Error() string {
+	return fmt.Sprintf("idempotency key %s: %s", e.Key, e.Message)
+}
+
+func (e *ReplayedError) Unwrap() []error {
+	return []error{ErrVersionConflict, ErrConditionFailed}
+}
+
+// IdempotentSaver saves a Person at most once per idempotency key, so clients can retry safely.
+// The first Save with a key records its outcome in Table, and later ones return it without writing.
+// Only successes and version conflicts are recorded; after any other failure the key can be used again.
+// Zero values for TTL, Lease and PollInterval use the defaults.
+type IdempotentSaver struct {
+	Saver  personSaver
+	Client ddbIdempotencyClient
+	// Table holds the keys. Its Encryption, if any, encrypts the people recorded as outcomes.
+	Table Table
+	// FingerprintKey is the HMAC key of the fingerprints recorded to tell whether a key is
+	// reused for a different Person, so they can't be used to confirm who was saved.
+	// It is required when Table is encrypted.
+	FingerprintKey []byte
+	// TTL is how long an outcome is kept.
+	TTL time.Duration
+	// Lease is how long a Save in progress holds its key before another can take it over,
+	// in case it never finishes.
+	Lease time.Duration
+	// PollInterval is how often a duplicate Save checks whether the first one finished.
+	PollInterval time.Duration
+}
+
+// NewIdempotentSaver returns an IdempotentSaver saving through saver and recording keys in table.
+func NewIdempotentSaver(saver personSaver, client ddbIdempotencyClient, table Table) (*IdempotentSaver, error) {
+	s := &IdempotentSaver{Saver: saver, Client: client, Table: table}
+	return s, s.validate()
+}
+
+func (s *IdempotentSaver) validate() error {
+	if s.Saver == nil {
+		return errors.New("saver is required")
+	}
+	if s.Client == nil {
+		return errors.New("client is required")
+	}
+	if s.Table.Encryption != nil && len(s.FingerprintKey) == 0 {
+		return errors.New("fingerprint key is required with an encrypted table")
+	}
+	return s.Table.validate()
+}
+
+// Save saves p unless a Save with the same key already did, in which case p is set to the
+// Person that was saved, or a *ReplayedError is returned for a version conflict.
+// While another Save with the key is in progress, it waits for its outcome.
+func (s *IdempotentSaver) Save(ctx context.Context, key string, p *Person) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	if key == "" {
+		return errors.New("idempotency key is required")
+	}
+	fingerprint, err := fingerprint(s.FingerprintKey, p)
+	if err != nil {
+		return err
+	}
+	poll := s.PollInterval
+	if poll <= 0 {
+		poll = DefaultPollInterval
+	}
+
+	for {
+		owner, err := s.claim(ctx, key, fingerprint)
+		if err == nil {
+			return s.save(ctx, key, owner, fingerprint, p)
+		}
+		if !errors.Is(err, ErrConditionFailed) {
+			return err
+		}
+
+		rec, err := s.get(ctx, key)
+		if err != nil {
+			return err
+		}
+		switch {
+		case rec == nil:
+			// released or expired since, so try claiming it again
+			continue
+		case rec.Fingerprint != fingerprint:
+			return fmt.Errorf("%s: %w", key, ErrKeyReused)
+		case rec.Status == statusDone && rec.Error != "":
+			return &ReplayedError{Key: key, Message: rec.Error}
+		case rec.Status == statusDone:
+			*p = *rec.Result
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(poll):
+		}
+	}
+}
+
+// fingerprint tells whether two saves with the same key save the same Person.
+// It is an HMAC under key, unless key is empty.
+func fingerprint(key []byte, p *Person) (string, error) {
+	item, err := dynamodbattribute.MarshalMap(p)
+	if err != nil {
+		return "", marshalError("person "+p.ID, err)
+	}
+	// maps marshal to JSON with sorted keys, so equal people give equal fingerprints
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return "", marshalError("person "+p.ID, err)
+	}
+	if len(key) == 0 {
+		sum := sha256.Sum256(raw)
+		return hex.EncodeToString(sum[:]), nil
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(raw)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (s *IdempotentSaver) ttl() time.Duration {
+	if s.TTL <= 0 {
+		return DefaultIdempotencyTTL
+	}
+	return s.TTL
+}
+
+// claim records key as pending, unless it is recorded already, and returns the owner token
+// needed to complete or release it.
+func (s *IdempotentSaver) claim(ctx context.Context, key, fingerprint string) (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	owner := hex.EncodeToString(token)
+
+	lease := s.Lease
+	if lease <= 0 {
+		lease = DefaultLease
+	}
+	now := time.Now()
+	rec := &idempotencyRecord{
+		Status:      statusPending,
+		Fingerprint: fingerprint,
+		Owner:       owner,
+		LockedUntil: now.Add(lease).UnixMilli(),
+		Expires:     now.Add(s.ttl()).Unix(),
+	}
+	item, err := s.item(key, rec)
+	if err != nil {
+		return "", err
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName:           aws.String(s.Table.Name),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#key) OR #expires < :now OR (#status = :pending AND #locked < :nowms)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#key":     aws.String(s.Table.partitionKey()),
+			"#expires": aws.String(ExpiresAttribute),
+			"#status":  aws.String("Status"),
+			"#locked":  aws.String("LockedUntil"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now":     {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+			":nowms":   {N: aws.String(strconv.FormatInt(now.UnixMilli(), 10))},
+			":pending": {S: aws.String(statusPending)},
+		},
+	}
+	if _, err := s.Client.PutItemWithContext(ctx, input); err != nil {
+		return "", wrapErr("PutItem", err)
+	}
+	return owner, nil
+}
+
+// save saves p under a claimed key and records the outcome, or releases the key if nothing was saved.
+func (s *IdempotentSaver) save(ctx context.Context, key, owner, fingerprint string, p *Person) error {
+	saveErr := s.Saver.Save(ctx, p)
+
+	// the outcome is recorded even if the caller gave up waiting for it
+	ctx = context.WithoutCancel(ctx)
+	if saveErr != nil && !errors.Is(saveErr, ErrVersionConflict) {
+		// the key expires by itself if this fails
+		_ = s.release(ctx, key, owner)
+		return saveErr
+	}
+
+	rec := &idempotencyRecord{
+		Status:      statusDone,
+		Fingerprint: fingerprint,
+		Owner:       owner,
+		Expires:     time.Now().Add(s.ttl()).Unix(),
+	}
+	if saveErr != nil {
+		rec.Error = saveErr.Error()
+	} else {
+		saved := *p
+		rec.Result = &saved
+	}
+	if err := s.complete(ctx, key, owner, rec); err != nil && saveErr == nil {
+		return fmt.Errorf("saved %s, but failed to record idempotency key %s: %w", p.ID, key, err)
+	}
+	return saveErr
+}
+
+func (s *IdempotentSaver) owned(owner string) (*string, map[string]*string, map[string]*dynamodb.AttributeValue) {
+	return aws.String("#owner = :owner"),
+		map[string]*string{"#owner": aws.String("Owner")},
+		map[string]*dynamodb.AttributeValue{":owner": {S: aws.String(owner)}}
+}
+
+func (s *IdempotentSaver) complete(ctx context.Context, key, owner string, rec *idempotencyRecord) error {
+	item, err := s.item(key, rec)
+	if err != nil {
+		return err
+	}
+	cond, names, values := s.owned(owner)
+	input := &dynamodb.PutItemInput{
+		TableName:                 aws.String(s.Table.Name),
+		Item:                      item,
+		ConditionExpression:       cond,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+	_, err = s.Client.PutItemWithContext(ctx, input)
+	return wrapErr("PutItem", err)
+}
+
+func (s *IdempotentSaver) release(ctx context.Context, key, owner string) error {
+	cond, names, values := s.owned(owner)
+	input := &dynamodb.DeleteItemInput{
+		TableName:                 aws.String(s.Table.Name),
+		Key:                       s.Table.key(key),
+		ConditionExpression:       cond,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+	_, err := s.Client.DeleteItemWithContext(ctx, input)
+	return wrapErr("DeleteItem", err)
+}
+
+// get returns the record of key, or nil if there is none that hasn't expired.
+func (s *IdempotentSaver) get(ctx context.Context, key string) (*idempotencyRecord, error) {
+	input := &dynamodb.GetItemInput{
+		TableName:      aws.String(s.Table.Name),
+		Key:            s.Table.key(key),
+		ConsistentRead: aws.Bool(true),
+	}
+	output, err := s.Client.GetItemWithContext(ctx, input)
+	if err != nil {
+		return nil, wrapErr("GetItem", err)
+	}
+	if len(output.Item) == 0 {
+		return nil, nil
+	}
+
+	item := output.Item
+	if result := item["Result"]; result != nil && result.M != nil && s.Table.Encryption != nil {
+		decrypted, err := s.Table.Encryption.decryptItem(result.M)
+		if err != nil {
+			return nil, fmt.Errorf("idempotency key %s: %w", key, err)
+		}
+		item = make(map[string]*dynamodb.AttributeValue, len(output.Item))
+		for attr, v := range output.Item {
+			item[attr] = v
+		}
+		item["Result"] = &dynamodb.AttributeValue{M: decrypted}
+	}
+
+	var rec idempotencyRecord
+	if err := dynamodbattribute.UnmarshalMap(item, &rec); err != nil {
+		return nil, unmarshalError("idempotency key "+key, err)
+	}
+	// DynamoDB deletes expired items eventually, not right away
+	if rec.Expires < time.Now().Unix() {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (s *IdempotentSaver) item(key string, rec *idempotencyRecord) (map[string]*dynamodb.AttributeValue, error) {
+	item, err := dynamodbattribute.MarshalMap(rec)
+	if err != nil {
+		return nil, marshalError("idempotency key "+key, err)
+	}
+	if result := item["Result"]; result != nil && result.M != nil && s.Table.Encryption != nil {
+		if err := s.Table.Encryption.encryptItem(result.M); err != nil {
+			return nil, fmt.Errorf("idempotency key %s: %w", key, err)
+		}
+	}
+	item[s.Table.partitionKey()] = &dynamodb.AttributeValue{S: aws.String(key)}
+	return item, nil
+}
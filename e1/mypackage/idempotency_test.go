@@ -0,0 +1,210 @@
+package mypackage_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+	"github.com/idiomat/dodtnyt/e1/mypackage/ddbfake"
+)
+
+var keys = mypackage.Table{Name: "idempotency", PartitionKey: "Key"}
+
+// writesPeople tells whether input is a DynamoDBSaver writing to the people table.
+func writesPeople(input interface{}) bool {
+	switch in := input.(type) {
+	case *dynamodb.PutItemInput:
+		return aws.StringValue(in.TableName) == "people"
+	case *dynamodb.UpdateItemInput:
+		return aws.StringValue(in.TableName) == "people"
+	}
+	return false
+}
+
+// newIdempotentSaver returns a saver over a fake, counting the people it writes.
+func newIdempotentSaver(t *testing.T) (*mypackage.IdempotentSaver, *ddbfake.Fake, *int64) {
+	t.Helper()
+	fake := ddbfake.New()
+	for name, pk := range map[string]string{"people": "ID", "idempotency": "Key"} {
+		if err := fake.CreateTable(name, pk, ""); err != nil {
+			t.Fatalf("CreateTable() error = %v", err)
+		}
+	}
+	var writes int64
+	fake.Hook = func(op string, input interface{}) error {
+		if writesPeople(input) {
+			atomic.AddInt64(&writes, 1)
+			time.Sleep(5 * time.Millisecond) // leaves time for duplicates to arrive
+		}
+		return nil
+	}
+
+	saver := &mypackage.DynamoDBSaver{Client: fake, Table: table, Versioned: true}
+	s, err := mypackage.NewIdempotentSaver(saver, fake, keys)
+	if err != nil {
+		t.Fatalf("NewIdempotentSaver() error = %v", err)
+	}
+	s.PollInterval = time.Millisecond
+	return s, fake, &writes
+}
+
+func TestIdempotentSaver_Save(t *testing.T) {
+	s, _, writes := newIdempotentSaver(t)
+	ctx := context.Background()
+
+	first := &mypackage.Person{ID: "p1", Name: "Johnny"}
+	if err := s.Save(ctx, "k1", first); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// a retry of the same request gets the same outcome instead of a version conflict
+	retry := &mypackage.Person{ID: "p1", Name: "Johnny"}
+	if err := s.Save(ctx, "k1", retry); err != nil {
+		t.Fatalf("Save() retry error = %v", err)
+	}
+	if !reflect.DeepEqual(retry, first) || retry.Version != 1 {
+		t.Errorf("expected the retry to get %+v but got %+v", first, retry)
+	}
+	if got := atomic.LoadInt64(writes); got != 1 {
+		t.Errorf("expected 1 write but got %d", got)
+	}
+
+	if err := s.Save(ctx, "k1", &mypackage.Person{ID: "p1", Name: "Jane"}); !errors.Is(err, mypackage.ErrKeyReused) {
+		t.Errorf("expected %v but got %v", mypackage.ErrKeyReused, err)
+	}
+
+	// a version conflict is replayed too
+	stale := &mypackage.Person{ID: "p1", Name: "Stale", Version: 7}
+	if err := s.Save(ctx, "k2", stale); !errors.Is(err, mypackage.ErrVersionConflict) {
+		t.Fatalf("expected %v but got %v", mypackage.ErrVersionConflict, err)
+	}
+	err := s.Save(ctx, "k2", &mypackage.Person{ID: "p1", Name: "Stale", Version: 7})
+	var replayed *mypackage.ReplayedError
+	if !errors.As(err, &replayed) || !errors.Is(err, mypackage.ErrVersionConflict) {
+		t.Errorf("expected a replayed version conflict but got %v", err)
+	}
+	if got := atomic.LoadInt64(writes); got != 2 {
+		t.Errorf("expected 2 writes but got %d", got)
+	}
+}
+
+func TestIdempotentSaver_SaveFailed(t *testing.T) {
+	s, fake, writes := newIdempotentSaver(t)
+	ctx := context.Background()
+
+	countWrites := fake.Hook
+	fake.Hook = func(op string, input interface{}) error {
+		if writesPeople(input) {
+			return awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil)
+		}
+		return nil
+	}
+	if err := s.Save(ctx, "k1", &mypackage.Person{ID: "p1", Name: "Johnny"}); !errors.Is(err, mypackage.ErrThrottled) {
+		t.Fatalf("expected %v but got %v", mypackage.ErrThrottled, err)
+	}
+
+	// nothing was saved, so the retry saves
+	fake.Hook = countWrites
+	p := &mypackage.Person{ID: "p1", Name: "Johnny"}
+	if err := s.Save(ctx, "k1", p); err != nil {
+		t.Fatalf("Save() retry error = %v", err)
+	}
+	if got := atomic.LoadInt64(writes); got != 1 || p.Version != 1 {
+		t.Errorf("expected the retry to save once but got %d writes and version %d", got, p.Version)
+	}
+}
+
+func TestIdempotentSaver_SaveConcurrently(t *testing.T) {
+	s, _, writes := newIdempotentSaver(t)
+
+	var wg sync.WaitGroup
+	results := make([]*mypackage.Person, 10)
+	errs := make([]error, len(results))
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = &mypackage.Person{ID: "p1", Name: "Johnny"}
+			errs[i] = s.Save(context.Background(), "k1", results[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Save() %d error = %v", i, err)
+		}
+		if results[i].Version != 1 {
+			t.Errorf("expected Save() %d to see version 1 but got %d", i, results[i].Version)
+		}
+	}
+	if got := atomic.LoadInt64(writes); got != 1 {
+		t.Errorf("expected 1 write but got %d", got)
+	}
+}
+
+func TestIdempotentSaver_SavePending(t *testing.T) {
+	tests := map[string]struct {
+		lockedFor time.Duration // how long the abandoned key stays locked
+		wantErr   error
+	}{
+		"lease expired":     {lockedFor: -time.Second},
+		"still in progress": {lockedFor: time.Hour, wantErr: context.DeadlineExceeded},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, fake, _ := newIdempotentSaver(t)
+			ctx := context.Background()
+
+			// turn a finished Save into one that never got to save
+			want := &mypackage.Person{ID: "p1", Name: "Johnny"}
+			if err := s.Save(ctx, "k1", &mypackage.Person{ID: "p1", Name: "Johnny"}); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			if _, err := fake.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{TableName: aws.String("people"), Key: map[string]*dynamodb.AttributeValue{"ID": {S: aws.String("p1")}}}); err != nil {
+				t.Fatalf("DeleteItem() error = %v", err)
+			}
+			items, _ := fake.Items("idempotency")
+			pending := items[0]
+			pending["Status"] = &dynamodb.AttributeValue{S: aws.String("pending")}
+			pending["LockedUntil"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(time.Now().Add(tc.lockedFor).UnixMilli(), 10))}
+			delete(pending, "Result")
+			if _, err := fake.PutItemWithContext(ctx, &dynamodb.PutItemInput{TableName: aws.String("idempotency"), Item: pending}); err != nil {
+				t.Fatalf("PutItem() error = %v", err)
+			}
+
+			timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+			defer cancel()
+			if err := s.Save(timeout, "k1", want); !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v but got %v", tc.wantErr, err)
+			}
+			if tc.wantErr == nil && want.Version != 1 {
+				t.Errorf("expected the key to be taken over and p1 saved but got version %d", want.Version)
+			}
+		})
+	}
+}
+
+func TestNewIdempotentSaver(t *testing.T) {
+	saver := &mypackage.DynamoDBSaver{Client: &testClient{}, Table: table}
+
+	if _, err := mypackage.NewIdempotentSaver(nil, ddbfake.New(), keys); err == nil {
+		t.Errorf("expected error for nil saver")
+	}
+	if _, err := mypackage.NewIdempotentSaver(saver, nil, keys); err == nil {
+		t.Errorf("expected error for nil client")
+	}
+	if _, err := mypackage.NewIdempotentSaver(saver, ddbfake.New(), mypackage.Table{}); err == nil {
+		t.Errorf("expected error for missing table")
+	}
+}
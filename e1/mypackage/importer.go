@@ -0,0 +1,352 @@
+package mypackage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// DefaultImportBatchSize is how many people an Importer saves at once.
+const DefaultImportBatchSize = 100
+
+// personBatchSaver is what an Importer saves people with, like DynamoDBBatchSaver.
+type personBatchSaver interface {
+	SaveAll(ctx context.Context, people []*Person) error
+}
+
+// ImportConfig configures an Importer. Zero values use the defaults.
+type ImportConfig struct {
+	// DryRun only validates people, without saving them or recording progress.
+	DryRun bool
+	// BatchSize is how many people are saved at once.
+	BatchSize int
+	// Progress records how many records were imported under the name Source,
+	// so an interrupted import resumes after them.
+	Progress Checkpointer
+	Source   string
+	// Report gets a JSON line for every record that failed, as written by ImportFailure.
+	Report io.Writer
+}
+
+// ImportFailure is a line of the report of an import.
+type ImportFailure struct {
+	Record int
+	ID     string `json:",omitempty"`
+	Error  string
+}
+
+// ImportResult counts what an import did with the records it read.
+type ImportResult struct {
+	Skipped  int // imported before, according to the progress
+	Imported int // saved, or valid in a dry run
+	Failed   int
+}
+
+// Importer saves the people of a bulk file in batches.
+// Records that can't be read or saved are reported and skipped, so one bad record doesn't stop an import.
+type Importer struct {
+	saver    personBatchSaver
+	dryRun   bool
+	batch    int
+	progress Checkpointer
+	source   string
+	report   io.Writer
+}
+
+// NewImporter returns an Importer saving people with saver, which is only optional for a dry run.
+func NewImporter(saver personBatchSaver, cfg ImportConfig) (*Importer, error) {
+	im := &Importer{
+		saver:    saver,
+		dryRun:   cfg.DryRun,
+		batch:    cfg.BatchSize,
+		progress: cfg.Progress,
+		source:   cfg.Source,
+		report:   cfg.Report,
+	}
+	if im.batch == 0 {
+		im.batch = DefaultImportBatchSize
+	}
+	return im, im.validate()
+}
+
+func (im *Importer) validate() error {
+	if im.saver == nil && !im.dryRun {
+		return errors.New("saver is required")
+	}
+	if im.batch < 1 {
+		return fmt.Errorf("invalid batch size: %d", im.batch)
+	}
+	if im.progress != nil && im.source == "" {
+		return errors.New("source is required to record progress")
+	}
+	return nil
+}
+
+// Import reads every Person from r and saves them, resuming after the records the progress
+// says were imported already. Progress is recorded after each batch, including the records
+// that failed on their own, e.g. by being invalid, so they aren't retried when resuming; those
+// failing after the last batch saved before an interruption are reported again.
+// It stops at the first error that isn't about a single record, such as a batch failing as a whole,
+// having recorded the progress up to the first record that wasn't saved because of it.
+func (im *Importer) Import(ctx context.Context, r PersonReader) (*ImportResult, error) {
+	skip, err := im.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	var (
+		record  int
+		batch   = make([]*Person, 0, im.batch)
+		records = make(map[*Person]int, im.batch) // of the people in batch
+		ids     = make(map[string]bool, im.batch)
+	)
+	fail := func(err *RecordError) error {
+		result.Failed++
+		if im.report == nil {
+			return nil
+		}
+		line, err2 := json.Marshal(ImportFailure{Record: err.Record, ID: err.ID, Error: err.Err.Error()})
+		if err2 != nil {
+			return err2
+		}
+		_, err2 = im.report.Write(append(line, '\n'))
+		return err2
+	}
+	// flush saves batch, and records that the first done records were imported
+	flush := func(done int) error {
+		var stopErr error
+		if len(batch) > 0 {
+			err := im.saver.SaveAll(ctx, batch)
+			var bErr *BatchError
+			if err != nil && !errors.As(err, &bErr) {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				// the people that weren't saved failed because of it, so they're imported again when resuming
+				return err
+			}
+			result.Imported += len(batch)
+			if bErr != nil {
+				// people failing for a reason other than themselves, e.g. throttling, must be saved
+				// when resuming, so the progress stops before the first of them
+				stop := 0
+				for _, f := range bErr.Failed {
+					if rec := records[f.Person]; !recordFailure(f.Err) && (stop == 0 || rec < stop) {
+						stop, stopErr = rec, fmt.Errorf("record %d: %w", rec, f)
+					}
+				}
+				result.Imported -= len(bErr.Failed)
+				for _, f := range bErr.Failed {
+					if stop != 0 && records[f.Person] >= stop {
+						continue
+					}
+					if err := fail(&RecordError{Record: records[f.Person], ID: f.Person.ID, Err: f.Err}); err != nil {
+						return err
+					}
+				}
+				if stop != 0 {
+					done = stop - 1
+				}
+			}
+			batch = batch[:0]
+			clear(records)
+			clear(ids)
+		}
+		if im.progress == nil || done <= skip {
+			return stopErr
+		}
+		// recorded even if ctx is done, since the batch was saved
+		if err := im.progress.Checkpoint(context.WithoutCancel(ctx), im.source, strconv.Itoa(done)); err != nil {
+			return err
+		}
+		return stopErr
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		p, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var rErr *RecordError
+		if err != nil && !errors.As(err, &rErr) {
+			return result, err
+		}
+		record++
+		if record <= skip {
+			result.Skipped++
+			continue
+		}
+		if rErr != nil {
+			if err := fail(rErr); err != nil {
+				return result, err
+			}
+			continue
+		}
+
+		if im.dryRun {
+			if err := p.Validate(); err != nil {
+				if err := fail(&RecordError{Record: record, ID: p.ID, Err: err}); err != nil {
+					return result, err
+				}
+				continue
+			}
+			result.Imported++
+			continue
+		}
+
+		// DynamoDB rejects a batch writing the same item twice
+		if ids[p.ID] {
+			if err := flush(record - 1); err != nil {
+				return result, err
+			}
+		}
+		batch = append(batch, p)
+		records[p] = record
+		ids[p.ID] = true
+		if len(batch) == im.batch {
+			if err := flush(record); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	if im.dryRun {
+		return result, nil
+	}
+	return result, flush(record)
+}
+
+// recordFailure reports whether err is about the Person itself, so saving it again would fail too.
+func recordFailure(err error) bool {
+	var vErr *ValidationError
+	var mErr *MarshalError
+	return errors.As(err, &vErr) || errors.As(err, &mErr)
+}
+
+// start returns how many records were imported before.
+func (im *Importer) start(ctx context.Context) (int, error) {
+	if im.progress == nil || im.dryRun {
+		return 0, nil
+	}
+	last, err := im.progress.LastCheckpoint(ctx, im.source)
+	if err != nil || last == "" {
+		return 0, err
+	}
+	skip, err := strconv.Atoi(last)
+	if err != nil {
+		return 0, fmt.Errorf("invalid progress of %s: %q", im.source, last)
+	}
+	return skip, nil
+}
+
+// Export writes every Person of it to w a page at a time, and returns how many it wrote.
+func Export(ctx context.Context, it *PersonIterator, w PersonWriter) (int, error) {
+	var n int
+	for {
+		page, err := it.Next(ctx)
+		if errors.Is(err, ErrDone) {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		for _, p := range page {
+			if err := w.Write(p); err != nil {
+				return n, err
+			}
+		}
+		n += len(page)
+	}
+	return n, w.Flush()
+}
+
+// FileCheckpoints is a Checkpointer keeping checkpoints in a JSON file, which is replaced
+// whole on every checkpoint so a crash can't leave it half written.
+type FileCheckpoints struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewFileCheckpoints returns a FileCheckpoints keeping checkpoints in the file at path,
+// which is created by the first checkpoint.
+func NewFileCheckpoints(path string) (*FileCheckpoints, error) {
+	c := &FileCheckpoints{Path: path}
+	return c, c.validate()
+}
+
+func (c *FileCheckpoints) validate() error {
+	if c.Path == "" {
+		return errors.New("path is required")
+	}
+	return nil
+}
+
+func (c *FileCheckpoints) load() (map[string]string, error) {
+	data, err := os.ReadFile(c.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seq := map[string]string{}
+	if err := json.Unmarshal(data, &seq); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file %s: %w", c.Path, err)
+	}
+	return seq, nil
+}
+
+func (c *FileCheckpoints) Checkpoint(ctx context.Context, shard, seq string) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	checkpoints, err := c.load()
+	if err != nil {
+		return err
+	}
+	checkpoints[shard] = seq
+	data, err := json.Marshal(checkpoints)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.Path), filepath.Base(c.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := errors.Join(tmp.Sync(), tmp.Close()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.Path)
+}
+
+func (c *FileCheckpoints) LastCheckpoint(ctx context.Context, shard string) (string, error) {
+	if err := c.validate(); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	checkpoints, err := c.load()
+	if err != nil {
+		return "", err
+	}
+	return checkpoints[shard], nil
+}
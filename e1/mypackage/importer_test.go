@@ -0,0 +1,353 @@
+package mypackage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+)
+
+// storedNames returns the name of every Person in the people table by ID.
+func storedNames(t *testing.T, repo *mypackage.PersonRepository) map[string]string {
+	t.Helper()
+	people, err := repo.List(context.Background())
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	names := make(map[string]string, len(people))
+	for _, p := range people {
+		names[p.ID] = p.Name
+	}
+	return names
+}
+
+func TestImporter_Import(t *testing.T) {
+	tests := map[string]struct {
+		in         string
+		dryRun     bool
+		batch      int
+		want       mypackage.ImportResult
+		wantStored map[string]string
+		wantReport string
+	}{
+		"imports": {
+			in:         "{\"ID\":\"p1\",\"Name\":\"Johnny\"}\n{\"ID\":\"p2\",\"Name\":\"Mary\"}\n{\"ID\":\"p3\",\"Name\":\"Ann\"}\n",
+			batch:      2,
+			want:       mypackage.ImportResult{Imported: 3},
+			wantStored: map[string]string{"p1": "Johnny", "p2": "Mary", "p3": "Ann"},
+		},
+		"reports failures": {
+			in:         "{\"ID\":\"p1\",\"Name\":\"Johnny\"}\n{\"ID\":\"p2\",\"Nickname\":\"M\"}\n{\"ID\":\"p3\"}\n",
+			want:       mypackage.ImportResult{Imported: 1, Failed: 2},
+			wantStored: map[string]string{"p1": "Johnny"},
+			wantReport: `{"Record":2,"Error":"json: unknown field \"Nickname\""}` + "\n" +
+				`{"Record":3,"ID":"p3","Error":"invalid person p3: Name: is required"}` + "\n",
+		},
+		"repeated ID": {
+			in:         "{\"ID\":\"p1\",\"Name\":\"Johnny\"}\n{\"ID\":\"p1\",\"Name\":\"John\"}\n",
+			want:       mypackage.ImportResult{Imported: 2},
+			wantStored: map[string]string{"p1": "John"},
+		},
+		"dry run": {
+			in:         "{\"ID\":\"p1\",\"Name\":\"Johnny\"}\n{\"ID\":\"p2\",\"Email\":\"mary\"}\n",
+			dryRun:     true,
+			want:       mypackage.ImportResult{Imported: 1, Failed: 1},
+			wantStored: map[string]string{},
+			wantReport: `{"Record":2,"ID":"p2","Error":"invalid person p2: Name: is required; Email: not a valid email address"}` + "\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo, err := mypackage.NewPersonRepository(newPeopleFake(t), mypackage.Table{Name: "people"})
+			if err != nil {
+				t.Fatalf("NewPersonRepository() error = %v", err)
+			}
+			var report bytes.Buffer
+			im, err := mypackage.NewImporter(repo, mypackage.ImportConfig{DryRun: tc.dryRun, BatchSize: tc.batch, Report: &report})
+			if err != nil {
+				t.Fatalf("NewImporter() error = %v", err)
+			}
+
+			got, err := im.Import(context.Background(), mypackage.NewJSONLReader(strings.NewReader(tc.in)))
+			if err != nil {
+				t.Fatalf("Import() error = %v", err)
+			}
+			if *got != tc.want {
+				t.Errorf("Import() = %+v, want %+v", *got, tc.want)
+			}
+			if stored := storedNames(t, repo); !reflect.DeepEqual(stored, tc.wantStored) {
+				t.Errorf("stored %v, want %v", stored, tc.wantStored)
+			}
+			if report.String() != tc.wantReport {
+				t.Errorf("report = %q, want %q", report.String(), tc.wantReport)
+			}
+		})
+	}
+}
+
+func TestImporter_Resume(t *testing.T) {
+	fake := newPeopleFake(t)
+	repo, err := mypackage.NewPersonRepository(fake, mypackage.Table{Name: "people"})
+	if err != nil {
+		t.Fatalf("NewPersonRepository() error = %v", err)
+	}
+	progress, err := mypackage.NewFileCheckpoints(filepath.Join(t.TempDir(), "progress.json"))
+	if err != nil {
+		t.Fatalf("NewFileCheckpoints() error = %v", err)
+	}
+	cfg := mypackage.ImportConfig{BatchSize: 2, Progress: progress, Source: "people.csv"}
+	in := "ID,Name\np1,Johnny\np2,\np3,Mary\np4,Ann\np5,Bob\n"
+
+	// every batch after the first fails
+	var batches int
+	fake.Hook = func(op string, input interface{}) error {
+		if op != "BatchWriteItem" {
+			return nil
+		}
+		if batches++; batches > 1 {
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+	im, err := mypackage.NewImporter(repo, cfg)
+	if err != nil {
+		t.Fatalf("NewImporter() error = %v", err)
+	}
+	r, _ := mypackage.NewCSVReader(strings.NewReader(in), nil)
+	// the batch failing as a whole stops the import before its first record,
+	// while the invalid p2 is only reported
+	got, err := im.Import(context.Background(), r)
+	if err == nil || !strings.Contains(err.Error(), "record 3") {
+		t.Fatalf("Import() error = %v, want the failure of record 3", err)
+	}
+	if want := (mypackage.ImportResult{Imported: 1, Failed: 1}); *got != want {
+		t.Fatalf("Import() = %+v, want %+v", *got, want)
+	}
+	if last, _ := progress.LastCheckpoint(context.Background(), "people.csv"); last != "2" {
+		t.Errorf("progress = %q, want 2", last)
+	}
+
+	// a fresh import of the file resumes after the progress, saving the batch that failed
+	fake.Hook = nil
+	r, _ = mypackage.NewCSVReader(strings.NewReader(in+"p6,Eve\n"), nil)
+	if got, err = im.Import(context.Background(), r); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if want := (mypackage.ImportResult{Skipped: 2, Imported: 4}); *got != want {
+		t.Errorf("Import() = %+v, want %+v", *got, want)
+	}
+	want := map[string]string{"p1": "Johnny", "p3": "Mary", "p4": "Ann", "p5": "Bob", "p6": "Eve"}
+	if !reflect.DeepEqual(storedNames(t, repo), want) {
+		t.Errorf("stored %v, want %v", storedNames(t, repo), want)
+	}
+}
+
+func TestImporter_ResumeUnprocessed(t *testing.T) {
+	fake := newPeopleFake(t)
+	repo, err := mypackage.NewPersonRepository(fake, mypackage.Table{Name: "people"})
+	if err != nil {
+		t.Fatalf("NewPersonRepository() error = %v", err)
+	}
+	repo.DynamoDBBatchSaver.Retries = 1
+	repo.DynamoDBBatchSaver.Backoff = time.Millisecond
+	progress := &mypackage.MemoryCheckpoints{}
+	im, err := mypackage.NewImporter(repo, mypackage.ImportConfig{BatchSize: 2, Progress: progress, Source: "people.csv"})
+	if err != nil {
+		t.Fatalf("NewImporter() error = %v", err)
+	}
+	in := "ID,Name\np1,Johnny\np2,Mary\np3,Ann\np4,Bob\np5,Eve\n"
+
+	// p4 is left unprocessed however often it is resent
+	fake.Unprocessed = func(_ string, req *dynamodb.WriteRequest) bool {
+		return aws.StringValue(req.PutRequest.Item["ID"].S) == "p4"
+	}
+	r, _ := mypackage.NewCSVReader(strings.NewReader(in), nil)
+	got, err := im.Import(context.Background(), r)
+	if !errors.Is(err, mypackage.ErrUnprocessed) {
+		t.Fatalf("Import() error = %v, want %v", err, mypackage.ErrUnprocessed)
+	}
+	if want := (mypackage.ImportResult{Imported: 3}); *got != want {
+		t.Errorf("Import() = %+v, want %+v", *got, want)
+	}
+	if last, _ := progress.LastCheckpoint(context.Background(), "people.csv"); last != "3" {
+		t.Errorf("progress = %q, want 3", last)
+	}
+
+	fake.Unprocessed = nil
+	r, _ = mypackage.NewCSVReader(strings.NewReader(in), nil)
+	if got, err = im.Import(context.Background(), r); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if want := (mypackage.ImportResult{Skipped: 3, Imported: 2}); *got != want {
+		t.Errorf("Import() = %+v, want %+v", *got, want)
+	}
+	if names := storedNames(t, repo); names["p4"] != "Bob" || len(names) != 5 {
+		t.Errorf("stored %v, want p1 to p5", names)
+	}
+}
+
+// failingSaver fails every save after the first `ok`.
+type failingSaver struct {
+	ok    int
+	saved []string
+}
+
+func (s *failingSaver) SaveAll(ctx context.Context, people []*mypackage.Person) error {
+	if s.ok == 0 {
+		return errors.New("table is gone")
+	}
+	s.ok--
+	for _, p := range people {
+		s.saved = append(s.saved, p.ID)
+	}
+	return nil
+}
+
+func TestImporter_ResumeAfterError(t *testing.T) {
+	in := "{\"ID\":\"p1\",\"Name\":\"Johnny\"}\n{\"ID\":\"p2\",\"Name\":\"Mary\"}\n{\"ID\":\"p3\",\"Name\":\"Ann\"}\n"
+	progress := &mypackage.MemoryCheckpoints{}
+	saver := &failingSaver{ok: 1}
+	im, err := mypackage.NewImporter(saver, mypackage.ImportConfig{BatchSize: 2, Progress: progress, Source: "people.jsonl"})
+	if err != nil {
+		t.Fatalf("NewImporter() error = %v", err)
+	}
+
+	got, err := im.Import(context.Background(), mypackage.NewJSONLReader(strings.NewReader(in)))
+	if err == nil || err.Error() != "table is gone" {
+		t.Fatalf("Import() error = %v, want table is gone", err)
+	}
+	if want := (mypackage.ImportResult{Imported: 2}); *got != want {
+		t.Errorf("Import() = %+v, want %+v", *got, want)
+	}
+
+	saver.ok = 1
+	if got, err = im.Import(context.Background(), mypackage.NewJSONLReader(strings.NewReader(in))); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if want := (mypackage.ImportResult{Skipped: 2, Imported: 1}); *got != want {
+		t.Errorf("Import() = %+v, want %+v", *got, want)
+	}
+	if want := []string{"p1", "p2", "p3"}; !reflect.DeepEqual(saver.saved, want) {
+		t.Errorf("saved %v, want %v", saver.saved, want)
+	}
+}
+
+func TestNewImporter(t *testing.T) {
+	tests := map[string]struct {
+		saver   *failingSaver
+		cfg     mypackage.ImportConfig
+		wantErr string
+	}{
+		"valid": {
+			saver: &failingSaver{},
+		},
+		"dry run without saver": {
+			cfg: mypackage.ImportConfig{DryRun: true},
+		},
+		"missing saver": {
+			wantErr: "saver is required",
+		},
+		"invalid batch size": {
+			saver:   &failingSaver{},
+			cfg:     mypackage.ImportConfig{BatchSize: -1},
+			wantErr: "invalid batch size: -1",
+		},
+		"progress without source": {
+			saver:   &failingSaver{},
+			cfg:     mypackage.ImportConfig{Progress: &mypackage.MemoryCheckpoints{}},
+			wantErr: "source is required to record progress",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var err error
+			if tc.saver != nil {
+				_, err = mypackage.NewImporter(tc.saver, tc.cfg)
+			} else {
+				_, err = mypackage.NewImporter(nil, tc.cfg)
+			}
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("NewImporter() error = %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr) {
+				t.Fatalf("NewImporter() error = %v, want %s", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExport(t *testing.T) {
+	repo, err := mypackage.NewPersonRepository(newPeopleFake(t), mypackage.Table{Name: "people"})
+	if err != nil {
+		t.Fatalf("NewPersonRepository() error = %v", err)
+	}
+	want := people(5)
+	if err := repo.SaveAll(context.Background(), want); err != nil {
+		t.Fatalf("SaveAll() error = %v", err)
+	}
+
+	it, err := repo.Scan(mypackage.ScanOptions{PageOptions: mypackage.PageOptions{PageSize: 2}})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	var buf bytes.Buffer
+	n, err := mypackage.Export(context.Background(), it, mypackage.NewJSONLWriter(&buf))
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if n != len(want) {
+		t.Errorf("Export() = %d, want %d", n, len(want))
+	}
+
+	got, err := readRecords(mypackage.NewJSONLReader(&buf))
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	sort.Strings(got)
+	if ids := []string{"p0", "p1", "p2", "p3", "p4"}; !reflect.DeepEqual(got, ids) {
+		t.Errorf("exported %v, want %v", got, ids)
+	}
+}
+
+func TestFileCheckpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+	c, err := mypackage.NewFileCheckpoints(path)
+	if err != nil {
+		t.Fatalf("NewFileCheckpoints() error = %v", err)
+	}
+	ctx := context.Background()
+	if last, err := c.LastCheckpoint(ctx, "s1"); err != nil || last != "" {
+		t.Fatalf("LastCheckpoint() = %q, %v, want none", last, err)
+	}
+	for _, cp := range [][2]string{{"s1", "1"}, {"s2", "7"}, {"s1", "3"}} {
+		if err := c.Checkpoint(ctx, cp[0], cp[1]); err != nil {
+			t.Fatalf("Checkpoint() error = %v", err)
+		}
+	}
+
+	// read back by another instance
+	c, _ = mypackage.NewFileCheckpoints(path)
+	for shard, want := range map[string]string{"s1": "3", "s2": "7", "s3": ""} {
+		if last, err := c.LastCheckpoint(ctx, shard); err != nil || last != want {
+			t.Errorf("LastCheckpoint(%s) = %q, %v, want %q", shard, last, err, want)
+		}
+	}
+	if matches, _ := filepath.Glob(path + ".*"); len(matches) > 0 {
+		t.Errorf("left temporary files %v", matches)
+	}
+
+	if _, err := mypackage.NewFileCheckpoints(""); err == nil || err.Error() != "path is required" {
+		t.Errorf("NewFileCheckpoints() error = %v, want path is required", err)
+	}
+}
@@ -0,0 +1,264 @@
+package mypackage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var (
+	// ErrDone is returned by PersonIterator.Next once every page has been read.
+	ErrDone = errors.New("no more pages")
+	// ErrInvalidToken is returned for a page token that wasn't made by the same kind of iterator.
+	ErrInvalidToken = errors.New("invalid page token")
+)
+
+type ddbQuerier interface {
+	QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error)
+}
+
+// DynamoDBQuerier finds people in DynamoDB by key.
+type DynamoDBQuerier struct {
+	Client ddbQuerier
+	Table  Table
+}
+
+// PageOptions controls how an iterator reads its pages.
+type PageOptions struct {
+	// PageSize is the most items DynamoDB reads for one page, unlimited if 0.
+	// Filters run after reading, so a page can hold fewer people, even none.
+	PageSize int64
+	// Token resumes iteration after the page it was returned with.
+	Token string
+}
+
+// ScanOptions controls a scan of the whole table.
+type ScanOptions struct {
+	PageOptions
+	Filter *Expression
+	// Segments splits the scan into that many segments read in parallel.
+	// Each page then reads at most PageSize items across all segments.
+	Segments int
+}
+
+// PersonQuery selects people by key.
+type PersonQuery struct {
+	// KeyCondition must test the partition key of the table or Index for equality.
+	KeyCondition Expression
+	Filter       *Expression
+	Index        string
+	// Descending returns people in descending sort key order.
+	Descending bool
+}
+
+// readPage reads one page of a segment starting after start, Limit items at most.
+type readPage func(ctx context.Context, segment int, limit *int64, start map[string]*dynamodb.AttributeValue) (items []map[string]*dynamodb.AttributeValue, last map[string]*dynamodb.AttributeValue, err error)
+
+// cursor is where a segment resumes.
+type cursor struct {
+	Start map[string]*dynamodb.AttributeValue `json:"k,omitempty"`
+	Done  bool                                `json:"d,omitempty"`
+}
+
+// pageToken is what a token encodes. Source tells a scan and queries of different tables or indexes apart.
+type pageToken struct {
+	Source  string    `json:"s"`
+	Cursors []*cursor `json:"c"`
+}
+
+// PersonIterator reads people a page at a time, following DynamoDB's pagination.
+// It is not safe for concurrent use.
+type PersonIterator struct {
+	read     readPage
+	table    Table
+	source   string
+	pageSize int64
+	cursors  []*cursor
+}
+
+func newPersonIterator(read readPage, table Table, source string, segments int, opts PageOptions) (*PersonIterator, error) {
+	if opts.PageSize < 0 {
+		return nil, fmt.Errorf("invalid page size: %d", opts.PageSize)
+	}
+	it := &PersonIterator{read: read, table: table, source: source, pageSize: opts.PageSize}
+
+	if opts.Token == "" {
+		it.cursors = make([]*cursor, segments)
+		for i := range it.cursors {
+			it.cursors[i] = &cursor{}
+		}
+		return it, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(opts.Token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	var token pageToken
+	if err := json.Unmarshal(raw, &token); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if token.Source != source || len(token.Cursors) != segments {
+		return nil, ErrInvalidToken
+	}
+	for _, c := range token.Cursors {
+		if c == nil {
+			return nil, ErrInvalidToken
+		}
+	}
+	it.cursors = token.Cursors
+	return it, nil
+}
+
+// Next returns the next page of people, or ErrDone after the last one.
+// When it fails, the iterator stays where it was, so Next can be called again.
+func (it *PersonIterator) Next(ctx context.Context) ([]*Person, error) {
+	var active []int // segments not read to the end
+	for i, c := range it.cursors {
+		if !c.Done {
+			active = append(active, i)
+		}
+	}
+	if len(active) == 0 {
+		return nil, ErrDone
+	}
+
+	// share the page size between segments, leaving some for the next page if there isn't enough
+	var limit *int64
+	if it.pageSize > 0 {
+		if int64(len(active)) > it.pageSize {
+			active = active[:it.pageSize]
+		}
+		limit = aws.Int64(it.pageSize / int64(len(active)))
+	}
+
+	items := make([][]map[string]*dynamodb.AttributeValue, len(active))
+	lasts := make([]map[string]*dynamodb.AttributeValue, len(active))
+	errs := make([]error, len(active))
+	var wg sync.WaitGroup
+	for i, segment := range active {
+		wg.Add(1)
+		go func(i, segment int) {
+			defer wg.Done()
+			items[i], lasts[i], errs[i] = it.read(ctx, segment, limit, it.cursors[segment].Start)
+		}(i, segment)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var people []*Person
+	for i := range active {
+		for _, item := range items[i] {
+			p, err := it.table.person(item)
+			if err != nil {
+				return nil, err
+			}
+			people = append(people, p)
+		}
+	}
+	for i, segment := range active {
+		it.cursors[segment] = &cursor{Start: lasts[i], Done: len(lasts[i]) == 0}
+	}
+	return people, nil
+}
+
+// Token returns an opaque token resuming iteration after the last page returned,
+// or "" once there are no more pages.
+func (it *PersonIterator) Token() string {
+	done := true
+	for _, c := range it.cursors {
+		done = done && c.Done
+	}
+	if done {
+		return ""
+	}
+
+	// AttributeValues marshal to JSON as they are, so this can't fail
+	raw, _ := json.Marshal(pageToken{Source: it.source, Cursors: it.cursors})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Scan returns an iterator over every Person in the table, optionally in parallel segments.
+func (l *DynamoDBLister) Scan(opts ScanOptions) (*PersonIterator, error) {
+	if err := l.Table.validate(); err != nil {
+		return nil, err
+	}
+	segments := opts.Segments
+	if segments == 0 {
+		segments = 1
+	}
+	if segments < 0 {
+		return nil, fmt.Errorf("invalid number of segments: %d", opts.Segments)
+	}
+	names, values, err := placeholders(opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	read := func(ctx context.Context, segment int, limit *int64, start map[string]*dynamodb.AttributeValue) ([]map[string]*dynamodb.AttributeValue, map[string]*dynamodb.AttributeValue, error) {
+		input := &dynamodb.ScanInput{
+			TableName:                 aws.String(l.Table.Name),
+			FilterExpression:          exprString(opts.Filter),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+			Limit:                     limit,
+			ExclusiveStartKey:         start,
+		}
+		if segments > 1 {
+			input.Segment, input.TotalSegments = aws.Int64(int64(segment)), aws.Int64(int64(segments))
+		}
+		output, err := l.Client.ScanWithContext(ctx, input)
+		if err != nil {
+			return nil, nil, wrapErr("Scan", err)
+		}
+		return output.Items, output.LastEvaluatedKey, nil
+	}
+	return newPersonIterator(read, l.Table, "scan:"+l.Table.Name, segments, opts.PageOptions)
+}
+
+// Query returns an iterator over the people query selects, in sort key order.
+func (q *DynamoDBQuerier) Query(query PersonQuery, opts PageOptions) (*PersonIterator, error) {
+	if err := q.Table.validate(); err != nil {
+		return nil, err
+	}
+	if query.KeyCondition.Expr == "" {
+		return nil, errors.New("key condition is required")
+	}
+	names, values, err := placeholders(&query.KeyCondition, query.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	read := func(ctx context.Context, _ int, limit *int64, start map[string]*dynamodb.AttributeValue) ([]map[string]*dynamodb.AttributeValue, map[string]*dynamodb.AttributeValue, error) {
+		input := &dynamodb.QueryInput{
+			TableName:                 aws.String(q.Table.Name),
+			KeyConditionExpression:    aws.String(query.KeyCondition.Expr),
+			FilterExpression:          exprString(query.Filter),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+			ScanIndexForward:          aws.Bool(!query.Descending),
+			Limit:                     limit,
+			ExclusiveStartKey:         start,
+		}
+		if query.Index != "" {
+			input.IndexName = aws.String(query.Index)
+		}
+		output, err := q.Client.QueryWithContext(ctx, input)
+		if err != nil {
+			return nil, nil, wrapErr("Query", err)
+		}
+		return output.Items, output.LastEvaluatedKey, nil
+	}
+	return newPersonIterator(read, q.Table, "query:"+q.Table.Name+"/"+query.Index, 1, opts)
+}
@@ -0,0 +1,232 @@
+package mypackage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+	"github.com/idiomat/dodtnyt/e1/mypackage/ddbfake"
+)
+
+// readAll reads it to the end, checking no page is bigger than max.
+func readAll(t *testing.T, it *mypackage.PersonIterator, max int) []string {
+	t.Helper()
+	var ids []string
+	for {
+		page, err := it.Next(context.Background())
+		if errors.Is(err, mypackage.ErrDone) {
+			return ids
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		if max > 0 && len(page) > max {
+			t.Errorf("expected at most %d people in a page but got %d", max, len(page))
+		}
+		for _, p := range page {
+			ids = append(ids, p.ID)
+		}
+	}
+}
+
+func TestDynamoDBLister_Scan(t *testing.T) {
+	fake := ddbfake.New()
+	if err := fake.CreateTable("people", "ID", ""); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	saver := &mypackage.DynamoDBSaver{Client: fake, Table: table}
+	var all []string
+	for _, p := range people(25) {
+		p.Name = "Johnny"
+		if p.ID[len(p.ID)-1] == '0' {
+			p.Name = "Jane"
+		}
+		if err := saver.Save(context.Background(), p); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		all = append(all, p.ID)
+	}
+	sort.Strings(all) // the order keys are scanned in
+	lister := &mypackage.DynamoDBLister{Client: fake, Table: table}
+
+	tests := map[string]struct {
+		opts mypackage.ScanOptions
+		want int
+	}{
+		"one page":                 {want: 25},
+		"pages":                    {opts: mypackage.ScanOptions{PageOptions: mypackage.PageOptions{PageSize: 7}}, want: 25},
+		"segments":                 {opts: mypackage.ScanOptions{Segments: 4}, want: 25},
+		"segments and pages":       {opts: mypackage.ScanOptions{Segments: 4, PageOptions: mypackage.PageOptions{PageSize: 6}}, want: 25},
+		"more segments than pages": {opts: mypackage.ScanOptions{Segments: 8, PageOptions: mypackage.PageOptions{PageSize: 3}}, want: 25},
+		"filter": {
+			opts: mypackage.ScanOptions{
+				PageOptions: mypackage.PageOptions{PageSize: 4},
+				Filter:      &mypackage.Expression{Expr: "#n = :n", Names: map[string]string{"#n": "Name"}, Values: map[string]interface{}{":n": "Jane"}},
+			},
+			want: 3,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			it, err := lister.Scan(tc.opts)
+			if err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			ids := readAll(t, it, int(tc.opts.PageSize))
+			if len(ids) != tc.want {
+				t.Errorf("expected %d people but got %d", tc.want, len(ids))
+			}
+			seen := make(map[string]bool)
+			for _, id := range ids {
+				if seen[id] {
+					t.Errorf("%s was read twice", id)
+				}
+				seen[id] = true
+			}
+			if it.Token() != "" {
+				t.Errorf("expected no token after the last page")
+			}
+		})
+	}
+
+	t.Run("resume from token", func(t *testing.T) {
+		opts := mypackage.ScanOptions{Segments: 2, PageOptions: mypackage.PageOptions{PageSize: 6}}
+		it, err := lister.Scan(opts)
+		if err != nil {
+			t.Fatalf("Scan() error = %v", err)
+		}
+		first, err := it.Next(context.Background())
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+
+		opts.Token = it.Token()
+		resumed, err := lister.Scan(opts)
+		if err != nil {
+			t.Fatalf("Scan() with token error = %v", err)
+		}
+		ids := readAll(t, resumed, 6)
+		for _, p := range first {
+			ids = append(ids, p.ID)
+		}
+		if len(ids) != len(all) {
+			t.Errorf("expected %d people across both iterators but got %d", len(all), len(ids))
+		}
+	})
+
+	t.Run("failed page is read again", func(t *testing.T) {
+		it, err := lister.Scan(mypackage.ScanOptions{PageOptions: mypackage.PageOptions{PageSize: 10}})
+		if err != nil {
+			t.Fatalf("Scan() error = %v", err)
+		}
+		failing := errors.New("failed to scan")
+		fake.Hook = func(op string, input interface{}) error { return failing }
+		if _, err := it.Next(context.Background()); err != failing {
+			t.Errorf("expected %v but got %v", failing, err)
+		}
+		fake.Hook = nil
+		if ids := readAll(t, it, 10); !reflect.DeepEqual(ids, all) {
+			t.Errorf("expected %v but got %v", all, ids)
+		}
+	})
+}
+
+func TestDynamoDBQuerier_Query(t *testing.T) {
+	fake := ddbfake.New()
+	if err := fake.CreateTable("teams", "Team", "ID"); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		team := "a"
+		if i%2 == 1 {
+			team = "b"
+		}
+		it := item(fmt.Sprintf("p%d", i), "Johnny")
+		it["Team"] = &dynamodb.AttributeValue{S: aws.String(team)}
+		if _, err := fake.PutItemWithContext(context.Background(), &dynamodb.PutItemInput{TableName: aws.String("teams"), Item: it}); err != nil {
+			t.Fatalf("PutItem() error = %v", err)
+		}
+	}
+	querier := &mypackage.DynamoDBQuerier{Client: fake, Table: mypackage.Table{Name: "teams"}}
+	team := func(name string) mypackage.Expression {
+		return mypackage.Expression{Expr: "Team = :t", Values: map[string]interface{}{":t": name}}
+	}
+
+	tests := map[string]struct {
+		query mypackage.PersonQuery
+		want  []string
+	}{
+		"ascending":  {query: mypackage.PersonQuery{KeyCondition: team("a")}, want: []string{"p0", "p2", "p4", "p6", "p8"}},
+		"descending": {query: mypackage.PersonQuery{KeyCondition: team("b"), Descending: true}, want: []string{"p9", "p7", "p5", "p3", "p1"}},
+		"filter": {
+			query: mypackage.PersonQuery{KeyCondition: team("a"), Filter: &mypackage.Expression{Expr: "ID <> :id", Values: map[string]interface{}{":id": "p4"}}},
+			want:  []string{"p0", "p2", "p6", "p8"},
+		},
+		"empty partition": {query: mypackage.PersonQuery{KeyCondition: team("c")}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			it, err := querier.Query(tc.query, mypackage.PageOptions{PageSize: 2})
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if ids := readAll(t, it, 2); !reflect.DeepEqual(ids, tc.want) {
+				t.Errorf("expected %v but got %v", tc.want, ids)
+			}
+		})
+	}
+}
+
+func TestPersonIterator_InvalidToken(t *testing.T) {
+	fake := ddbfake.New()
+	if err := fake.CreateTable("people", "ID", ""); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	saver := &mypackage.DynamoDBSaver{Client: fake, Table: table}
+	for _, p := range people(3) {
+		if err := saver.Save(context.Background(), p); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	lister := &mypackage.DynamoDBLister{Client: fake, Table: table}
+	it, err := lister.Scan(mypackage.ScanOptions{PageOptions: mypackage.PageOptions{PageSize: 1}})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if _, err := it.Next(context.Background()); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	token := it.Token()
+
+	querier := &mypackage.DynamoDBQuerier{Client: fake, Table: table}
+	key := mypackage.Expression{Expr: "ID = :id", Values: map[string]interface{}{":id": "p1"}}
+
+	tests := map[string]func(mypackage.PageOptions) (*mypackage.PersonIterator, error){
+		"scan with other segments": func(opts mypackage.PageOptions) (*mypackage.PersonIterator, error) {
+			return lister.Scan(mypackage.ScanOptions{PageOptions: opts, Segments: 2})
+		},
+		"query": func(opts mypackage.PageOptions) (*mypackage.PersonIterator, error) {
+			return querier.Query(mypackage.PersonQuery{KeyCondition: key}, opts)
+		},
+		"garbage": func(opts mypackage.PageOptions) (*mypackage.PersonIterator, error) {
+			opts.Token = "not a token!"
+			return lister.Scan(mypackage.ScanOptions{PageOptions: opts})
+		},
+	}
+
+	for name, newIter := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newIter(mypackage.PageOptions{Token: token}); !errors.Is(err, mypackage.ErrInvalidToken) {
+				t.Errorf("expected %v but got %v", mypackage.ErrInvalidToken, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package mypackage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemoryStream is a ShardReader over records held in memory, so stream processing can be tested offline.
+// Its zero value is an empty stream.
+type MemoryStream struct {
+	mu     sync.Mutex
+	shards []*memoryShard
+	seq    int64
+}
+
+type memoryShard struct {
+	Shard
+	records []*StreamRecord
+	closed  bool
+}
+
+func (s *MemoryStream) shard(id string) *memoryShard {
+	for _, sh := range s.shards {
+		if sh.ID == id {
+			return sh
+		}
+	}
+	return nil
+}
+
+// AddShard adds an open shard, which is read after parent unless parent is empty.
+func (s *MemoryStream) AddShard(id, parent string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id == "" {
+		return errors.New("shard ID is required")
+	}
+	if s.shard(id) != nil {
+		return fmt.Errorf("shard %s already exists", id)
+	}
+	s.shards = append(s.shards, &memoryShard{Shard: Shard{ID: id, ParentID: parent}})
+	return nil
+}
+
+// CloseShard closes a shard, so nothing more is appended to it.
+func (s *MemoryStream) CloseShard(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh := s.shard(id)
+	if sh == nil {
+		return fmt.Errorf("shard %s doesn't exist", id)
+	}
+	sh.closed = true
+	return nil
+}
+
+// Append adds r to the end of an open shard, setting its sequence number.
+func (s *MemoryStream) Append(shard string, r *StreamRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh := s.shard(shard)
+	if sh == nil {
+		return fmt.Errorf("shard %s doesn't exist", shard)
+	}
+	if sh.closed {
+		return fmt.Errorf("shard %s is closed", shard)
+	}
+	s.seq++
+	// padded so sequence numbers sort as strings
+	r.SequenceNumber = fmt.Sprintf("%020d", s.seq)
+	sh.records = append(sh.records, r)
+	return nil
+}
+
+// AppendChange adds the record of a Person stored in table changing from before to after to a shard.
+// before is nil for an insert, and after is nil for a removal.
+func (s *MemoryStream) AppendChange(shard string, table Table, before, after *Person) error {
+	r := &StreamRecord{}
+	var err error
+	switch {
+	case before == nil && after == nil:
+		return errors.New("a change needs a person before or after it")
+	case before == nil:
+		r.EventName = EventInsert
+	case after == nil:
+		r.EventName = EventRemove
+	default:
+		r.EventName = EventModify
+	}
+	if before != nil {
+		if r.OldImage, err = table.item(before); err != nil {
+			return err
+		}
+		r.Keys = table.key(before.ID)
+	}
+	if after != nil {
+		if r.NewImage, err = table.item(after); err != nil {
+			return err
+		}
+		r.Keys = table.key(after.ID)
+	}
+	return s.Append(shard, r)
+}
+
+func (s *MemoryStream) Shards(ctx context.Context) ([]Shard, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shards := make([]Shard, len(s.shards))
+	for i, sh := range s.shards {
+		shards[i] = sh.Shard
+	}
+	return shards, nil
+}
+
+func (s *MemoryStream) ReadRecords(ctx context.Context, shard, after string, limit int) ([]*StreamRecord, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh := s.shard(shard)
+	if sh == nil {
+		return nil, false, fmt.Errorf("shard %s doesn't exist", shard)
+	}
+	start := sort.Search(len(sh.records), func(i int) bool { return sh.records[i].SequenceNumber > after })
+	end := min(start+limit, len(sh.records))
+	records := append([]*StreamRecord(nil), sh.records[start:end]...)
+	return records, sh.closed && end == len(sh.records), nil
+}
+
+// MemoryCheckpoints is a Checkpointer keeping checkpoints in memory. Its zero value has none.
+type MemoryCheckpoints struct {
+	mu  sync.Mutex
+	seq map[string]string
+}
+
+func (c *MemoryCheckpoints) Checkpoint(ctx context.Context, shard, seq string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seq == nil {
+		c.seq = make(map[string]string)
+	}
+	c.seq[shard] = seq
+	return nil
+}
+
+func (c *MemoryCheckpoints) LastCheckpoint(ctx context.Context, shard string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seq[shard], nil
+}
@@ -0,0 +1,209 @@
+package mypackage
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// BirthDateLayout is the format of Person.BirthDate.
+const BirthDateLayout = "2006-01-02"
+
+// Length limits of Person fields, in characters.
+const (
+	MaxIDLength     = 255
+	MaxNameLength   = 200
+	MaxEmailLength  = 254
+	MaxAddressField = 200
+	MaxPostalCode   = 20
+	MaxTags         = 50
+	MaxTagLength    = 64
+)
+
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// Person captures demographics.
+// The fields tagged with encrypt are encrypted when stored in a Table with Encryption.
+type Person struct {
+	ID        string    `dynamodbav:"ID"` // primary key
+	Name      string    `dynamodbav:"Name" encrypt:"randomized"`
+	Email     string    `dynamodbav:"Email,omitempty" encrypt:"deterministic"`  // so people can be looked up by email
+	BirthDate string    `dynamodbav:"BirthDate,omitempty" encrypt:"randomized"` // formatted as BirthDateLayout
+	Address   *Address  `dynamodbav:"Address,omitempty" encrypt:"randomized"`
+	Tags      []string  `dynamodbav:"Tags,stringset,omitempty"`
+	CreatedAt time.Time `dynamodbav:"CreatedAt"` // set by the first save
+	UpdatedAt time.Time `dynamodbav:"UpdatedAt"` // set by every save and update
+	Version   int64     `dynamodbav:"Version"`   // only maintained by versioned savers
+}
+
+// Address is where a Person lives.
+type Address struct {
+	Street     string `dynamodbav:"Street,omitempty"`
+	City       string `dynamodbav:"City"`
+	PostalCode string `dynamodbav:"PostalCode,omitempty"`
+	Country    string `dynamodbav:"Country"` // ISO 3166-1 alpha-2 code, e.g. PT
+}
+
+// FieldError is a Person field that failed validation.
+type FieldError struct {
+	Field  string // the attribute, e.g. Address.City or Tags[2]
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Reason
+}
+
+// ValidationError lists every field of a Person that failed validation.
+// It matches ErrValidation with errors.Is.
+type ValidationError struct {
+	ID     string
+	Fields []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return fmt.Sprintf("invalid person %s: %s", e.ID, strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := []error{ErrValidation}
+	for _, f := range e.Fields {
+		errs = append(errs, f)
+	}
+	return errs
+}
+
+// personRules check one attribute each, so updates only check the attributes they change.
+var personRules = []struct {
+	attr  string
+	check func(p *Person) []*FieldError
+}{
+	{KeyAttribute, func(p *Person) []*FieldError {
+		return checkLength(KeyAttribute, p.ID, true, MaxIDLength)
+	}},
+	{"Name", func(p *Person) []*FieldError {
+		return checkLength("Name", p.Name, true, MaxNameLength)
+	}},
+	{"Email", func(p *Person) []*FieldError {
+		if p.Email == "" {
+			return nil
+		}
+		if errs := checkLength("Email", p.Email, false, MaxEmailLength); errs != nil {
+			return errs
+		}
+		if addr, err := mail.ParseAddress(p.Email); err != nil || addr.Address != p.Email {
+			return []*FieldError{{Field: "Email", Reason: "not a valid email address"}}
+		}
+		return nil
+	}},
+	{"BirthDate", func(p *Person) []*FieldError {
+		if p.BirthDate == "" {
+			return nil
+		}
+		date, err := time.Parse(BirthDateLayout, p.BirthDate)
+		if err != nil {
+			return []*FieldError{{Field: "BirthDate", Reason: "must be formatted as " + BirthDateLayout}}
+		}
+		if date.After(time.Now()) {
+			return []*FieldError{{Field: "BirthDate", Reason: "is in the future"}}
+		}
+		return nil
+	}},
+	{"Address", func(p *Person) []*FieldError {
+		if p.Address == nil {
+			return nil
+		}
+		var errs []*FieldError
+		errs = append(errs, checkLength("Address.Street", p.Address.Street, false, MaxAddressField)...)
+		errs = append(errs, checkLength("Address.City", p.Address.City, true, MaxAddressField)...)
+		errs = append(errs, checkLength("Address.PostalCode", p.Address.PostalCode, false, MaxPostalCode)...)
+		if !countryPattern.MatchString(p.Address.Country) {
+			errs = append(errs, &FieldError{Field: "Address.Country", Reason: "must be an ISO 3166-1 alpha-2 code"})
+		}
+		return errs
+	}},
+	{"Tags", func(p *Person) []*FieldError {
+		if len(p.Tags) > MaxTags {
+			return []*FieldError{{Field: "Tags", Reason: fmt.Sprintf("more than %d tags", MaxTags)}}
+		}
+		var errs []*FieldError
+		seen := make(map[string]bool, len(p.Tags))
+		for i, tag := range p.Tags {
+			field := fmt.Sprintf("Tags[%d]", i)
+			errs = append(errs, checkLength(field, tag, true, MaxTagLength)...)
+			if seen[tag] {
+				errs = append(errs, &FieldError{Field: field, Reason: "duplicate tag " + tag})
+			}
+			seen[tag] = true
+		}
+		return errs
+	}},
+}
+
+func checkLength(field, value string, required bool, max int) []*FieldError {
+	switch n := utf8.RuneCountInString(value); {
+	case n == 0 && required:
+		return []*FieldError{{Field: field, Reason: "is required"}}
+	case n > max:
+		return []*FieldError{{Field: field, Reason: fmt.Sprintf("longer than %d characters", max)}}
+	}
+	return nil
+}
+
+// errNilPerson is returned when a nil Person is saved.
+var errNilPerson = fmt.Errorf("%w: person is nil", ErrValidation)
+
+// Validate checks every field of p, returning a *ValidationError listing those that are invalid.
+func (p *Person) Validate() error {
+	if p == nil {
+		return errNilPerson
+	}
+	return p.validate(nil)
+}
+
+// validate checks the given attributes of p, or all of them if attrs is nil.
+func (p *Person) validate(attrs map[string]bool) error {
+	var fields []*FieldError
+	for _, rule := range personRules {
+		if attrs == nil || attrs[rule.attr] {
+			fields = append(fields, rule.check(p)...)
+		}
+	}
+	if len(fields) > 0 {
+		return &ValidationError{ID: p.ID, Fields: fields}
+	}
+	return nil
+}
+
+// clone returns a copy of p that doesn't share its Address or Tags.
+func (p *Person) clone() *Person {
+	c := *p
+	if p.Address != nil {
+		addr := *p.Address
+		c.Address = &addr
+	}
+	if p.Tags != nil {
+		c.Tags = append([]string{}, p.Tags...)
+	}
+	return &c
+}
+
+// stamp sets when p is saved, and when it was created if it's new.
+func (p *Person) stamp(now time.Time) {
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = now
+	}
+	p.UpdatedAt = now
+}
+
+// timestamp returns the time in UTC, which round-trips through DynamoDB unchanged.
+func timestamp() time.Time {
+	return time.Now().UTC()
+}
@@ -0,0 +1,131 @@
+package mypackage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+	"github.com/idiomat/dodtnyt/e1/mypackage/ddbfake"
+)
+
+func TestPerson_Validate(t *testing.T) {
+	valid := func() *mypackage.Person {
+		return &mypackage.Person{
+			ID:        "p1",
+			Name:      "Johnny",
+			Email:     "johnny@example.com",
+			BirthDate: "1990-05-17",
+			Address:   &mypackage.Address{Street: "Rua Augusta 1", City: "Lisboa", PostalCode: "1100-048", Country: "PT"},
+			Tags:      []string{"customer", "vip"},
+		}
+	}
+	manyTags := make([]string, mypackage.MaxTags+1)
+	for i := range manyTags {
+		manyTags[i] = fmt.Sprint("tag", i)
+	}
+
+	tests := map[string]struct {
+		change     func(p *mypackage.Person)
+		wantFields []string
+	}{
+		"valid":           {change: func(p *mypackage.Person) {}},
+		"only required":   {change: func(p *mypackage.Person) { *p = mypackage.Person{ID: "p1", Name: "Johnny"} }},
+		"missing ID":      {change: func(p *mypackage.Person) { p.ID = "" }, wantFields: []string{"ID"}},
+		"missing name":    {change: func(p *mypackage.Person) { p.Name = "" }, wantFields: []string{"Name"}},
+		"long name":       {change: func(p *mypackage.Person) { p.Name = strings.Repeat("a", mypackage.MaxNameLength+1) }, wantFields: []string{"Name"}},
+		"bad email":       {change: func(p *mypackage.Person) { p.Email = "johnny@" }, wantFields: []string{"Email"}},
+		"named email":     {change: func(p *mypackage.Person) { p.Email = "Johnny <johnny@example.com>" }, wantFields: []string{"Email"}},
+		"bad birth date":  {change: func(p *mypackage.Person) { p.BirthDate = "17/05/1990" }, wantFields: []string{"BirthDate"}},
+		"born tomorrow":   {change: func(p *mypackage.Person) { p.BirthDate = time.Now().AddDate(0, 0, 2).Format(mypackage.BirthDateLayout) }, wantFields: []string{"BirthDate"}},
+		"address no city": {change: func(p *mypackage.Person) { p.Address.City = "" }, wantFields: []string{"Address.City"}},
+		"address country": {change: func(p *mypackage.Person) { p.Address.Country = "Portugal" }, wantFields: []string{"Address.Country"}},
+		"too many tags":   {change: func(p *mypackage.Person) { p.Tags = manyTags }, wantFields: []string{"Tags"}},
+		"duplicate tag":   {change: func(p *mypackage.Person) { p.Tags = []string{"vip", "vip"} }, wantFields: []string{"Tags[1]"}},
+		"empty tag":       {change: func(p *mypackage.Person) { p.Tags = []string{""} }, wantFields: []string{"Tags[0]"}},
+		"several fields": {
+			change:     func(p *mypackage.Person) { p.Name, p.Email = "", "nope" },
+			wantFields: []string{"Name", "Email"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := valid()
+			tc.change(p)
+
+			err := p.Validate()
+			if len(tc.wantFields) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, mypackage.ErrValidation) {
+				t.Fatalf("expected %v but got %v", mypackage.ErrValidation, err)
+			}
+			var vErr *mypackage.ValidationError
+			if !errors.As(err, &vErr) {
+				t.Fatalf("expected a *ValidationError but got %T", err)
+			}
+			var fields []string
+			for _, f := range vErr.Fields {
+				fields = append(fields, f.Field)
+			}
+			if !reflect.DeepEqual(fields, tc.wantFields) {
+				t.Errorf("expected invalid fields %v but got %v", tc.wantFields, fields)
+			}
+		})
+	}
+}
+
+func TestDynamoDBSaver_SaveTimestamps(t *testing.T) {
+	fake := ddbfake.New()
+	if err := fake.CreateTable("people", "ID", ""); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	repo, err := mypackage.NewPersonRepository(fake, table)
+	if err != nil {
+		t.Fatalf("NewPersonRepository() error = %v", err)
+	}
+	ctx := context.Background()
+
+	p := &mypackage.Person{ID: "p1", Name: "Johnny", Email: "johnny@example.com", Tags: []string{"vip"}}
+	if err := repo.Save(ctx, p); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if p.CreatedAt.IsZero() || !p.UpdatedAt.Equal(p.CreatedAt) {
+		t.Fatalf("expected the first Save() to set both timestamps but got %v and %v", p.CreatedAt, p.UpdatedAt)
+	}
+	created := p.CreatedAt
+
+	p.Name = "John"
+	if err := repo.Save(ctx, p); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if !p.CreatedAt.Equal(created) || !p.UpdatedAt.After(created) {
+		t.Errorf("expected Save() to keep CreatedAt %v and move UpdatedAt but got %v and %v", created, p.CreatedAt, p.UpdatedAt)
+	}
+
+	got, err := repo.Get(ctx, "p1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("Get() = %+v, want %+v", got, p)
+	}
+
+	if err := repo.Save(ctx, &mypackage.Person{ID: "p2", Name: "Jane", Email: "jane"}); !errors.Is(err, mypackage.ErrValidation) {
+		t.Errorf("expected Save() of an invalid person to fail with %v but got %v", mypackage.ErrValidation, err)
+	}
+	if _, err := repo.Update(ctx, "p1", 0, map[string]interface{}{"Email": "john@"}); !errors.Is(err, mypackage.ErrValidation) {
+		t.Errorf("expected Update() to an invalid email to fail with %v but got %v", mypackage.ErrValidation, err)
+	}
+	if _, err := repo.Update(ctx, "p1", 0, map[string]interface{}{"CreatedAt": time.Now()}); err == nil {
+		t.Errorf("expected Update() of CreatedAt to fail")
+	}
+}
@@ -0,0 +1,333 @@
+package mypackage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// KeyAttribute is the name of the attribute holding a Person's ID.
+const KeyAttribute = "ID"
+
+// ErrNotFound is returned when no Person exists with the requested ID.
+var ErrNotFound = errors.New("person not found")
+
+// Just like ddbClient, each operation only asks for the one method it calls.
+type ddbGetter interface {
+	GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error)
+}
+
+type ddbUpdater interface {
+	UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error)
+}
+
+type ddbDeleter interface {
+	DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error)
+}
+
+type ddbScanner interface {
+	ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error)
+}
+
+// ddbRepositoryClient is everything PersonRepository needs, which *dynamodb.DynamoDB satisfies.
+type ddbRepositoryClient interface {
+	ddbClient
+	ddbGetter
+	ddbUpdater
+	ddbDeleter
+	ddbScanner
+	ddbQuerier
+	ddbBatchWriter
+	ddbBatchGetter
+	ddbTransactor
+}
+
+// DynamoDBGetter reads people from DynamoDB.
+type DynamoDBGetter struct {
+	Client ddbGetter
+	Table  Table
+}
+
+// DynamoDBUpdater modifies people in DynamoDB.
+// When Versioned is set, an update only applies to the version it expects, and increments it.
+type DynamoDBUpdater struct {
+	Client    ddbUpdater
+	Table     Table
+	Versioned bool
+}
+
+// DynamoDBDeleter removes people from DynamoDB.
+type DynamoDBDeleter struct {
+	Client ddbDeleter
+	Table  Table
+}
+
+// DynamoDBLister lists people in DynamoDB.
+type DynamoDBLister struct {
+	Client ddbScanner
+	Table  Table
+}
+
+// PersonRepository provides every operation on people stored in DynamoDB.
+type PersonRepository struct {
+	DynamoDBSaver
+	DynamoDBGetter
+	DynamoDBUpdater
+	DynamoDBDeleter
+	DynamoDBLister
+	DynamoDBQuerier
+	DynamoDBBatchSaver
+	DynamoDBTransactor
+}
+
+// NewPersonRepository returns a PersonRepository using client and table for every operation.
+func NewPersonRepository(client ddbRepositoryClient, table Table) (*PersonRepository, error) {
+	if client == nil {
+		return nil, errors.New("client is required")
+	}
+	if err := table.validate(); err != nil {
+		return nil, err
+	}
+	return &PersonRepository{
+		DynamoDBSaver:   DynamoDBSaver{Client: client, Table: table},
+		DynamoDBGetter:  DynamoDBGetter{Client: client, Table: table},
+		DynamoDBUpdater: DynamoDBUpdater{Client: client, Table: table},
+		DynamoDBDeleter: DynamoDBDeleter{Client: client, Table: table},
+		DynamoDBLister:  DynamoDBLister{Client: client, Table: table},
+		DynamoDBQuerier: DynamoDBQuerier{Client: client, Table: table},
+
+		DynamoDBBatchSaver: DynamoDBBatchSaver{Client: client, Table: table},
+		DynamoDBTransactor: DynamoDBTransactor{Client: client},
+	}, nil
+}
+
+// Get returns the Person with the given ID, or ErrNotFound.
+func (g *DynamoDBGetter) Get(ctx context.Context, id string) (*Person, error) {
+	if err := g.Table.validate(); err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.GetItemInput{
+		Key:       g.Table.key(id),
+		TableName: aws.String(g.Table.Name),
+	}
+
+	output, err := g.Client.GetItemWithContext(ctx, input)
+	if err != nil {
+		return nil, wrapErr("GetItem", err)
+	}
+	if len(output.Item) == 0 {
+		return nil, fmt.Errorf("%s: %w", id, ErrNotFound)
+	}
+
+	return g.Table.person(output.Item)
+}
+
+// Update sets the given attributes on an existing Person, leaving the others untouched,
+// and returns the updated Person. It returns ErrNotFound if there is no Person with the ID.
+// When Versioned is set it returns ErrVersionConflict instead, unless the stored version is version,
+// the one the caller last read; otherwise version is ignored.
+func (u *DynamoDBUpdater) Update(ctx context.Context, id string, version int64, changes map[string]interface{}) (*Person, error) {
+	if err := u.Table.validate(); err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, errors.New("no attributes to update")
+	}
+	for _, attr := range []string{KeyAttribute, u.Table.partitionKey(), VersionAttribute, "CreatedAt", "UpdatedAt"} {
+		if _, ok := changes[attr]; ok {
+			return nil, fmt.Errorf("%s cannot be updated", attr)
+		}
+	}
+	encoded, err := encodeChanges(id, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	// sorted so the same changes always produce the same expression
+	attrs := make([]string, 0, len(changes))
+	for attr := range changes {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+
+	names := map[string]*string{"#key": aws.String(u.Table.partitionKey())}
+	values := make(map[string]*dynamodb.AttributeValue, len(attrs))
+	var set, remove []string
+	for i, attr := range attrs {
+		name := fmt.Sprintf("#a%d", i)
+		names[name] = aws.String(attr)
+		value, ok := encoded[attr]
+		if !ok {
+			// an empty value of an omitempty field, which Save wouldn't store either
+			remove = append(remove, name)
+			continue
+		}
+		if u.Table.Encryption != nil {
+			if value, err = u.Table.Encryption.encrypt(attr, value); err != nil {
+				return nil, fmt.Errorf("person %s: %w", id, err)
+			}
+		}
+		placeholder := fmt.Sprintf(":v%d", i)
+		values[placeholder] = value
+		set = append(set, name+" = "+placeholder)
+	}
+	names["#updated"] = aws.String("UpdatedAt")
+	values[":updated"] = &dynamodb.AttributeValue{S: aws.String(timestamp().Format(time.RFC3339Nano))}
+	set = append(set, "#updated = :updated")
+	expr := "SET " + strings.Join(set, ", ")
+	if len(remove) > 0 {
+		expr += " REMOVE " + strings.Join(remove, ", ")
+	}
+	cond := "attribute_exists(#key)"
+	condErr := fmt.Errorf("%s: %w", id, ErrNotFound)
+	if u.Versioned {
+		names["#version"] = aws.String(VersionAttribute)
+		values[":one"] = &dynamodb.AttributeValue{N: aws.String("1")}
+		values[":expected"] = &dynamodb.AttributeValue{N: aws.String(fmt.Sprint(version))}
+		expr += " ADD #version :one"
+		cond += " AND #version = :expected"
+		condErr = fmt.Errorf("%s at version %d: %w", id, version, ErrVersionConflict)
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		Key:                       u.Table.key(id),
+		TableName:                 aws.String(u.Table.Name),
+		UpdateExpression:          aws.String(expr),
+		ConditionExpression:       aws.String(cond),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnValues:              aws.String(dynamodb.ReturnValueAllNew),
+	}
+
+	output, err := u.Client.UpdateItemWithContext(ctx, input)
+	if err != nil {
+		err = wrapErr("UpdateItem", err)
+		if errors.Is(err, ErrConditionFailed) {
+			return nil, condErr
+		}
+		return nil, err
+	}
+
+	return u.Table.person(output.Attributes)
+}
+
+// personAttrs are the attributes of Person fields.
+var personAttrs = func() map[string]bool {
+	attrs := make(map[string]bool)
+	t := reflect.TypeOf(Person{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("dynamodbav"), ",")
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		attrs[name] = true
+	}
+	return attrs
+}()
+
+// encodeChanges validates the Person attributes among changes, by reading them into a Person,
+// and returns them as Save would store them. Empty values of omitempty fields are left out.
+func encodeChanges(id string, changes map[string]interface{}) (map[string]*dynamodb.AttributeValue, error) {
+	for attr := range changes {
+		if !personAttrs[attr] {
+			return nil, fmt.Errorf("%s is not an attribute of a person", attr)
+		}
+	}
+	item, err := dynamodbattribute.MarshalMap(changes)
+	if err != nil {
+		return nil, marshalError("changes to person "+id, err)
+	}
+	p := Person{ID: id}
+	if err := dynamodbattribute.UnmarshalMap(item, &p); err != nil {
+		return nil, &ValidationError{ID: id, Fields: []*FieldError{{Field: "changes", Reason: err.Error()}}}
+	}
+	attrs := make(map[string]bool, len(changes))
+	for attr := range changes {
+		attrs[attr] = true
+	}
+	if err := p.validate(attrs); err != nil {
+		return nil, err
+	}
+
+	encoded, err := dynamodbattribute.MarshalMap(&p)
+	if err != nil {
+		return nil, marshalError("person "+id, err)
+	}
+	for attr := range encoded {
+		if !attrs[attr] {
+			delete(encoded, attr)
+		}
+	}
+	return encoded, nil
+}
+
+// Delete removes the Person with the given ID. Deleting a missing Person is not an error.
+func (d *DynamoDBDeleter) Delete(ctx context.Context, id string) error {
+	if err := d.Table.validate(); err != nil {
+		return err
+	}
+
+	input := &dynamodb.DeleteItemInput{
+		Key:       d.Table.key(id),
+		TableName: aws.String(d.Table.Name),
+	}
+
+	_, err := d.Client.DeleteItemWithContext(ctx, input)
+
+	return wrapErr("DeleteItem", err)
+}
+
+// DeleteVersion removes the Person with the given ID only if its stored version is version,
+// returning ErrVersionConflict otherwise. Delete removes it whatever its version.
+func (d *DynamoDBDeleter) DeleteVersion(ctx context.Context, id string, version int64) error {
+	if err := d.Table.validate(); err != nil {
+		return err
+	}
+
+	input := &dynamodb.DeleteItemInput{
+		Key:                      d.Table.key(id),
+		TableName:                aws.String(d.Table.Name),
+		ConditionExpression:      aws.String("#version = :expected"),
+		ExpressionAttributeNames: map[string]*string{"#version": aws.String(VersionAttribute)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":expected": {N: aws.String(fmt.Sprint(version))},
+		},
+	}
+
+	_, err := d.Client.DeleteItemWithContext(ctx, input)
+	err = wrapErr("DeleteItem", err)
+	if errors.Is(err, ErrConditionFailed) {
+		return fmt.Errorf("%s at version %d: %w", id, version, ErrVersionConflict)
+	}
+	return err
+}
+
+// List returns every Person in the table, following pagination to the end.
+func (l *DynamoDBLister) List(ctx context.Context) ([]*Person, error) {
+	it, err := l.Scan(ScanOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var people []*Person
+	for {
+		page, err := it.Next(ctx)
+		if errors.Is(err, ErrDone) {
+			return people, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		people = append(people, page...)
+	}
+}
@@ -0,0 +1,400 @@
+package mypackage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+	"github.com/idiomat/dodtnyt/e1/mypackage/ddbfake"
+)
+
+// Each test client only implements the one method the operation under test needs.
+type getClient struct {
+	output *dynamodb.GetItemOutput
+	err    error
+	input  *dynamodb.GetItemInput
+}
+
+func (c *getClient) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	c.input = input
+	return c.output, c.err
+}
+
+type updateClient struct {
+	output *dynamodb.UpdateItemOutput
+	err    error
+	input  *dynamodb.UpdateItemInput
+}
+
+func (c *updateClient) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	c.input = input
+	return c.output, c.err
+}
+
+type deleteClient struct {
+	err   error
+	input *dynamodb.DeleteItemInput
+}
+
+func (c *deleteClient) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	c.input = input
+	return &dynamodb.DeleteItemOutput{}, c.err
+}
+
+// scanClient returns one page per call.
+type scanClient struct {
+	pages  []*dynamodb.ScanOutput
+	err    error
+	inputs []*dynamodb.ScanInput
+}
+
+func (c *scanClient) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	c.inputs = append(c.inputs, input)
+	if c.err != nil {
+		return nil, c.err
+	}
+	page := c.pages[0]
+	c.pages = c.pages[1:]
+	return page, nil
+}
+
+func item(id, name string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"ID":   {S: aws.String(id)},
+		"Name": {S: aws.String(name)},
+	}
+}
+
+func TestDynamoDBGetter_Get(t *testing.T) {
+	tests := map[string]struct {
+		output  *dynamodb.GetItemOutput
+		err     error
+		want    *mypackage.Person
+		wantErr error
+	}{
+		"found": {
+			output: &dynamodb.GetItemOutput{Item: item("p1", "Johnny")},
+			want:   &mypackage.Person{ID: "p1", Name: "Johnny"},
+		},
+		"not found": {
+			output:  &dynamodb.GetItemOutput{},
+			wantErr: mypackage.ErrNotFound,
+		},
+		"client error": {
+			err:     errors.New("failed to get"),
+			wantErr: errors.New("failed to get"),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &getClient{output: tc.output, err: tc.err}
+			getter := &mypackage.DynamoDBGetter{Client: client, Table: table}
+
+			got, err := getter.Get(context.Background(), "p1")
+			if tc.wantErr != nil {
+				if err == nil || (!errors.Is(err, tc.wantErr) && err.Error() != tc.wantErr.Error()) {
+					t.Errorf("expected %v but got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %+v but got %+v", tc.want, got)
+			}
+			if id := aws.StringValue(client.input.Key["ID"].S); id != "p1" {
+				t.Errorf("expected key p1 but got %q", id)
+			}
+		})
+	}
+}
+
+func TestDynamoDBUpdater_Update(t *testing.T) {
+	tests := map[string]struct {
+		changes   map[string]interface{}
+		versioned bool
+		output    *dynamodb.UpdateItemOutput
+		err       error
+		wantExpr  string
+		wantCond  string
+		wantErr   bool
+		notFound  bool
+		conflict  bool
+	}{
+		"partial update": {
+			changes:  map[string]interface{}{"Name": "John"},
+			output:   &dynamodb.UpdateItemOutput{Attributes: item("p1", "John")},
+			wantExpr: "SET #a0 = :v0, #updated = :updated",
+			wantCond: "attribute_exists(#key)",
+		},
+		"versioned update": {
+			changes:   map[string]interface{}{"Name": "John"},
+			versioned: true,
+			output:    &dynamodb.UpdateItemOutput{Attributes: item("p1", "John")},
+			wantExpr:  "SET #a0 = :v0, #updated = :updated ADD #version :one",
+			wantCond:  "attribute_exists(#key) AND #version = :expected",
+		},
+		"stale version": {
+			changes:   map[string]interface{}{"Name": "John"},
+			versioned: true,
+			err:       awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "condition failed", nil),
+			wantErr:   true,
+			conflict:  true,
+		},
+		"version cannot change": {
+			changes: map[string]interface{}{"Version": 9},
+			wantErr: true,
+		},
+		"no changes": {
+			changes: map[string]interface{}{},
+			wantErr: true,
+		},
+		"not a person attribute": {
+			changes: map[string]interface{}{"Nickname": "Johnny"},
+			wantErr: true,
+		},
+		"key cannot change": {
+			changes: map[string]interface{}{"ID": "p2"},
+			wantErr: true,
+		},
+		"missing person": {
+			changes:  map[string]interface{}{"Name": "John"},
+			err:      awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "condition failed", nil),
+			wantErr:  true,
+			notFound: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &updateClient{output: tc.output, err: tc.err}
+			updater := &mypackage.DynamoDBUpdater{Client: client, Table: table, Versioned: tc.versioned}
+
+			got, err := updater.Update(context.Background(), "p1", 2, tc.changes)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v but got %v", tc.wantErr, err)
+			}
+			if errors.Is(err, mypackage.ErrNotFound) != tc.notFound {
+				t.Errorf("expected ErrNotFound %v but got %v", tc.notFound, err)
+			}
+			if errors.Is(err, mypackage.ErrVersionConflict) != tc.conflict {
+				t.Errorf("expected ErrVersionConflict %v but got %v", tc.conflict, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got.Name != "John" {
+				t.Errorf("expected updated person but got %+v", got)
+			}
+			if expr := aws.StringValue(client.input.UpdateExpression); expr != tc.wantExpr {
+				t.Errorf("expected expression %q but got %q", tc.wantExpr, expr)
+			}
+			if cond := aws.StringValue(client.input.ConditionExpression); cond != tc.wantCond {
+				t.Errorf("expected condition %q but got %q", tc.wantCond, cond)
+			}
+			if tc.versioned && aws.StringValue(client.input.ExpressionAttributeValues[":expected"].N) != "2" {
+				t.Errorf("expected the update to check version 2")
+			}
+		})
+	}
+}
+
+func TestDynamoDBUpdater_UpdateEncoding(t *testing.T) {
+	fake := ddbfake.New()
+	if err := fake.CreateTable("people", "ID", ""); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	repo, err := mypackage.NewPersonRepository(fake, table)
+	if err != nil {
+		t.Fatalf("NewPersonRepository() error = %v", err)
+	}
+	ctx := context.Background()
+	if err := repo.Save(ctx, &mypackage.Person{ID: "p1", Name: "Johnny", Email: "johnny@example.com"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := repo.Update(ctx, "p1", 0, map[string]interface{}{"Tags": []string{"vip", "admin"}, "Email": ""})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	sort.Strings(got.Tags)
+	if !reflect.DeepEqual(got.Tags, []string{"admin", "vip"}) || got.Email != "" {
+		t.Errorf("Update() = %+v, want the new tags and no email", got)
+	}
+
+	// stored as Save would store them: tags as a string set, an empty email not at all
+	items, err := fake.Items("people")
+	if err != nil {
+		t.Fatalf("Items() error = %v", err)
+	}
+	if len(items) != 1 || len(items[0]["Tags"].SS) != 2 || items[0]["Tags"].L != nil {
+		t.Errorf("stored item = %v, want Tags as a string set", items)
+	}
+	if _, ok := items[0]["Email"]; ok {
+		t.Errorf("stored item = %v, want no Email", items[0])
+	}
+}
+
+func TestDynamoDBDeleter_Delete(t *testing.T) {
+	client := &deleteClient{}
+	deleter := &mypackage.DynamoDBDeleter{Client: client, Table: table}
+
+	if err := deleter.Delete(context.Background(), "p1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id := aws.StringValue(client.input.Key["ID"].S); id != "p1" {
+		t.Errorf("expected key p1 but got %q", id)
+	}
+
+	client.err = errors.New("failed to delete")
+	if err := deleter.Delete(context.Background(), "p1"); err != client.err {
+		t.Errorf("expected %v but got %v", client.err, err)
+	}
+
+	client.err = awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "condition failed", nil)
+	if err := deleter.DeleteVersion(context.Background(), "p1", 2); !errors.Is(err, mypackage.ErrVersionConflict) {
+		t.Errorf("expected %v but got %v", mypackage.ErrVersionConflict, err)
+	}
+	if v := aws.StringValue(client.input.ExpressionAttributeValues[":expected"].N); v != "2" {
+		t.Errorf("expected the delete to check version 2 but got %q", v)
+	}
+}
+
+func TestDynamoDBLister_List(t *testing.T) {
+	client := &scanClient{pages: []*dynamodb.ScanOutput{
+		{Items: []map[string]*dynamodb.AttributeValue{item("p1", "Johnny")}, LastEvaluatedKey: item("p1", "Johnny")},
+		{Items: []map[string]*dynamodb.AttributeValue{item("p2", "Jane")}},
+	}}
+	lister := &mypackage.DynamoDBLister{Client: client, Table: table}
+
+	got, err := lister.List(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []*mypackage.Person{{ID: "p1", Name: "Johnny"}, {ID: "p2", Name: "Jane"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+	if len(client.inputs) != 2 || client.inputs[1].ExclusiveStartKey == nil {
+		t.Errorf("expected the second page to start after the first")
+	}
+
+	client = &scanClient{err: errors.New("failed to scan")}
+	lister = &mypackage.DynamoDBLister{Client: client, Table: table}
+	if _, err := lister.List(context.Background()); err != client.err {
+		t.Errorf("expected %v but got %v", client.err, err)
+	}
+}
+
+func TestNewPersonRepository(t *testing.T) {
+	if _, err := mypackage.NewPersonRepository(nil, table); err == nil {
+		t.Errorf("expected error for nil client")
+	}
+}
+
+func TestPersonRepository(t *testing.T) {
+	fake := ddbfake.New()
+	if err := fake.CreateTable("people", "ID", ""); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	repo, err := mypackage.NewPersonRepository(fake, table)
+	if err != nil {
+		t.Fatalf("NewPersonRepository() error = %v", err)
+	}
+	repo.DynamoDBSaver.Versioned = true
+	repo.DynamoDBUpdater.Versioned = true
+	ctx := context.Background()
+
+	johnny := &mypackage.Person{ID: "p1", Name: "Johnny"}
+	if err := repo.Create(ctx, johnny); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := repo.Create(ctx, &mypackage.Person{ID: "p1", Name: "Johnny"}); !errors.Is(err, mypackage.ErrAlreadyExists) {
+		t.Errorf("Create() of an existing person error = %v, want %v", err, mypackage.ErrAlreadyExists)
+	}
+
+	// someone else updates Johnny, so saving or updating our copy conflicts
+	if _, err := repo.Update(ctx, "p1", johnny.Version, map[string]interface{}{"Name": "John"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if _, err := repo.Update(ctx, "p1", johnny.Version, map[string]interface{}{"Name": "Jon"}); !errors.Is(err, mypackage.ErrVersionConflict) {
+		t.Errorf("Update() of a stale person error = %v, want %v", err, mypackage.ErrVersionConflict)
+	}
+	johnny.Name = "Jonathan"
+	if err := repo.Save(ctx, johnny); !errors.Is(err, mypackage.ErrVersionConflict) {
+		t.Errorf("Save() of a stale person error = %v, want %v", err, mypackage.ErrVersionConflict)
+	}
+
+	got, err := repo.Get(ctx, "p1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !got.UpdatedAt.After(got.CreatedAt) {
+		t.Errorf("Get() = %+v, want UpdatedAt after CreatedAt", got)
+	}
+	want := &mypackage.Person{ID: "p1", Name: "John", CreatedAt: got.CreatedAt, UpdatedAt: got.UpdatedAt, Version: 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+	got.Name = "Jonathan"
+	if err := repo.Save(ctx, got); err != nil || got.Version != 3 {
+		t.Errorf("Save() of the latest person error = %v, version %d", err, got.Version)
+	}
+
+	if _, err := repo.Update(ctx, "p9", 1, map[string]interface{}{"Name": "Nobody"}); !errors.Is(err, mypackage.ErrVersionConflict) {
+		t.Errorf("Update() of a missing person error = %v, want %v", err, mypackage.ErrVersionConflict)
+	}
+
+	// every fifth person is left unprocessed once
+	var mu sync.Mutex
+	retried := make(map[string]bool)
+	fake.Unprocessed = func(_ string, req *dynamodb.WriteRequest) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		id := aws.StringValue(req.PutRequest.Item["ID"].S)
+		if strings.HasSuffix(id, "5") && !retried[id] {
+			retried[id] = true
+			return true
+		}
+		return false
+	}
+	repo.DynamoDBBatchSaver.Backoff = time.Millisecond
+	var many []*mypackage.Person
+	for i := 0; i < 60; i++ {
+		many = append(many, &mypackage.Person{ID: fmt.Sprintf("batch-%02d", i), Name: "Batch"})
+	}
+	if err := repo.SaveAll(ctx, many); err != nil {
+		t.Fatalf("SaveAll() error = %v", err)
+	}
+
+	people, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(people) != 61 {
+		t.Errorf("List() returned %d people, want 61", len(people))
+	}
+
+	if err := repo.DeleteVersion(ctx, "p1", 2); !errors.Is(err, mypackage.ErrVersionConflict) {
+		t.Errorf("DeleteVersion() of a stale person error = %v, want %v", err, mypackage.ErrVersionConflict)
+	}
+	if err := repo.DeleteVersion(ctx, "p1", 3); err != nil {
+		t.Fatalf("DeleteVersion() error = %v", err)
+	}
+	if _, err := repo.Get(ctx, "p1"); !errors.Is(err, mypackage.ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want %v", err, mypackage.ErrNotFound)
+	}
+}
@@ -0,0 +1,342 @@
+package mypackage
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	DefaultRetries    = 8
+	DefaultRetryDelay = 25 * time.Millisecond
+	DefaultMaxDelay   = 5 * time.Second
+	DefaultMaxElapsed = 30 * time.Second
+)
+
+// DefaultRetryableCodes are the error codes a RetryPolicy retries when RetryableCodes is empty.
+var DefaultRetryableCodes = []string{
+	dynamodb.ErrCodeProvisionedThroughputExceededException,
+	dynamodb.ErrCodeRequestLimitExceeded,
+	"ThrottlingException",
+	dynamodb.ErrCodeInternalServerError,
+	"ServiceUnavailable",
+}
+
+// RetryMetrics receives counters from a RetryPolicy. Implementations must be safe for concurrent use.
+type RetryMetrics interface {
+	// Retried is called before a request that failed with err is sent again.
+	Retried(op string, attempt int, err error)
+	// GaveUp is called when a request still failed with a retryable error after attempts.
+	GaveUp(op string, attempts int, err error)
+}
+
+type noopRetryMetrics struct{}
+
+func (noopRetryMetrics) Retried(string, int, error) {}
+func (noopRetryMetrics) GaveUp(string, int, error)  {}
+
+// RetryPolicy decides which failed requests are sent again, and when.
+// It retries requests failing with a retryable error code, waiting an exponentially growing,
+// fully jittered delay in between. Zero values for the limits use the defaults,
+// and a negative MaxElapsed means no limit.
+type RetryPolicy struct {
+	Retries        int           // retries after the first attempt
+	RetryDelay     time.Duration // upper bound of the first wait, doubled for each retry
+	MaxDelay       time.Duration // upper bound of any wait
+	MaxElapsed     time.Duration // no retry starts after this long since the first attempt
+	RetryableCodes []string
+	Metrics        RetryMetrics
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+	codes := p.RetryableCodes
+	if len(codes) == 0 {
+		codes = DefaultRetryableCodes
+	}
+	for _, code := range codes {
+		if aerr.Code() == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Do calls send, the request named op, until it succeeds, fails with an error that isn't retryable,
+// or the retries, the time or the context run out.
+func (p RetryPolicy) Do(ctx context.Context, op string, send func() error) error {
+	retries := p.Retries
+	if retries <= 0 {
+		retries = DefaultRetries
+	}
+	delay := p.RetryDelay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxDelay
+	}
+	delay = min(delay, maxDelay)
+	maxElapsed := p.MaxElapsed
+	if maxElapsed == 0 {
+		maxElapsed = DefaultMaxElapsed
+	}
+	var metrics RetryMetrics = noopRetryMetrics{}
+	if p.Metrics != nil {
+		metrics = p.Metrics
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil || !p.retryable(err) {
+			return err
+		}
+
+		// full jitter keeps clients throttled together from retrying together
+		wait := time.Duration(rand.Int63n(int64(delay) + 1))
+		if attempt > retries || (maxElapsed > 0 && time.Since(start)+wait > maxElapsed) {
+			metrics.GaveUp(op, attempt, err)
+			return err
+		}
+		metrics.Retried(op, attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, maxDelay)
+	}
+}
+
+// errNoClient is returned by a retrying wrapper without a client to send requests to.
+var errNoClient = errors.New("client is required")
+
+// The retrying wrappers below each add the policy to a client of a single operation,
+// so a getter or saver keeps its narrow interface, e.g.
+//
+//	getter := &DynamoDBGetter{Client: &RetryingGetter{Client: svc}, Table: table}
+//
+// The AWS SDK retries on its own too, so the session's MaxRetries is best set to 0.
+
+// RetryingPutter retries PutItem requests to Client.
+type RetryingPutter struct {
+	Client ddbClient
+	RetryPolicy
+}
+
+func (c *RetryingPutter) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (output *dynamodb.PutItemOutput, err error) {
+	if c.Client == nil {
+		return nil, errNoClient
+	}
+	err = c.Do(ctx, "PutItem", func() error {
+		output, err = c.Client.PutItemWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// RetryingGetter retries GetItem requests to Client.
+type RetryingGetter struct {
+	Client ddbGetter
+	RetryPolicy
+}
+
+func (c *RetryingGetter) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (output *dynamodb.GetItemOutput, err error) {
+	if c.Client == nil {
+		return nil, errNoClient
+	}
+	err = c.Do(ctx, "GetItem", func() error {
+		output, err = c.Client.GetItemWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// RetryingUpdater retries UpdateItem requests to Client.
+type RetryingUpdater struct {
+	Client ddbUpdater
+	RetryPolicy
+}
+
+func (c *RetryingUpdater) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (output *dynamodb.UpdateItemOutput, err error) {
+	if c.Client == nil {
+		return nil, errNoClient
+	}
+	err = c.Do(ctx, "UpdateItem", func() error {
+		output, err = c.Client.UpdateItemWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// RetryingDeleter retries DeleteItem requests to Client.
+type RetryingDeleter struct {
+	Client ddbDeleter
+	RetryPolicy
+}
+
+func (c *RetryingDeleter) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (output *dynamodb.DeleteItemOutput, err error) {
+	if c.Client == nil {
+		return nil, errNoClient
+	}
+	err = c.Do(ctx, "DeleteItem", func() error {
+		output, err = c.Client.DeleteItemWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// RetryingScanner retries Scan requests to Client.
+type RetryingScanner struct {
+	Client ddbScanner
+	RetryPolicy
+}
+
+func (c *RetryingScanner) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (output *dynamodb.ScanOutput, err error) {
+	if c.Client == nil {
+		return nil, errNoClient
+	}
+	err = c.Do(ctx, "Scan", func() error {
+		output, err = c.Client.ScanWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// RetryingQuerier retries Query requests to Client.
+type RetryingQuerier struct {
+	Client ddbQuerier
+	RetryPolicy
+}
+
+func (c *RetryingQuerier) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (output *dynamodb.QueryOutput, err error) {
+	if c.Client == nil {
+		return nil, errNoClient
+	}
+	err = c.Do(ctx, "Query", func() error {
+		output, err = c.Client.QueryWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// RetryingBatchWriter retries BatchWriteItem requests to Client. It only retries failed requests:
+// unprocessed items are left to the caller, as DynamoDBBatchSaver does.
+type RetryingBatchWriter struct {
+	Client ddbBatchWriter
+	RetryPolicy
+}
+
+func (c *RetryingBatchWriter) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (output *dynamodb.BatchWriteItemOutput, err error) {
+	if c.Client == nil {
+		return nil, errNoClient
+	}
+	err = c.Do(ctx, "BatchWriteItem", func() error {
+		output, err = c.Client.BatchWriteItemWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// RetryingBatchGetter retries BatchGetItem requests to Client. Like RetryingBatchWriter,
+// it leaves unprocessed keys to the caller.
+type RetryingBatchGetter struct {
+	Client ddbBatchGetter
+	RetryPolicy
+}
+
+func (c *RetryingBatchGetter) BatchGetItemWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts ...request.Option) (output *dynamodb.BatchGetItemOutput, err error) {
+	if c.Client == nil {
+		return nil, errNoClient
+	}
+	err = c.Do(ctx, "BatchGetItem", func() error {
+		output, err = c.Client.BatchGetItemWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// RetryingTransactor retries TransactWriteItems requests to Client.
+type RetryingTransactor struct {
+	Client ddbTransactor
+	RetryPolicy
+}
+
+func (c *RetryingTransactor) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (output *dynamodb.TransactWriteItemsOutput, err error) {
+	if c.Client == nil {
+		return nil, errNoClient
+	}
+	err = c.Do(ctx, "TransactWriteItems", func() error {
+		output, err = c.Client.TransactWriteItemsWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// RetryingClient retries every request PersonRepository sends to Client, so it can stand in
+// for the client of a repository. Savers needing a single operation can use its narrow wrapper instead.
+type RetryingClient struct {
+	Client ddbRepositoryClient
+	RetryPolicy
+}
+
+// NewRetryingClient returns a RetryingClient with the default policy.
+func NewRetryingClient(client ddbRepositoryClient) (*RetryingClient, error) {
+	c := &RetryingClient{Client: client}
+	return c, c.validate()
+}
+
+func (c *RetryingClient) validate() error {
+	if c.Client == nil {
+		return errNoClient
+	}
+	return nil
+}
+
+func (c *RetryingClient) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	return (&RetryingPutter{Client: c.Client, RetryPolicy: c.RetryPolicy}).PutItemWithContext(ctx, input, opts...)
+}
+
+func (c *RetryingClient) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	return (&RetryingGetter{Client: c.Client, RetryPolicy: c.RetryPolicy}).GetItemWithContext(ctx, input, opts...)
+}
+
+func (c *RetryingClient) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	return (&RetryingUpdater{Client: c.Client, RetryPolicy: c.RetryPolicy}).UpdateItemWithContext(ctx, input, opts...)
+}
+
+func (c *RetryingClient) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	return (&RetryingDeleter{Client: c.Client, RetryPolicy: c.RetryPolicy}).DeleteItemWithContext(ctx, input, opts...)
+}
+
+func (c *RetryingClient) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	return (&RetryingScanner{Client: c.Client, RetryPolicy: c.RetryPolicy}).ScanWithContext(ctx, input, opts...)
+}
+
+func (c *RetryingClient) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	return (&RetryingQuerier{Client: c.Client, RetryPolicy: c.RetryPolicy}).QueryWithContext(ctx, input, opts...)
+}
+
+func (c *RetryingClient) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	return (&RetryingBatchWriter{Client: c.Client, RetryPolicy: c.RetryPolicy}).BatchWriteItemWithContext(ctx, input, opts...)
+}
+
+func (c *RetryingClient) BatchGetItemWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	return (&RetryingBatchGetter{Client: c.Client, RetryPolicy: c.RetryPolicy}).BatchGetItemWithContext(ctx, input, opts...)
+}
+
+func (c *RetryingClient) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	return (&RetryingTransactor{Client: c.Client, RetryPolicy: c.RetryPolicy}).TransactWriteItemsWithContext(ctx, input, opts...)
+}
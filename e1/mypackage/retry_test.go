@@ -0,0 +1,263 @@
+package mypackage_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+	"github.com/idiomat/dodtnyt/e1/mypackage/ddbfake"
+)
+
+type retryMetrics struct {
+	mu      sync.Mutex
+	retried map[string]int
+	gaveUp  []int
+}
+
+func (m *retryMetrics) Retried(op string, attempt int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.retried == nil {
+		m.retried = make(map[string]int)
+	}
+	m.retried[op]++
+}
+
+func (m *retryMetrics) GaveUp(op string, attempts int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gaveUp = append(m.gaveUp, attempts)
+}
+
+// retryingSaverClient retries both requests a DynamoDBSaver sends.
+type retryingSaverClient struct {
+	*mypackage.RetryingPutter
+	*mypackage.RetryingUpdater
+}
+
+func TestRetryPolicy(t *testing.T) {
+	throttled := awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil)
+	failing := errors.New("failed to save")
+
+	tests := map[string]struct {
+		failures    int   // calls failing before the fake works again, -1 for all
+		err         error // what they fail with
+		slow        time.Duration
+		policy      mypackage.RetryPolicy
+		cancel      bool
+		wantErr     error
+		wantRetries int
+		wantGaveUp  []int
+	}{
+		"no failures": {},
+		"throttled then saved": {
+			failures:    3,
+			err:         throttled,
+			wantRetries: 3,
+		},
+		"other code": {
+			failures: 1,
+			err:      awserr.New(dynamodb.ErrCodeResourceNotFoundException, "no table", nil),
+			wantErr:  mypackage.ErrResourceNotFound,
+		},
+		"not an AWS error": {
+			failures: 1,
+			err:      failing,
+			wantErr:  failing,
+		},
+		"retries run out": {
+			failures:    -1,
+			err:         throttled,
+			policy:      mypackage.RetryPolicy{Retries: 2},
+			wantErr:     mypackage.ErrThrottled,
+			wantRetries: 2,
+			wantGaveUp:  []int{3},
+		},
+		"time runs out": {
+			failures:   -1,
+			err:        throttled,
+			slow:       5 * time.Millisecond,
+			policy:     mypackage.RetryPolicy{MaxElapsed: time.Millisecond},
+			wantErr:    mypackage.ErrThrottled,
+			wantGaveUp: []int{1},
+		},
+		"configured codes": {
+			failures:    2,
+			err:         awserr.New("TransactionInProgressException", "busy", nil),
+			policy:      mypackage.RetryPolicy{RetryableCodes: []string{"TransactionInProgressException"}},
+			wantRetries: 2,
+		},
+		"cancelled while waiting": {
+			failures:    -1,
+			err:         throttled,
+			policy:      mypackage.RetryPolicy{RetryDelay: time.Hour, MaxDelay: time.Hour, MaxElapsed: -1},
+			cancel:      true,
+			wantErr:     context.Canceled,
+			wantRetries: 1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			fake := ddbfake.New()
+			if err := fake.CreateTable("people", "ID", ""); err != nil {
+				t.Fatalf("CreateTable() error = %v", err)
+			}
+			calls := 0
+			fake.Hook = func(op string, input interface{}) error {
+				calls++
+				time.Sleep(tc.slow)
+				if tc.cancel {
+					// cancel once the request is sure to be retried
+					time.AfterFunc(10*time.Millisecond, cancel)
+				}
+				if tc.failures < 0 || calls <= tc.failures {
+					return tc.err
+				}
+				return nil
+			}
+
+			metrics := &retryMetrics{}
+			policy := tc.policy
+			policy.Metrics = metrics
+			if policy.RetryDelay == 0 {
+				policy.RetryDelay = time.Millisecond
+			}
+			client := &retryingSaverClient{
+				RetryingPutter:  &mypackage.RetryingPutter{Client: fake, RetryPolicy: policy},
+				RetryingUpdater: &mypackage.RetryingUpdater{Client: fake, RetryPolicy: policy},
+			}
+			saver := &mypackage.DynamoDBSaver{Client: client, Table: table}
+
+			err := saver.Save(ctx, &mypackage.Person{ID: "p1", Name: "Johnny"})
+			switch {
+			case tc.wantErr == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.wantErr != nil && !errors.Is(err, tc.wantErr):
+				t.Fatalf("expected %v but got %v", tc.wantErr, err)
+			}
+			// a new Person without CreatedAt is saved with UpdateItem
+			if got := metrics.retried["UpdateItem"]; got != tc.wantRetries {
+				t.Errorf("expected %d retries but got %d", tc.wantRetries, got)
+			}
+			if len(metrics.gaveUp) != len(tc.wantGaveUp) || (len(tc.wantGaveUp) > 0 && metrics.gaveUp[0] != tc.wantGaveUp[0]) {
+				t.Errorf("expected giving up after %v attempts but got %v", tc.wantGaveUp, metrics.gaveUp)
+			}
+		})
+	}
+}
+
+func TestNewRetryingClient(t *testing.T) {
+	if _, err := mypackage.NewRetryingClient(nil); err == nil {
+		t.Errorf("expected error for nil client")
+	}
+
+	client, err := mypackage.NewRetryingClient(ddbfake.New())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := mypackage.NewPersonRepository(client, table); err != nil {
+		t.Errorf("expected a RetryingClient to work for a repository: %v", err)
+	}
+}
+
+func TestRetryingWrappers(t *testing.T) {
+	ctx := context.Background()
+	name := aws.String(table.Name)
+	key := map[string]*dynamodb.AttributeValue{"ID": {S: aws.String("p1")}}
+	put := &dynamodb.PutRequest{Item: key}
+
+	tests := map[string]func(fake *ddbfake.Fake, policy mypackage.RetryPolicy) error{
+		"PutItem": func(fake *ddbfake.Fake, policy mypackage.RetryPolicy) error {
+			_, err := (&mypackage.RetryingPutter{Client: fake, RetryPolicy: policy}).PutItemWithContext(ctx, &dynamodb.PutItemInput{TableName: name, Item: key})
+			return err
+		},
+		"GetItem": func(fake *ddbfake.Fake, policy mypackage.RetryPolicy) error {
+			_, err := (&mypackage.RetryingGetter{Client: fake, RetryPolicy: policy}).GetItemWithContext(ctx, &dynamodb.GetItemInput{TableName: name, Key: key})
+			return err
+		},
+		"UpdateItem": func(fake *ddbfake.Fake, policy mypackage.RetryPolicy) error {
+			_, err := (&mypackage.RetryingUpdater{Client: fake, RetryPolicy: policy}).UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+				TableName:                 name,
+				Key:                       key,
+				UpdateExpression:          aws.String("SET #name = :name"),
+				ExpressionAttributeNames:  map[string]*string{"#name": aws.String("Name")},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":name": {S: aws.String("Johnny")}},
+			})
+			return err
+		},
+		"DeleteItem": func(fake *ddbfake.Fake, policy mypackage.RetryPolicy) error {
+			_, err := (&mypackage.RetryingDeleter{Client: fake, RetryPolicy: policy}).DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{TableName: name, Key: key})
+			return err
+		},
+		"Scan": func(fake *ddbfake.Fake, policy mypackage.RetryPolicy) error {
+			_, err := (&mypackage.RetryingScanner{Client: fake, RetryPolicy: policy}).ScanWithContext(ctx, &dynamodb.ScanInput{TableName: name})
+			return err
+		},
+		"Query": func(fake *ddbfake.Fake, policy mypackage.RetryPolicy) error {
+			_, err := (&mypackage.RetryingQuerier{Client: fake, RetryPolicy: policy}).QueryWithContext(ctx, &dynamodb.QueryInput{
+				TableName:                 name,
+				KeyConditionExpression:    aws.String("#id = :id"),
+				ExpressionAttributeNames:  map[string]*string{"#id": aws.String("ID")},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":id": {S: aws.String("p1")}},
+			})
+			return err
+		},
+		"BatchWriteItem": func(fake *ddbfake.Fake, policy mypackage.RetryPolicy) error {
+			_, err := (&mypackage.RetryingBatchWriter{Client: fake, RetryPolicy: policy}).BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]*dynamodb.WriteRequest{table.Name: {{PutRequest: put}}},
+			})
+			return err
+		},
+		"BatchGetItem": func(fake *ddbfake.Fake, policy mypackage.RetryPolicy) error {
+			_, err := (&mypackage.RetryingBatchGetter{Client: fake, RetryPolicy: policy}).BatchGetItemWithContext(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: map[string]*dynamodb.KeysAndAttributes{table.Name: {Keys: []map[string]*dynamodb.AttributeValue{key}}},
+			})
+			return err
+		},
+		"TransactWriteItems": func(fake *ddbfake.Fake, policy mypackage.RetryPolicy) error {
+			_, err := (&mypackage.RetryingTransactor{Client: fake, RetryPolicy: policy}).TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+				TransactItems: []*dynamodb.TransactWriteItem{{Put: &dynamodb.Put{TableName: name, Item: key}}},
+			})
+			return err
+		},
+	}
+
+	for op, send := range tests {
+		t.Run(op, func(t *testing.T) {
+			fake := ddbfake.New()
+			if err := fake.CreateTable(table.Name, "ID", ""); err != nil {
+				t.Fatalf("CreateTable() error = %v", err)
+			}
+			calls := 0
+			fake.Hook = func(string, interface{}) error {
+				calls++
+				if calls == 1 {
+					return awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil)
+				}
+				return nil
+			}
+
+			metrics := &retryMetrics{}
+			if err := send(fake, mypackage.RetryPolicy{RetryDelay: time.Millisecond, Metrics: metrics}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := metrics.retried[op]; got != 1 {
+				t.Errorf("expected 1 retry of %s but got %d", op, got)
+			}
+		})
+	}
+
+	if _, err := (&mypackage.RetryingGetter{}).GetItemWithContext(ctx, &dynamodb.GetItemInput{TableName: name, Key: key}); err == nil {
+		t.Errorf("expected error for a wrapper without a client")
+	}
+}
@@ -0,0 +1,22 @@
+package mypackage
+
+import "context"
+
+// PersonStore persists people, whatever the storage behind it.
+//
+// Save validates p and sets its timestamps, and its version when the store is versioned,
+// in which case saving a Person that changed since it was read returns ErrVersionConflict.
+// A Person saved without CreatedAt keeps the one stored, if any.
+// Get returns ErrNotFound for a missing Person, while deleting one is not an error.
+type PersonStore interface {
+	Save(ctx context.Context, p *Person) error
+	Get(ctx context.Context, id string) (*Person, error)
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context) ([]*Person, error)
+}
+
+var (
+	_ PersonStore = (*PersonRepository)(nil)
+	_ PersonStore = (*GormStore)(nil)
+	_ PersonStore = (*FileStore)(nil)
+)
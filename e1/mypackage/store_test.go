@@ -0,0 +1,287 @@
+package mypackage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+)
+
+// testPersonStore is the contract every versioned PersonStore fulfils.
+// newStore returns an empty store.
+func testPersonStore(t *testing.T, newStore func(t *testing.T) mypackage.PersonStore) {
+	t.Run("save and get", func(t *testing.T) {
+		s := newStore(t)
+		ctx := context.Background()
+
+		p := &mypackage.Person{
+			ID:        "p1",
+			Name:      "Johnny",
+			Email:     "johnny@example.com",
+			BirthDate: "1990-05-17",
+			Address:   &mypackage.Address{Street: "Rua Augusta 1", City: "Lisboa", Country: "PT"},
+			Tags:      []string{"customer", "vip"},
+		}
+		if err := s.Save(ctx, p); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if p.Version != 1 || p.CreatedAt.IsZero() || !p.UpdatedAt.Equal(p.CreatedAt) {
+			t.Errorf("expected Save() to set the version and timestamps but got %+v", p)
+		}
+
+		got, err := s.Get(ctx, "p1")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, p) {
+			t.Errorf("Get() = %+v, want %+v", got, p)
+		}
+
+		// what Get returns isn't the stored Person
+		got.Address.City = "Porto"
+		if again, _ := s.Get(ctx, "p1"); again.Address.City != "Lisboa" {
+			t.Errorf("expected changing a Person read to leave the store alone but got %+v", again.Address)
+		}
+	})
+
+	t.Run("versions", func(t *testing.T) {
+		s := newStore(t)
+		ctx := context.Background()
+
+		p := &mypackage.Person{ID: "p1", Name: "Johnny"}
+		if err := s.Save(ctx, p); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		created := p.CreatedAt
+		stale := *p
+
+		p.Name = "John"
+		if err := s.Save(ctx, p); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if p.Version != 2 || !p.CreatedAt.Equal(created) || !p.UpdatedAt.After(created) {
+			t.Errorf("expected Save() to bump the version and UpdatedAt only but got %+v", p)
+		}
+
+		stale.Name = "Jonathan"
+		if err := s.Save(ctx, &stale); !errors.Is(err, mypackage.ErrVersionConflict) {
+			t.Errorf("expected Save() of a stale person to fail with %v but got %v", mypackage.ErrVersionConflict, err)
+		}
+		if stale.Version != 1 || stale.Name != "Jonathan" {
+			t.Errorf("expected a failed Save() to leave the person alone but got %+v", stale)
+		}
+		if err := s.Save(ctx, &mypackage.Person{ID: "p1", Name: "Other"}); !errors.Is(err, mypackage.ErrVersionConflict) {
+			t.Errorf("expected Save() of a new person with an existing ID to fail with %v but got %v", mypackage.ErrVersionConflict, err)
+		}
+
+		got, err := s.Get(ctx, "p1")
+		if err != nil || got.Name != "John" || got.Version != 2 {
+			t.Errorf("Get() = %+v, %v, want John at version 2", got, err)
+		}
+	})
+
+	t.Run("save again without CreatedAt", func(t *testing.T) {
+		testResave(t, newStore(t))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		s := newStore(t)
+		ctx := context.Background()
+
+		if err := s.Save(ctx, &mypackage.Person{ID: "p1", Email: "johnny"}); !errors.Is(err, mypackage.ErrValidation) {
+			t.Errorf("expected %v but got %v", mypackage.ErrValidation, err)
+		}
+		if _, err := s.Get(ctx, "p1"); !errors.Is(err, mypackage.ErrNotFound) {
+			t.Errorf("expected nothing saved but got %v", err)
+		}
+		if err := s.Save(ctx, nil); !errors.Is(err, mypackage.ErrValidation) {
+			t.Errorf("expected Save() of nil to fail with %v but got %v", mypackage.ErrValidation, err)
+		}
+	})
+
+	t.Run("list and delete", func(t *testing.T) {
+		s := newStore(t)
+		ctx := context.Background()
+
+		for _, p := range people(3) {
+			if err := s.Save(ctx, p); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+		}
+		if err := s.Delete(ctx, "p1"); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if err := s.Delete(ctx, "p9"); err != nil {
+			t.Errorf("Delete() of a missing person error = %v", err)
+		}
+		if _, err := s.Get(ctx, "p1"); !errors.Is(err, mypackage.ErrNotFound) {
+			t.Errorf("expected %v but got %v", mypackage.ErrNotFound, err)
+		}
+
+		all, err := s.List(ctx)
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		var ids []string
+		for _, p := range all {
+			ids = append(ids, p.ID)
+		}
+		sort.Strings(ids)
+		if want := []string{"p0", "p2"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("List() = %v, want %v", ids, want)
+		}
+	})
+}
+
+// testResave checks that saving a Person again without its CreatedAt, as a client
+// that never read it would, keeps the stored one.
+func testResave(t *testing.T, s mypackage.PersonStore) {
+	ctx := context.Background()
+
+	p := &mypackage.Person{ID: "p1", Name: "Johnny"}
+	if err := s.Save(ctx, p); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	created := p.CreatedAt
+
+	again := &mypackage.Person{ID: "p1", Name: "John", Version: p.Version}
+	if err := s.Save(ctx, again); err != nil {
+		t.Fatalf("Save() again error = %v", err)
+	}
+	if !again.CreatedAt.Equal(created) || !again.UpdatedAt.After(created) {
+		t.Errorf("expected Save() to keep CreatedAt %v and bump UpdatedAt but got %+v", created, again)
+	}
+
+	got, err := s.Get(ctx, "p1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Name != "John" || !got.CreatedAt.Equal(created) {
+		t.Errorf("Get() = %+v, want John created at %v", got, created)
+	}
+}
+
+func TestPersonStore_ResaveUnversioned(t *testing.T) {
+	tests := map[string]func(t *testing.T) mypackage.PersonStore{
+		"DynamoDB": func(t *testing.T) mypackage.PersonStore {
+			repo, err := mypackage.NewPersonRepository(newPeopleFake(t), table)
+			if err != nil {
+				t.Fatalf("NewPersonRepository() error = %v", err)
+			}
+			return repo
+		},
+		"File": func(t *testing.T) mypackage.PersonStore {
+			s, err := mypackage.NewFileStore(filepath.Join(t.TempDir(), "people.jsonl"))
+			if err != nil {
+				t.Fatalf("NewFileStore() error = %v", err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	}
+
+	for name, newStore := range tests {
+		t.Run(name, func(t *testing.T) {
+			testResave(t, newStore(t))
+		})
+	}
+}
+
+func TestPersonStore_DynamoDB(t *testing.T) {
+	testPersonStore(t, func(t *testing.T) mypackage.PersonStore {
+		repo, err := mypackage.NewPersonRepository(newPeopleFake(t), table)
+		if err != nil {
+			t.Fatalf("NewPersonRepository() error = %v", err)
+		}
+		repo.DynamoDBSaver.Versioned = true
+		return repo
+	})
+}
+
+func TestPersonStore_File(t *testing.T) {
+	testPersonStore(t, func(t *testing.T) mypackage.PersonStore {
+		s, err := mypackage.NewFileStore(filepath.Join(t.TempDir(), "people.jsonl"))
+		if err != nil {
+			t.Fatalf("NewFileStore() error = %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		s.Versioned = true
+		return s
+	})
+}
+
+func TestFileStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.jsonl")
+	ctx := context.Background()
+
+	s, err := mypackage.NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	johnny := &mypackage.Person{ID: "p1", Name: "Johnny", Tags: []string{"vip"}}
+	for _, p := range append(people(2), johnny) {
+		if err := s.Save(ctx, p); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	if err := s.Delete(ctx, "p0"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := s.Get(ctx, "p1"); !errors.Is(err, mypackage.ErrStoreClosed) {
+		t.Errorf("expected %v but got %v", mypackage.ErrStoreClosed, err)
+	}
+
+	// a crash while appending leaves an incomplete line behind
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"Person":{"ID":"p7"`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	s, err = mypackage.NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	defer s.Close()
+	all, err := s.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(all) != 1 || !reflect.DeepEqual(all[0], johnny) {
+		t.Errorf("List() = %+v, want only %+v", all, johnny)
+	}
+
+	// the store appends after the last complete line
+	if err := s.Delete(ctx, "p1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	s.Close()
+	if s, err = mypackage.NewFileStore(path); err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	defer s.Close()
+	if all, _ := s.List(ctx); len(all) != 0 {
+		t.Errorf("expected no people left but got %+v", all)
+	}
+}
+
+func TestNewFileStore_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.jsonl")
+	if err := os.WriteFile(path, []byte("{}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mypackage.NewFileStore(path); err == nil {
+		t.Errorf("expected error for a corrupt file")
+	}
+}
@@ -0,0 +1,413 @@
+package mypackage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Event names of a StreamRecord, as DynamoDB Streams reports them.
+const (
+	EventInsert = "INSERT"
+	EventModify = "MODIFY"
+	EventRemove = "REMOVE"
+)
+
+const (
+	DefaultStreamBatchSize    = 100
+	DefaultStreamPollInterval = time.Second
+	DefaultHandlerRetries     = 3
+	DefaultHandlerRetryDelay  = 100 * time.Millisecond
+)
+
+// ShardEnd is the checkpoint of a shard that is closed and was processed to the end.
+const ShardEnd = "SHARD_END"
+
+// StreamRecord is a change to a stored item, like those DynamoDB Streams reports.
+type StreamRecord struct {
+	SequenceNumber string // orders the records of a shard
+	EventName      string
+	Keys           map[string]*dynamodb.AttributeValue
+	OldImage       map[string]*dynamodb.AttributeValue // the item before, unless it's an insert or the stream doesn't keep it
+	NewImage       map[string]*dynamodb.AttributeValue // the item after, unless it's a removal
+}
+
+// Shard is a part of a stream. A shard is only read once its parent, if it still exists, was read to the end.
+type Shard struct {
+	ID       string
+	ParentID string
+}
+
+// ShardReader reads a stream of changes a shard at a time, like DynamoDB Streams.
+type ShardReader interface {
+	// Shards returns the shards of the stream.
+	Shards(ctx context.Context) ([]Shard, error)
+	// ReadRecords returns at most limit records of shard following the one with sequence number after,
+	// or from the start if after is empty. closed is true when they are the last records of the shard.
+	ReadRecords(ctx context.Context, shard, after string, limit int) (records []*StreamRecord, closed bool, err error)
+}
+
+// Checkpointer records how far each shard was processed.
+type Checkpointer interface {
+	// Checkpoint records that shard was processed up to the record with sequence number seq, or ShardEnd.
+	Checkpoint(ctx context.Context, shard, seq string) error
+	// LastCheckpoint returns the last sequence number recorded for shard, or "" if there is none.
+	LastCheckpoint(ctx context.Context, shard string) (string, error)
+}
+
+// PersonChange is a StreamRecord with its images decoded.
+type PersonChange struct {
+	Shard          string
+	SequenceNumber string
+	EventName      string
+	ID             string
+	Old            *Person // nil for an insert, or when the stream doesn't keep old images
+	New            *Person // nil for a removal
+}
+
+// ChangeHandler reacts to a change. When it fails, the change is delivered again.
+type ChangeHandler func(ctx context.Context, c *PersonChange) error
+
+// StreamError is a change that couldn't be decoded, or handled even after retrying.
+type StreamError struct {
+	Shard          string
+	SequenceNumber string
+	Err            error
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("shard %s record %s: %v", e.Shard, e.SequenceNumber, e.Err)
+}
+
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+// StreamConfig configures a StreamProcessor. Zero values use the defaults.
+type StreamConfig struct {
+	// OnInsert, OnModify and OnRemove handle the changes of each kind. Changes without a handler are skipped.
+	// Shards are processed concurrently, so the handlers must be safe for concurrent use.
+	OnInsert, OnModify, OnRemove ChangeHandler
+	// Encryption decrypts the images of people stored in an encrypted Table.
+	Encryption   *FieldEncrypter
+	BatchSize    int           // records read at a time
+	PollInterval time.Duration // how long to wait before looking for new records or shards
+	Retries      int           // times a failed change is retried before the processor stops
+	RetryDelay   time.Duration // before the first retry, doubling with each one
+}
+
+// StreamProcessor reads changes to people from a stream, dispatches them to handlers,
+// and checkpoints how far it got. Changes are delivered at least once: those after the last
+// checkpoint of a shard are delivered again when processing resumes, so handlers should be idempotent.
+// The changes of a shard are delivered in order, one at a time.
+type StreamProcessor struct {
+	reader      ShardReader
+	checkpoints Checkpointer
+	onInsert    ChangeHandler
+	onModify    ChangeHandler
+	onRemove    ChangeHandler
+	table       Table // only used to decode images
+	batch       int
+	interval    time.Duration
+	retries     int
+	retryDelay  time.Duration
+}
+
+// NewStreamProcessor returns a StreamProcessor reading from reader and checkpointing to checkpoints.
+func NewStreamProcessor(reader ShardReader, checkpoints Checkpointer, cfg StreamConfig) (*StreamProcessor, error) {
+	if reader == nil {
+		return nil, errors.New("shard reader is required")
+	}
+	if checkpoints == nil {
+		return nil, errors.New("checkpointer is required")
+	}
+	if cfg.OnInsert == nil && cfg.OnModify == nil && cfg.OnRemove == nil {
+		return nil, errors.New("a handler is required")
+	}
+	sp := &StreamProcessor{
+		reader:      reader,
+		checkpoints: checkpoints,
+		onInsert:    cfg.OnInsert,
+		onModify:    cfg.OnModify,
+		onRemove:    cfg.OnRemove,
+		table:       Table{Encryption: cfg.Encryption},
+		batch:       cfg.BatchSize,
+		interval:    cfg.PollInterval,
+		retries:     cfg.Retries,
+		retryDelay:  cfg.RetryDelay,
+	}
+	if sp.batch == 0 {
+		sp.batch = DefaultStreamBatchSize
+	}
+	if sp.interval == 0 {
+		sp.interval = DefaultStreamPollInterval
+	}
+	if sp.retries == 0 {
+		sp.retries = DefaultHandlerRetries
+	}
+	if sp.retryDelay == 0 {
+		sp.retryDelay = DefaultHandlerRetryDelay
+	}
+	return sp, sp.validate()
+}
+
+func (sp *StreamProcessor) validate() error {
+	if sp.batch < 1 {
+		return fmt.Errorf("invalid batch size: %d", sp.batch)
+	}
+	if sp.interval < 0 {
+		return fmt.Errorf("invalid poll interval: %s", sp.interval)
+	}
+	if sp.retries < 0 {
+		return fmt.Errorf("invalid number of retries: %d", sp.retries)
+	}
+	if sp.retryDelay < 0 {
+		return fmt.Errorf("invalid retry delay: %s", sp.retryDelay)
+	}
+	return nil
+}
+
+// Run processes the stream until ctx is done, a change fails, or every shard is closed and
+// was processed to the end. Shards are processed concurrently, a child only after its parent.
+// It returns a *StreamError for a change that failed, which is delivered again by the next Run.
+func (sp *StreamProcessor) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		shard string
+		err   error
+	}
+	results := make(chan result)
+	running := make(map[string]bool)
+	finished := make(map[string]bool)
+
+	var err error
+loop:
+	for {
+		var shards []Shard
+		if shards, err = sp.reader.Shards(ctx); err != nil {
+			break
+		}
+		exists := make(map[string]bool, len(shards))
+		for _, s := range shards {
+			exists[s.ID] = true
+		}
+		for _, s := range shards {
+			if running[s.ID] || finished[s.ID] {
+				continue
+			}
+			// once a parent is trimmed from the stream, its children can go ahead
+			if s.ParentID != "" && exists[s.ParentID] && !finished[s.ParentID] {
+				continue
+			}
+			running[s.ID] = true
+			go func(shard string) {
+				results <- result{shard: shard, err: sp.processShard(ctx, shard)}
+			}(s.ID)
+		}
+		if len(running) == 0 {
+			// nothing waits for a parent that isn't running, so every shard is finished
+			return nil
+		}
+
+		select {
+		case r := <-results:
+			delete(running, r.shard)
+			if r.err != nil {
+				err = r.err
+				break loop
+			}
+			finished[r.shard] = true
+		case <-time.After(sp.interval):
+		case <-ctx.Done():
+			err = ctx.Err()
+			break loop
+		}
+	}
+
+	cancel()
+	for range running {
+		<-results
+	}
+	return err
+}
+
+// processShard delivers the changes of shard after its last checkpoint, until it is closed and read to the end.
+func (sp *StreamProcessor) processShard(ctx context.Context, shard string) error {
+	after, err := sp.checkpoints.LastCheckpoint(ctx, shard)
+	if err != nil {
+		return fmt.Errorf("shard %s: %w", shard, err)
+	}
+	if after == ShardEnd {
+		return nil
+	}
+
+	// checkpoints are recorded even when stopping, so what was handled isn't delivered again
+	checkpoint := func(seq string) error {
+		if err := sp.checkpoints.Checkpoint(context.WithoutCancel(ctx), shard, seq); err != nil {
+			return fmt.Errorf("shard %s: failed to checkpoint %s: %w", shard, seq, err)
+		}
+		return nil
+	}
+
+	for {
+		records, closed, err := sp.reader.ReadRecords(ctx, shard, after, sp.batch)
+		if err != nil {
+			return fmt.Errorf("shard %s: %w", shard, err)
+		}
+
+		handled := after
+		for _, r := range records {
+			if err = sp.deliver(ctx, shard, r); err != nil {
+				break
+			}
+			handled = r.SequenceNumber
+		}
+		if handled != after {
+			if cpErr := checkpoint(handled); cpErr != nil {
+				return errors.Join(err, cpErr)
+			}
+			after = handled
+		}
+		if err != nil {
+			return err
+		}
+
+		if closed {
+			return checkpoint(ShardEnd)
+		}
+		if len(records) == 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(sp.interval):
+			}
+		}
+	}
+}
+
+func (sp *StreamProcessor) handler(event string) (ChangeHandler, error) {
+	switch event {
+	case EventInsert:
+		return sp.onInsert, nil
+	case EventModify:
+		return sp.onModify, nil
+	case EventRemove:
+		return sp.onRemove, nil
+	}
+	return nil, fmt.Errorf("unknown event %q", event)
+}
+
+// deliver hands the change r records to its handler, retrying it while it fails.
+func (sp *StreamProcessor) deliver(ctx context.Context, shard string, r *StreamRecord) error {
+	handle, err := sp.handler(r.EventName)
+	if err != nil {
+		return &StreamError{Shard: shard, SequenceNumber: r.SequenceNumber, Err: err}
+	}
+	if handle == nil {
+		return nil
+	}
+	change, err := sp.decode(shard, r)
+	if err != nil {
+		return &StreamError{Shard: shard, SequenceNumber: r.SequenceNumber, Err: err}
+	}
+
+	delay := sp.retryDelay
+	for attempt := 0; ; attempt++ {
+		err := handle(ctx, change)
+		if err == nil {
+			return nil
+		}
+		if attempt >= sp.retries {
+			return &StreamError{Shard: shard, SequenceNumber: r.SequenceNumber, Err: err}
+		}
+		select {
+		case <-ctx.Done():
+			return &StreamError{Shard: shard, SequenceNumber: r.SequenceNumber, Err: errors.Join(err, ctx.Err())}
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (sp *StreamProcessor) decode(shard string, r *StreamRecord) (*PersonChange, error) {
+	c := &PersonChange{Shard: shard, SequenceNumber: r.SequenceNumber, EventName: r.EventName, ID: itemID(r.Keys)}
+	var err error
+	if len(r.OldImage) > 0 {
+		if c.Old, err = sp.table.person(r.OldImage); err != nil {
+			return nil, fmt.Errorf("old image: %w", err)
+		}
+		c.ID = c.Old.ID
+	}
+	if len(r.NewImage) > 0 {
+		if c.New, err = sp.table.person(r.NewImage); err != nil {
+			return nil, fmt.Errorf("new image: %w", err)
+		}
+		c.ID = c.New.ID
+	}
+	return c, nil
+}
+
+// ddbCheckpointClient is what DynamoDBCheckpointer needs.
+type ddbCheckpointClient interface {
+	ddbClient
+	ddbGetter
+}
+
+// DynamoDBCheckpointer keeps the checkpoints of a StreamProcessor in a DynamoDB table keyed by shard ID,
+// so processing resumes where it stopped.
+type DynamoDBCheckpointer struct {
+	Client ddbCheckpointClient
+	Table  Table
+}
+
+// NewDynamoDBCheckpointer returns a DynamoDBCheckpointer keeping checkpoints in table.
+func NewDynamoDBCheckpointer(client ddbCheckpointClient, table Table) (*DynamoDBCheckpointer, error) {
+	c := &DynamoDBCheckpointer{Client: client, Table: table}
+	return c, c.validate()
+}
+
+func (c *DynamoDBCheckpointer) validate() error {
+	if c.Client == nil {
+		return errors.New("client is required")
+	}
+	return c.Table.validate()
+}
+
+func (c *DynamoDBCheckpointer) Checkpoint(ctx context.Context, shard, seq string) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	item := c.Table.key(shard)
+	item["SequenceNumber"] = &dynamodb.AttributeValue{S: aws.String(seq)}
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(c.Table.Name),
+		Item:      item,
+	}
+	_, err := c.Client.PutItemWithContext(ctx, input)
+	return wrapErr("PutItem", err)
+}
+
+func (c *DynamoDBCheckpointer) LastCheckpoint(ctx context.Context, shard string) (string, error) {
+	if err := c.validate(); err != nil {
+		return "", err
+	}
+	input := &dynamodb.GetItemInput{
+		TableName:      aws.String(c.Table.Name),
+		Key:            c.Table.key(shard),
+		ConsistentRead: aws.Bool(true),
+	}
+	output, err := c.Client.GetItemWithContext(ctx, input)
+	if err != nil {
+		return "", wrapErr("GetItem", err)
+	}
+	if seq := output.Item["SequenceNumber"]; seq != nil {
+		return aws.StringValue(seq.S), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,316 @@
+package mypackage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+	"github.com/idiomat/dodtnyt/e1/mypackage/ddbfake"
+)
+
+// changeLog records the changes handlers get.
+type changeLog struct {
+	mu      sync.Mutex
+	changes []string
+	fail    map[string]int // how many more times handling a change fails, by event and ID
+}
+
+func (l *changeLog) handle(ctx context.Context, c *mypackage.PersonChange) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := c.EventName + " " + c.ID
+	if l.fail[key] > 0 {
+		l.fail[key]--
+		return errors.New("handler failed")
+	}
+	var name string
+	switch {
+	case c.New != nil:
+		name = c.New.Name
+	case c.Old != nil:
+		name = c.Old.Name
+	}
+	l.changes = append(l.changes, key+" "+name)
+	return nil
+}
+
+func (l *changeLog) got() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.changes...)
+}
+
+func (l *changeLog) config() mypackage.StreamConfig {
+	return mypackage.StreamConfig{
+		OnInsert:     l.handle,
+		OnModify:     l.handle,
+		OnRemove:     l.handle,
+		PollInterval: time.Millisecond,
+		RetryDelay:   time.Millisecond,
+	}
+}
+
+// johnnysLife is p1 being inserted, renamed and removed in shard s1.
+func johnnysLife(t *testing.T, stream *mypackage.MemoryStream, tbl mypackage.Table) {
+	t.Helper()
+	johnny := &mypackage.Person{ID: "p1", Name: "Johnny"}
+	john := &mypackage.Person{ID: "p1", Name: "John"}
+	for _, change := range [][2]*mypackage.Person{{nil, johnny}, {johnny, john}, {john, nil}} {
+		if err := stream.AppendChange("s1", tbl, change[0], change[1]); err != nil {
+			t.Fatalf("AppendChange() error = %v", err)
+		}
+	}
+}
+
+func TestStreamProcessor_Run(t *testing.T) {
+	stream := &mypackage.MemoryStream{}
+	for _, shard := range [][2]string{{"s2", "s1"}, {"s1", ""}, {"s3", ""}} {
+		if err := stream.AddShard(shard[0], shard[1]); err != nil {
+			t.Fatalf("AddShard() error = %v", err)
+		}
+	}
+	johnnysLife(t, stream, table)
+	if err := stream.AppendChange("s2", table, nil, &mypackage.Person{ID: "p2", Name: "Jane"}); err != nil {
+		t.Fatalf("AppendChange() error = %v", err)
+	}
+	for _, shard := range []string{"s1", "s2", "s3"} {
+		if err := stream.CloseShard(shard); err != nil {
+			t.Fatalf("CloseShard() error = %v", err)
+		}
+	}
+
+	log := &changeLog{}
+	checkpoints := &mypackage.MemoryCheckpoints{}
+	cfg := log.config()
+	cfg.BatchSize = 2
+	sp, err := mypackage.NewStreamProcessor(stream, checkpoints, cfg)
+	if err != nil {
+		t.Fatalf("NewStreamProcessor() error = %v", err)
+	}
+	if err := sp.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// the child shard comes after its parent
+	want := []string{"INSERT p1 Johnny", "MODIFY p1 John", "REMOVE p1 John", "INSERT p2 Jane"}
+	if got := log.got(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+	for _, shard := range []string{"s1", "s2", "s3"} {
+		if seq, _ := checkpoints.LastCheckpoint(context.Background(), shard); seq != mypackage.ShardEnd {
+			t.Errorf("expected %s to be checkpointed to its end but got %q", shard, seq)
+		}
+	}
+
+	// nothing is delivered again
+	if err := sp.Run(context.Background()); err != nil || len(log.got()) != len(want) {
+		t.Errorf("expected a second Run() to deliver nothing but got %v, %v", log.got(), err)
+	}
+}
+
+func TestStreamProcessor_AtLeastOnce(t *testing.T) {
+	tests := map[string]struct {
+		failures    int
+		wantErr     bool
+		wantChanges []string
+	}{
+		"retried": {
+			failures:    2,
+			wantChanges: []string{"INSERT p1 Johnny", "MODIFY p1 John", "REMOVE p1 John"},
+		},
+		"gave up": {
+			failures:    4,
+			wantErr:     true,
+			wantChanges: []string{"INSERT p1 Johnny"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			stream := &mypackage.MemoryStream{}
+			if err := stream.AddShard("s1", ""); err != nil {
+				t.Fatalf("AddShard() error = %v", err)
+			}
+			johnnysLife(t, stream, table)
+			if err := stream.CloseShard("s1"); err != nil {
+				t.Fatalf("CloseShard() error = %v", err)
+			}
+
+			log := &changeLog{fail: map[string]int{"MODIFY p1": tc.failures}}
+			checkpoints := &mypackage.MemoryCheckpoints{}
+			sp, err := mypackage.NewStreamProcessor(stream, checkpoints, log.config())
+			if err != nil {
+				t.Fatalf("NewStreamProcessor() error = %v", err)
+			}
+
+			err = sp.Run(context.Background())
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v but got %v", tc.wantErr, err)
+			}
+			if got := log.got(); !reflect.DeepEqual(got, tc.wantChanges) {
+				t.Errorf("expected %v but got %v", tc.wantChanges, got)
+			}
+			if !tc.wantErr {
+				return
+			}
+
+			var sErr *mypackage.StreamError
+			if !errors.As(err, &sErr) || sErr.Shard != "s1" {
+				t.Fatalf("expected a *StreamError for s1 but got %v", err)
+			}
+			// what was handled is checkpointed, and the failed change is delivered again
+			if seq, _ := checkpoints.LastCheckpoint(context.Background(), "s1"); seq == "" || seq >= sErr.SequenceNumber {
+				t.Errorf("expected a checkpoint before %s but got %q", sErr.SequenceNumber, seq)
+			}
+			if err := sp.Run(context.Background()); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			want := []string{"INSERT p1 Johnny", "MODIFY p1 John", "REMOVE p1 John"}
+			if got := log.got(); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %v but got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestStreamProcessor_OpenShard(t *testing.T) {
+	stream := &mypackage.MemoryStream{}
+	if err := stream.AddShard("s1", ""); err != nil {
+		t.Fatalf("AddShard() error = %v", err)
+	}
+	log := &changeLog{}
+	checkpoints := &mypackage.MemoryCheckpoints{}
+	sp, err := mypackage.NewStreamProcessor(stream, checkpoints, log.config())
+	if err != nil {
+		t.Fatalf("NewStreamProcessor() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- sp.Run(ctx) }()
+
+	// changes are picked up as they arrive
+	johnnysLife(t, stream, table)
+	eventually(t, func() bool { return len(log.got()) == 3 })
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+	if seq, _ := checkpoints.LastCheckpoint(context.Background(), "s1"); seq == "" || seq == mypackage.ShardEnd {
+		t.Errorf("expected the open shard to be checkpointed at its last change but got %q", seq)
+	}
+}
+
+func TestStreamProcessor_Decode(t *testing.T) {
+	enc, err := mypackage.NewFieldEncrypter(&mypackage.StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": key1}})
+	if err != nil {
+		t.Fatalf("NewFieldEncrypter() error = %v", err)
+	}
+	encrypted := mypackage.Table{Name: "people", PartitionKey: "pk", Encryption: enc}
+
+	tests := map[string]struct {
+		record  *mypackage.StreamRecord
+		table   mypackage.Table
+		decrypt bool
+		wantErr bool
+	}{
+		"encrypted": {table: encrypted, decrypt: true},
+		"no key":    {table: encrypted, wantErr: true},
+		"unknown event": {
+			record:  &mypackage.StreamRecord{EventName: "TRUNCATE"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			stream := &mypackage.MemoryStream{}
+			if err := stream.AddShard("s1", ""); err != nil {
+				t.Fatalf("AddShard() error = %v", err)
+			}
+			if tc.record != nil {
+				if err := stream.Append("s1", tc.record); err != nil {
+					t.Fatalf("Append() error = %v", err)
+				}
+			} else {
+				johnnysLife(t, stream, tc.table)
+			}
+			if err := stream.CloseShard("s1"); err != nil {
+				t.Fatalf("CloseShard() error = %v", err)
+			}
+
+			log := &changeLog{}
+			cfg := log.config()
+			if tc.decrypt {
+				cfg.Encryption = enc
+			}
+			sp, err := mypackage.NewStreamProcessor(stream, &mypackage.MemoryCheckpoints{}, cfg)
+			if err != nil {
+				t.Fatalf("NewStreamProcessor() error = %v", err)
+			}
+			err = sp.Run(context.Background())
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v but got %v", tc.wantErr, err)
+			}
+			if want := []string{"INSERT p1 Johnny", "MODIFY p1 John", "REMOVE p1 John"}; !tc.wantErr && !reflect.DeepEqual(log.got(), want) {
+				t.Errorf("expected %v but got %v", want, log.got())
+			}
+		})
+	}
+}
+
+func TestDynamoDBCheckpointer(t *testing.T) {
+	fake := ddbfake.New()
+	if err := fake.CreateTable("checkpoints", "Shard", ""); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	c, err := mypackage.NewDynamoDBCheckpointer(fake, mypackage.Table{Name: "checkpoints", PartitionKey: "Shard"})
+	if err != nil {
+		t.Fatalf("NewDynamoDBCheckpointer() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if seq, err := c.LastCheckpoint(ctx, "s1"); err != nil || seq != "" {
+		t.Errorf("LastCheckpoint() = %q, %v, want none", seq, err)
+	}
+	for i := 1; i <= 2; i++ {
+		if err := c.Checkpoint(ctx, "s1", fmt.Sprint(i)); err != nil {
+			t.Fatalf("Checkpoint() error = %v", err)
+		}
+	}
+	if seq, err := c.LastCheckpoint(ctx, "s1"); err != nil || seq != "2" {
+		t.Errorf("LastCheckpoint() = %q, %v, want 2", seq, err)
+	}
+
+	if _, err := mypackage.NewDynamoDBCheckpointer(nil, mypackage.Table{Name: "checkpoints"}); err == nil {
+		t.Errorf("expected error for nil client")
+	}
+}
+
+func TestNewStreamProcessor(t *testing.T) {
+	log := &changeLog{}
+	tests := map[string]struct {
+		reader      mypackage.ShardReader
+		checkpoints mypackage.Checkpointer
+		cfg         mypackage.StreamConfig
+	}{
+		"no reader":        {checkpoints: &mypackage.MemoryCheckpoints{}, cfg: log.config()},
+		"no checkpointer":  {reader: &mypackage.MemoryStream{}, cfg: log.config()},
+		"no handler":       {reader: &mypackage.MemoryStream{}, checkpoints: &mypackage.MemoryCheckpoints{}},
+		"negative batch":   {reader: &mypackage.MemoryStream{}, checkpoints: &mypackage.MemoryCheckpoints{}, cfg: mypackage.StreamConfig{OnInsert: log.handle, BatchSize: -1}},
+		"negative retries": {reader: &mypackage.MemoryStream{}, checkpoints: &mypackage.MemoryCheckpoints{}, cfg: mypackage.StreamConfig{OnInsert: log.handle, Retries: -1}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := mypackage.NewStreamProcessor(tc.reader, tc.checkpoints, tc.cfg); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
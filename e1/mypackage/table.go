@@ -0,0 +1,109 @@
+package mypackage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+var tableNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,255}$`)
+
+// Table describes the DynamoDB table people are stored in.
+type Table struct {
+	Name string
+	// PartitionKey is the attribute the table is keyed on, KeyAttribute if empty.
+	// When it differs from KeyAttribute, the Person's ID is also stored under it.
+	PartitionKey string
+	// Encryption encrypts the Person attributes tagged with encrypt before they are written
+	// and decrypts them when they are read. They are stored in plaintext when it's nil.
+	Encryption *FieldEncrypter
+}
+
+func (t Table) validate() error {
+	if t.Name == "" {
+		return errors.New("table name is required")
+	}
+	if !tableNamePattern.MatchString(t.Name) {
+		return fmt.Errorf("invalid table name: %q", t.Name)
+	}
+	if t.Encryption != nil {
+		return t.Encryption.validate()
+	}
+	return nil
+}
+
+func (t Table) partitionKey() string {
+	if t.PartitionKey == "" {
+		return KeyAttribute
+	}
+	return t.PartitionKey
+}
+
+// TableFromEnv reads the table from the TABLE_NAME and TABLE_PARTITION_KEY environment variables.
+// When TABLE_KEY_FILE is set, people are encrypted with the keys in that file, see LoadKeyFile.
+func TableFromEnv() (Table, error) {
+	t := Table{
+		Name:         os.Getenv("TABLE_NAME"),
+		PartitionKey: os.Getenv("TABLE_PARTITION_KEY"),
+	}
+	if path := os.Getenv("TABLE_KEY_FILE"); path != "" {
+		keys, err := LoadKeyFile(path)
+		if err != nil {
+			return t, err
+		}
+		t.Encryption = &FieldEncrypter{Keys: keys}
+	}
+	return t, t.validate()
+}
+
+func (t Table) key(id string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		t.partitionKey(): {S: aws.String(id)},
+	}
+}
+
+// item returns how p is stored, encrypted if the table is.
+func (t Table) item(p *Person) (map[string]*dynamodb.AttributeValue, error) {
+	item, err := dynamodbattribute.MarshalMap(p)
+	if err != nil {
+		return nil, marshalError("person "+p.ID, err)
+	}
+	if pk := t.partitionKey(); pk != KeyAttribute {
+		item[pk] = item[KeyAttribute]
+	}
+	if t.Encryption != nil {
+		if err := t.Encryption.encryptItem(item); err != nil {
+			return nil, fmt.Errorf("person %s: %w", p.ID, err)
+		}
+	}
+	return item, nil
+}
+
+// person reads a stored Person, decrypting it if the table is encrypted.
+func (t Table) person(item map[string]*dynamodb.AttributeValue) (*Person, error) {
+	id := itemID(item)
+	if t.Encryption != nil {
+		var err error
+		if item, err = t.Encryption.decryptItem(item); err != nil {
+			return nil, fmt.Errorf("person %s: %w", id, err)
+		}
+	}
+	var p Person
+	if err := dynamodbattribute.UnmarshalMap(item, &p); err != nil {
+		return nil, unmarshalError("person "+id, err)
+	}
+	return &p, nil
+}
+
+// itemID returns the ID of a stored Person, for error messages.
+func itemID(item map[string]*dynamodb.AttributeValue) string {
+	if v := item[KeyAttribute]; v != nil {
+		return aws.StringValue(v.S)
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package mypackage_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+)
+
+func TestNewDynamoDBSaver(t *testing.T) {
+	tests := map[string]struct {
+		table   mypackage.Table
+		wantErr bool
+	}{
+		"valid":         {table: mypackage.Table{Name: "people"}},
+		"custom key":    {table: mypackage.Table{Name: "people.v2", PartitionKey: "pk"}},
+		"missing name":  {table: mypackage.Table{}, wantErr: true},
+		"too short":     {table: mypackage.Table{Name: "pp"}, wantErr: true},
+		"invalid chars": {table: mypackage.Table{Name: "people table"}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := mypackage.NewDynamoDBSaver(&testClient{}, tc.table)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("expected error %v but got %v", tc.wantErr, err)
+			}
+		})
+	}
+
+	if _, err := mypackage.NewDynamoDBSaver(nil, table); err == nil {
+		t.Errorf("expected error for nil client")
+	}
+}
+
+func TestTable_PartitionKey(t *testing.T) {
+	client := &testClient{}
+	saver, err := mypackage.NewDynamoDBSaver(client, mypackage.Table{Name: "people", PartitionKey: "pk"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := saver.Create(context.Background(), &mypackage.Person{ID: "p1", Name: "Johnny"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pk := aws.StringValue(client.input.Item["pk"].S); pk != "p1" {
+		t.Errorf("expected partition key p1 but got %q", pk)
+	}
+	if name := aws.StringValue(client.input.ExpressionAttributeNames["#key"]); name != "pk" {
+		t.Errorf("expected condition on pk but got %q", name)
+	}
+	if name := aws.StringValue(client.input.TableName); name != "people" {
+		t.Errorf("expected table people but got %q", name)
+	}
+}
+
+func TestTableFromEnv(t *testing.T) {
+	t.Setenv("TABLE_NAME", "people")
+	t.Setenv("TABLE_PARTITION_KEY", "pk")
+
+	got, err := mypackage.TableFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (mypackage.Table{Name: "people", PartitionKey: "pk"}); got != want {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`{"current": "k1", "keys": {"k1": "AQEBAQEBAQEBAQEBAQEBAQ=="}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TABLE_KEY_FILE", path)
+	if got, err := mypackage.TableFromEnv(); err != nil || got.Encryption == nil {
+		t.Errorf("expected an encrypted table but got %+v, %v", got, err)
+	}
+	t.Setenv("TABLE_KEY_FILE", path+".missing")
+	if _, err := mypackage.TableFromEnv(); err == nil {
+		t.Errorf("expected error with a missing key file")
+	}
+
+	t.Setenv("TABLE_KEY_FILE", "")
+	t.Setenv("TABLE_NAME", "")
+	if _, err := mypackage.TableFromEnv(); err == nil {
+		t.Errorf("expected error without TABLE_NAME")
+	}
+}
+
+func TestDynamoDBSaver_ZeroTable(t *testing.T) {
+	saver := &mypackage.DynamoDBSaver{Client: &testClient{}}
+	if err := saver.Save(context.Background(), &mypackage.Person{ID: "p1"}); err == nil {
+		t.Errorf("expected error saving without a table")
+	}
+}
@@ -0,0 +1,351 @@
+package mypackage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// MaxTransactionSize is the most operations DynamoDB accepts in one transaction.
+const MaxTransactionSize = 100
+
+// ErrTransactionConflict is returned for an operation on an item another transaction was changing.
+var ErrTransactionConflict = errors.New("conflicting transaction in progress")
+
+type ddbTransactor interface {
+	TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// Expression is a condition or update expression with its placeholders.
+// Values are marshaled with dynamodbattribute.
+type Expression struct {
+	Expr   string
+	Names  map[string]string
+	Values map[string]interface{}
+}
+
+// placeholders merges the placeholders of expressions, which must agree on any they share.
+func placeholders(exprs ...*Expression) (map[string]*string, map[string]*dynamodb.AttributeValue, error) {
+	var (
+		names  map[string]*string
+		values map[string]*dynamodb.AttributeValue
+	)
+	for _, e := range exprs {
+		if e == nil {
+			continue
+		}
+		for k, v := range e.Names {
+			if prev, ok := names[k]; ok && *prev != v {
+				return nil, nil, fmt.Errorf("placeholder %s names both %s and %s", k, *prev, v)
+			}
+			if names == nil {
+				names = make(map[string]*string)
+			}
+			names[k] = aws.String(v)
+		}
+		for k, v := range e.Values {
+			av, err := dynamodbattribute.Marshal(v)
+			if err != nil {
+				return nil, nil, marshalError("placeholder "+k, err)
+			}
+			if prev, ok := values[k]; ok && !reflect.DeepEqual(prev, av) {
+				return nil, nil, fmt.Errorf("placeholder %s has two values", k)
+			}
+			if values == nil {
+				values = make(map[string]*dynamodb.AttributeValue)
+			}
+			values[k] = av
+		}
+	}
+	return names, values, nil
+}
+
+func exprString(e *Expression) *string {
+	if e == nil {
+		return nil
+	}
+	return aws.String(e.Expr)
+}
+
+// txOp is one operation of a transaction.
+type txOp struct {
+	item     *dynamodb.TransactWriteItem
+	kind     string
+	table    string
+	condErr  error  // what a failed condition means, ErrConditionFailed if nil
+	onCommit func() // run once the transaction succeeded
+}
+
+// Tx collects puts, updates, deletes and condition checks across tables
+// for DynamoDBTransactor to apply all at once. The zero value is an empty transaction.
+// Errors building it are returned by Commit.
+type Tx struct {
+	ops []txOp
+	err error
+}
+
+func (tx *Tx) add(op txOp, err error) *Tx {
+	if err != nil && tx.err == nil {
+		tx.err = fmt.Errorf("operation %d (%s %s): %w", len(tx.ops), op.kind, op.table, err)
+	}
+	tx.ops = append(tx.ops, op)
+	return tx
+}
+
+// Len returns the number of operations in the transaction.
+func (tx *Tx) Len() int {
+	return len(tx.ops)
+}
+
+// Put writes item, marshaled with dynamodbattribute, if cond holds.
+func (tx *Tx) Put(table string, item interface{}, cond *Expression) *Tx {
+	op := txOp{kind: "Put", table: table}
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return tx.add(op, marshalError("item", err))
+	}
+	names, values, err := placeholders(cond)
+	op.item = &dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+		TableName:                 aws.String(table),
+		Item:                      av,
+		ConditionExpression:       exprString(cond),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}}
+	return tx.add(op, err)
+}
+
+// Update applies update to the item with the given key if cond holds.
+func (tx *Tx) Update(table string, key map[string]interface{}, update Expression, cond *Expression) *Tx {
+	op := txOp{kind: "Update", table: table}
+	av, err := dynamodbattribute.MarshalMap(key)
+	if err != nil {
+		return tx.add(op, marshalError("key", err))
+	}
+	names, values, err := placeholders(&update, cond)
+	op.item = &dynamodb.TransactWriteItem{Update: &dynamodb.Update{
+		TableName:                 aws.String(table),
+		Key:                       av,
+		UpdateExpression:          aws.String(update.Expr),
+		ConditionExpression:       exprString(cond),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}}
+	return tx.add(op, err)
+}
+
+// Delete removes the item with the given key if cond holds.
+func (tx *Tx) Delete(table string, key map[string]interface{}, cond *Expression) *Tx {
+	op := txOp{kind: "Delete", table: table}
+	av, err := dynamodbattribute.MarshalMap(key)
+	if err != nil {
+		return tx.add(op, marshalError("key", err))
+	}
+	names, values, err := placeholders(cond)
+	op.item = &dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{
+		TableName:                 aws.String(table),
+		Key:                       av,
+		ConditionExpression:       exprString(cond),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}}
+	return tx.add(op, err)
+}
+
+// ConditionCheck makes the transaction depend on cond holding for the item with the given key.
+func (tx *Tx) ConditionCheck(table string, key map[string]interface{}, cond Expression) *Tx {
+	op := txOp{kind: "ConditionCheck", table: table}
+	av, err := dynamodbattribute.MarshalMap(key)
+	if err != nil {
+		return tx.add(op, marshalError("key", err))
+	}
+	names, values, err := placeholders(&cond)
+	op.item = &dynamodb.TransactWriteItem{ConditionCheck: &dynamodb.ConditionCheck{
+		TableName:                 aws.String(table),
+		Key:                       av,
+		ConditionExpression:       aws.String(cond.Expr),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}}
+	return tx.add(op, err)
+}
+
+// AddSave adds to tx the same write Save would make, including its version check.
+// p's version and timestamps are only updated once the transaction is committed,
+// except for a CreatedAt kept from the stored Person, which a transaction doesn't return.
+func (s *DynamoDBSaver) AddSave(tx *Tx, p *Person) *Tx {
+	put, err := s.prepareSave(p)
+	return tx.addPut(s.Table.Name, p, put, err)
+}
+
+// AddCreate adds to tx the same write Create would make.
+func (s *DynamoDBSaver) AddCreate(tx *Tx, p *Person) *Tx {
+	put, err := s.prepareCreate(p)
+	return tx.addPut(s.Table.Name, p, put, err)
+}
+
+func (tx *Tx) addPut(table string, p *Person, put *preparedPut, err error) *Tx {
+	op := txOp{kind: "Put", table: table}
+	if err != nil {
+		return tx.add(op, err)
+	}
+	op.condErr = put.condErr
+	if in := put.update; in != nil {
+		op.kind = "Update"
+		op.item = &dynamodb.TransactWriteItem{Update: &dynamodb.Update{
+			TableName:                 in.TableName,
+			Key:                       in.Key,
+			UpdateExpression:          in.UpdateExpression,
+			ConditionExpression:       in.ConditionExpression,
+			ExpressionAttributeNames:  in.ExpressionAttributeNames,
+			ExpressionAttributeValues: in.ExpressionAttributeValues,
+		}}
+		op.onCommit = func() {
+			created := p.CreatedAt
+			*p = put.person
+			p.CreatedAt = created
+		}
+		return tx.add(op, nil)
+	}
+	in := put.input
+	op.item = &dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+		TableName:                 in.TableName,
+		Item:                      in.Item,
+		ConditionExpression:       in.ConditionExpression,
+		ExpressionAttributeNames:  in.ExpressionAttributeNames,
+		ExpressionAttributeValues: in.ExpressionAttributeValues,
+	}}
+	op.onCommit = func() { *p = put.person }
+	return tx.add(op, nil)
+}
+
+// TxOpError is why one operation of a cancelled transaction failed.
+type TxOpError struct {
+	Index   int    // position of the operation in the transaction
+	Op      string // Put, Update, Delete or ConditionCheck
+	Table   string
+	Code    string // the cancellation reason code, e.g. ConditionalCheckFailed
+	Message string
+	// Item is the item's current state, if the operation asked for it on condition failure.
+	Item map[string]*dynamodb.AttributeValue
+
+	err error
+}
+
+func (e *TxOpError) Error() string {
+	msg := fmt.Sprintf("operation %d (%s %s): %s", e.Index, e.Op, e.Table, e.Code)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Unwrap returns ErrConditionFailed, along with any more specific error of the operation that added it,
+// or ErrTransactionConflict, ErrThrottled, ErrValidation, or nil for other reasons.
+func (e *TxOpError) Unwrap() error {
+	return e.err
+}
+
+// TxCanceledError reports a cancelled transaction, none of whose operations were applied.
+type TxCanceledError struct {
+	// Failed holds an error for every operation that caused the cancellation.
+	Failed []*TxOpError
+
+	err error
+}
+
+func (e *TxCanceledError) Error() string {
+	msgs := make([]string, len(e.Failed))
+	for i, f := range e.Failed {
+		msgs[i] = f.Error()
+	}
+	return "transaction cancelled: " + strings.Join(msgs, "; ")
+}
+
+func (e *TxCanceledError) Unwrap() []error {
+	errs := []error{e.err}
+	for _, f := range e.Failed {
+		errs = append(errs, f)
+	}
+	return errs
+}
+
+// DynamoDBTransactor commits transactions.
+type DynamoDBTransactor struct {
+	Client ddbTransactor
+}
+
+// Commit applies every operation of tx, or none of them. If DynamoDB cancels
+// the transaction, the error is a *TxCanceledError explaining each failure.
+func (t *DynamoDBTransactor) Commit(ctx context.Context, tx *Tx) error {
+	if tx.err != nil {
+		return tx.err
+	}
+	if len(tx.ops) == 0 || len(tx.ops) > MaxTransactionSize {
+		return fmt.Errorf("a transaction needs between 1 and %d operations, got %d", MaxTransactionSize, len(tx.ops))
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: make([]*dynamodb.TransactWriteItem, len(tx.ops)),
+	}
+	for i, op := range tx.ops {
+		input.TransactItems[i] = op.item
+	}
+
+	if _, err := t.Client.TransactWriteItemsWithContext(ctx, input); err != nil {
+		var canceled *dynamodb.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			return tx.decode(canceled)
+		}
+		return wrapErr("TransactWriteItems", err)
+	}
+
+	for _, op := range tx.ops {
+		if op.onCommit != nil {
+			op.onCommit()
+		}
+	}
+	return nil
+}
+
+// decode turns cancellation reasons, which line up with the operations, into errors.
+func (tx *Tx) decode(canceled *dynamodb.TransactionCanceledException) error {
+	txErr := &TxCanceledError{err: canceled}
+	for i, reason := range canceled.CancellationReasons {
+		code := aws.StringValue(reason.Code)
+		if code == "" || code == "None" || i >= len(tx.ops) {
+			continue
+		}
+		op := tx.ops[i]
+		opErr := &TxOpError{
+			Index:   i,
+			Op:      op.kind,
+			Table:   op.table,
+			Code:    code,
+			Message: aws.StringValue(reason.Message),
+			Item:    reason.Item,
+		}
+		switch code {
+		case "ConditionalCheckFailed":
+			opErr.err = ErrConditionFailed
+			if op.condErr != nil {
+				opErr.err = errors.Join(op.condErr, ErrConditionFailed)
+			}
+		case "TransactionConflict":
+			opErr.err = ErrTransactionConflict
+		case "ThrottlingError", "ProvisionedThroughputExceeded":
+			opErr.err = ErrThrottled
+		case "ValidationError":
+			opErr.err = ErrValidation
+		}
+		txErr.Failed = append(txErr.Failed, opErr)
+	}
+	return txErr
+}
@@ -0,0 +1,160 @@
+package mypackage_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+	"github.com/idiomat/dodtnyt/e1/mypackage/ddbfake"
+)
+
+type auditEntry struct {
+	ID       string
+	PersonID string
+	Action   string
+}
+
+func newTxFake(t *testing.T) *ddbfake.Fake {
+	t.Helper()
+	fake := ddbfake.New()
+	for _, name := range []string{"people", "audit", "counters"} {
+		if err := fake.CreateTable(name, "ID", ""); err != nil {
+			t.Fatalf("CreateTable() error = %v", err)
+		}
+	}
+	return fake
+}
+
+// saveWithAudit saves p, records it in the audit table and counts it, all at once.
+func saveWithAudit(saver *mypackage.DynamoDBSaver, p *mypackage.Person, auditID string) *mypackage.Tx {
+	tx := saver.AddSave(&mypackage.Tx{}, p)
+	tx.Put("audit", auditEntry{ID: auditID, PersonID: p.ID, Action: "save"}, &mypackage.Expression{
+		Expr:  "attribute_not_exists(#id)",
+		Names: map[string]string{"#id": "ID"},
+	})
+	return tx.Update("counters", map[string]interface{}{"ID": "people"}, mypackage.Expression{
+		Expr:   "ADD #total :one",
+		Names:  map[string]string{"#total": "Total"},
+		Values: map[string]interface{}{":one": 1},
+	}, nil)
+}
+
+func TestDynamoDBTransactor_Commit(t *testing.T) {
+	fake := newTxFake(t)
+	saver := &mypackage.DynamoDBSaver{Client: fake, Table: table, Versioned: true}
+	transactor := &mypackage.DynamoDBTransactor{Client: fake}
+	ctx := context.Background()
+
+	johnny := &mypackage.Person{ID: "p1", Name: "Johnny"}
+	if err := transactor.Commit(ctx, saveWithAudit(saver, johnny, "a1")); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if johnny.Version != 1 {
+		t.Errorf("expected version 1 after commit but got %d", johnny.Version)
+	}
+
+	tests := map[string]struct {
+		person     *mypackage.Person
+		auditID    string
+		wantErr    error
+		wantFailed []int
+	}{
+		"stale version": {
+			person:     &mypackage.Person{ID: "p1", Name: "Stale", Version: 7},
+			auditID:    "a2",
+			wantErr:    mypackage.ErrVersionConflict,
+			wantFailed: []int{0},
+		},
+		"duplicate audit entry": {
+			person:     &mypackage.Person{ID: "p2", Name: "Jane"},
+			auditID:    "a1",
+			wantErr:    mypackage.ErrConditionFailed,
+			wantFailed: []int{1},
+		},
+		"both fail": {
+			person:     &mypackage.Person{ID: "p1", Name: "Stale", Version: 7},
+			auditID:    "a1",
+			wantErr:    mypackage.ErrVersionConflict,
+			wantFailed: []int{0, 1},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			version := tc.person.Version
+			err := transactor.Commit(ctx, saveWithAudit(saver, tc.person, tc.auditID))
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v but got %v", tc.wantErr, err)
+			}
+
+			var txErr *mypackage.TxCanceledError
+			if !errors.As(err, &txErr) {
+				t.Fatalf("expected a *TxCanceledError but got %T", err)
+			}
+			var failed []int
+			for _, f := range txErr.Failed {
+				failed = append(failed, f.Index)
+			}
+			if !reflect.DeepEqual(failed, tc.wantFailed) {
+				t.Errorf("expected failed operations %v but got %v", tc.wantFailed, failed)
+			}
+			if tc.person.Version != version {
+				t.Errorf("expected version to stay %d but got %d", version, tc.person.Version)
+			}
+		})
+	}
+
+	// none of the cancelled transactions wrote anything
+	counters, _ := fake.Items("counters")
+	if total := aws.StringValue(counters[0]["Total"].N); total != "1" {
+		t.Errorf("expected counter 1 but got %s", total)
+	}
+	audit, _ := fake.Items("audit")
+	if len(audit) != 1 {
+		t.Errorf("expected 1 audit entry but got %d", len(audit))
+	}
+
+	// saved again without its CreatedAt, p1 keeps the stored one
+	again := &mypackage.Person{ID: "p1", Name: "John", Version: 1}
+	if err := transactor.Commit(ctx, saver.AddSave(&mypackage.Tx{}, again)); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	got, err := (&mypackage.DynamoDBGetter{Client: fake, Table: table}).Get(ctx, "p1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Name != "John" || got.Version != 2 || !got.CreatedAt.Equal(johnny.CreatedAt) {
+		t.Errorf("Get() = %+v, want John at version 2 created at %v", got, johnny.CreatedAt)
+	}
+}
+
+func TestDynamoDBTransactor_CommitInvalid(t *testing.T) {
+	transactor := &mypackage.DynamoDBTransactor{Client: newTxFake(t)}
+	key := map[string]interface{}{"ID": "p1"}
+
+	tests := map[string]*mypackage.Tx{
+		"empty": {},
+		"conflicting placeholders": (&mypackage.Tx{}).Update("people", key,
+			mypackage.Expression{Expr: "SET #n = :v", Names: map[string]string{"#n": "Name"}, Values: map[string]interface{}{":v": "a"}},
+			&mypackage.Expression{Expr: "#n = :v", Names: map[string]string{"#n": "Nick"}, Values: map[string]interface{}{":v": "a"}},
+		),
+		"too many": func() *mypackage.Tx {
+			tx := &mypackage.Tx{}
+			for i := 0; i <= mypackage.MaxTransactionSize; i++ {
+				tx.ConditionCheck("people", key, mypackage.Expression{Expr: "attribute_exists(ID)"})
+			}
+			return tx
+		}(),
+	}
+
+	for name, tx := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := transactor.Commit(context.Background(), tx); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
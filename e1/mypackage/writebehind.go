@@ -0,0 +1,258 @@
+package mypackage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBufferSize    = 1000
+	DefaultFlushInterval = time.Second
+)
+
+var (
+	// ErrBufferFull is returned by WriteBehindSaver.Save with OverflowReject when the buffer is full.
+	ErrBufferFull = errors.New("write-behind buffer full")
+	// ErrDropped is reported for a Person evicted from a full buffer with OverflowDropOldest.
+	ErrDropped = errors.New("person dropped from write-behind buffer")
+	// ErrClosed is returned by WriteBehindSaver.Save once the saver is closed.
+	ErrClosed = errors.New("write-behind saver closed")
+)
+
+// OverflowPolicy is what WriteBehindSaver.Save does when the buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room, applying backpressure to the caller.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject returns ErrBufferFull.
+	OverflowReject
+	// OverflowDropOldest evicts the longest buffered Person, reporting it with ErrDropped.
+	OverflowDropOldest
+)
+
+// personSaver is what WriteBehindSaver writes through, like DynamoDBSaver.
+type personSaver interface {
+	Save(ctx context.Context, p *Person) error
+}
+
+// WriteBehindConfig configures a WriteBehindSaver. Zero values use the defaults.
+type WriteBehindConfig struct {
+	BufferSize    int           // most people waiting to be written
+	BatchSize     int           // people written together, and how many trigger a flush
+	FlushInterval time.Duration // longest a Person waits before a flush
+	Overflow      OverflowPolicy
+	// OnError is called, possibly concurrently, for every Person that couldn't be saved.
+	OnError func(p *Person, err error)
+}
+
+// WriteBehindSaver buffers people and saves them in the background,
+// so callers don't wait on DynamoDB.
+type WriteBehindSaver struct {
+	saver    personSaver
+	size     int
+	batch    int
+	interval time.Duration
+	overflow OverflowPolicy
+	onError  func(*Person, error)
+
+	ctx    context.Context // for writes, cancelled when Close gives up
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	buf     []*Person
+	room    chan struct{} // closed when people leave the buffer
+	closed  bool
+	full    chan struct{} // a batch is waiting
+	closing chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewWriteBehindSaver returns a WriteBehindSaver writing through saver, typically a *DynamoDBSaver.
+func NewWriteBehindSaver(saver personSaver, cfg WriteBehindConfig) (*WriteBehindSaver, error) {
+	if saver == nil {
+		return nil, errors.New("saver is required")
+	}
+	w := &WriteBehindSaver{
+		saver:    saver,
+		size:     cfg.BufferSize,
+		batch:    cfg.BatchSize,
+		interval: cfg.FlushInterval,
+		overflow: cfg.Overflow,
+		onError:  cfg.OnError,
+	}
+	if w.size == 0 {
+		w.size = DefaultBufferSize
+	}
+	if w.batch == 0 {
+		w.batch = min(MaxBatchSize, w.size)
+	}
+	if w.interval == 0 {
+		w.interval = DefaultFlushInterval
+	}
+	if w.onError == nil {
+		w.onError = func(*Person, error) {}
+	}
+	if err := w.validate(); err != nil {
+		return nil, err
+	}
+
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.room = make(chan struct{})
+	w.full = make(chan struct{}, 1)
+	w.closing = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.run()
+	return w, nil
+}
+
+func (w *WriteBehindSaver) validate() error {
+	if w.size < 1 {
+		return fmt.Errorf("invalid buffer size: %d", w.size)
+	}
+	if w.batch < 1 || w.batch > w.size {
+		return fmt.Errorf("invalid batch size: %d", w.batch)
+	}
+	if w.interval < 0 {
+		return fmt.Errorf("invalid flush interval: %s", w.interval)
+	}
+	if w.overflow < OverflowBlock || w.overflow > OverflowDropOldest {
+		return fmt.Errorf("invalid overflow policy: %d", w.overflow)
+	}
+	return nil
+}
+
+// Save buffers a copy of p to be saved later. Failures to save it are reported to OnError.
+func (w *WriteBehindSaver) Save(ctx context.Context, p *Person) error {
+	next := p.clone()
+	var dropped *Person
+
+	w.mu.Lock()
+	for !w.closed && len(w.buf) >= w.size {
+		if w.overflow == OverflowReject {
+			w.mu.Unlock()
+			return ErrBufferFull
+		}
+		if w.overflow == OverflowDropOldest {
+			dropped, w.buf = w.buf[0], w.buf[1:]
+			break
+		}
+
+		room := w.room
+		w.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-room:
+		}
+		w.mu.Lock()
+	}
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	w.buf = append(w.buf, next)
+	full := len(w.buf) >= w.batch
+	w.mu.Unlock()
+
+	if dropped != nil {
+		w.onError(dropped, ErrDropped)
+	}
+	if full {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close stops accepting people and waits until every buffered Person is written.
+// If ctx ends first, writes still in flight are cancelled, the people left are reported
+// to OnError, and ctx's error is returned.
+func (w *WriteBehindSaver) Close(ctx context.Context) error {
+	w.once.Do(func() {
+		w.mu.Lock()
+		w.closed = true
+		close(w.room) // wake up blocked callers
+		w.mu.Unlock()
+		close(w.closing)
+	})
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		<-w.done
+		return ctx.Err()
+	}
+}
+
+func (w *WriteBehindSaver) run() {
+	defer close(w.done)
+	defer w.cancel()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.full:
+			w.flush(false)
+		case <-ticker.C:
+			w.flush(true)
+		case <-w.closing:
+			w.flush(true)
+			return
+		}
+	}
+}
+
+// flush writes full batches, and with all the last partial one too.
+func (w *WriteBehindSaver) flush(all bool) {
+	for {
+		w.mu.Lock()
+		if len(w.buf) == 0 || (!all && len(w.buf) < w.batch) {
+			w.mu.Unlock()
+			return
+		}
+		n := min(w.batch, len(w.buf))
+		batch := w.buf[:n:n]
+		w.buf = append([]*Person(nil), w.buf[n:]...)
+		if !w.closed {
+			close(w.room)
+			w.room = make(chan struct{})
+		}
+		w.mu.Unlock()
+
+		w.write(batch)
+	}
+}
+
+// write saves the people of batch concurrently. A Person saved again later in the batch
+// is left to that later save, so concurrent writes can't store an older copy last.
+func (w *WriteBehindSaver) write(batch []*Person) {
+	last := make(map[string]int, len(batch))
+	for i, p := range batch {
+		last[p.ID] = i
+	}
+
+	var wg sync.WaitGroup
+	for i, p := range batch {
+		if last[p.ID] != i {
+			continue
+		}
+		wg.Add(1)
+		go func(p *Person) {
+			defer wg.Done()
+			if err := w.saver.Save(w.ctx, p); err != nil {
+				w.onError(p, err)
+			}
+		}(p)
+	}
+	wg.Wait()
+}
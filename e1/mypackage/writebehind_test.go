@@ -0,0 +1,362 @@
+package mypackage_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+	"github.com/idiomat/dodtnyt/e1/mypackage/ddbfake"
+)
+
+// gatedSaver records what it saves, and waits for gate to be closed first when it is set.
+type gatedSaver struct {
+	gate    chan struct{}
+	started chan string
+	fail    map[string]bool
+
+	mu    sync.Mutex
+	saved []string
+}
+
+func (s *gatedSaver) Save(ctx context.Context, p *mypackage.Person) error {
+	if s.started != nil {
+		s.started <- p.ID
+	}
+	if s.gate != nil {
+		select {
+		case <-s.gate:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if s.fail[p.ID] {
+		return errors.New("failed to save")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append(s.saved, p.ID)
+	return nil
+}
+
+func (s *gatedSaver) savedIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := append([]string(nil), s.saved...)
+	sort.Strings(ids)
+	return ids
+}
+
+// failures collects what OnError reports.
+type failures struct {
+	mu   sync.Mutex
+	errs map[string]error
+}
+
+func (f *failures) onError(p *mypackage.Person, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.errs == nil {
+		f.errs = make(map[string]error)
+	}
+	f.errs[p.ID] = err
+}
+
+func (f *failures) get(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.errs[id]
+}
+
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWriteBehindSaver_Flush(t *testing.T) {
+	tests := map[string]struct {
+		cfg  mypackage.WriteBehindConfig
+		save int
+	}{
+		"batch size reached": {cfg: mypackage.WriteBehindConfig{BatchSize: 3, FlushInterval: time.Hour}, save: 3},
+		"interval passed":    {cfg: mypackage.WriteBehindConfig{BatchSize: 10, FlushInterval: 5 * time.Millisecond}, save: 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			saver := &gatedSaver{}
+			w, err := mypackage.NewWriteBehindSaver(saver, tc.cfg)
+			if err != nil {
+				t.Fatalf("NewWriteBehindSaver() error = %v", err)
+			}
+			defer w.Close(context.Background())
+
+			for _, p := range people(tc.save) {
+				if err := w.Save(context.Background(), p); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+			eventually(t, func() bool { return len(saver.savedIDs()) == tc.save })
+		})
+	}
+}
+
+func TestWriteBehindSaver_Close(t *testing.T) {
+	saver := &gatedSaver{fail: map[string]bool{"p3": true}}
+	failed := &failures{}
+	w, err := mypackage.NewWriteBehindSaver(saver, mypackage.WriteBehindConfig{BatchSize: 100, FlushInterval: time.Hour, OnError: failed.onError})
+	if err != nil {
+		t.Fatalf("NewWriteBehindSaver() error = %v", err)
+	}
+
+	for _, p := range people(5) {
+		if err := w.Save(context.Background(), p); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if got, want := saver.savedIDs(), []string{"p0", "p1", "p2", "p4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v saved but got %v", want, got)
+	}
+	if err := failed.get("p3"); err == nil {
+		t.Errorf("expected the failure to save p3 to be reported")
+	}
+	if err := w.Save(context.Background(), &mypackage.Person{ID: "late"}); !errors.Is(err, mypackage.ErrClosed) {
+		t.Errorf("expected %v but got %v", mypackage.ErrClosed, err)
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+func TestWriteBehindSaver_CloseTimeout(t *testing.T) {
+	saver := &gatedSaver{gate: make(chan struct{})} // never opens
+	failed := &failures{}
+	w, err := mypackage.NewWriteBehindSaver(saver, mypackage.WriteBehindConfig{FlushInterval: time.Hour, OnError: failed.onError})
+	if err != nil {
+		t.Fatalf("NewWriteBehindSaver() error = %v", err)
+	}
+	if err := w.Save(context.Background(), &mypackage.Person{ID: "p1"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := w.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v but got %v", context.DeadlineExceeded, err)
+	}
+	if err := failed.get("p1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected p1 to be reported cancelled but got %v", err)
+	}
+}
+
+func TestWriteBehindSaver_Overflow(t *testing.T) {
+	tests := map[string]struct {
+		policy      mypackage.OverflowPolicy
+		wantErr     error
+		wantDropped string
+	}{
+		"block":       {policy: mypackage.OverflowBlock, wantErr: context.DeadlineExceeded},
+		"reject":      {policy: mypackage.OverflowReject, wantErr: mypackage.ErrBufferFull},
+		"drop oldest": {policy: mypackage.OverflowDropOldest, wantDropped: "p2"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			saver := &gatedSaver{gate: make(chan struct{}), started: make(chan string, 10)}
+			failed := &failures{}
+			w, err := mypackage.NewWriteBehindSaver(saver, mypackage.WriteBehindConfig{
+				BufferSize:    2,
+				BatchSize:     2,
+				FlushInterval: time.Hour,
+				Overflow:      tc.policy,
+				OnError:       failed.onError,
+			})
+			if err != nil {
+				t.Fatalf("NewWriteBehindSaver() error = %v", err)
+			}
+			ctx := context.Background()
+
+			// p0 and p1 are being written, p2 and p3 fill the buffer
+			all := people(5)
+			for _, p := range all[:2] {
+				if err := w.Save(ctx, p); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+			<-saver.started
+			<-saver.started
+			for _, p := range all[2:4] {
+				if err := w.Save(ctx, p); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+
+			timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+			defer cancel()
+			if err := w.Save(timeout, all[4]); !errors.Is(err, tc.wantErr) {
+				t.Errorf("expected %v but got %v", tc.wantErr, err)
+			}
+			if tc.wantDropped != "" {
+				if err := failed.get(tc.wantDropped); !errors.Is(err, mypackage.ErrDropped) {
+					t.Errorf("expected %s to be dropped but got %v", tc.wantDropped, err)
+				}
+			}
+
+			close(saver.gate)
+			if err := w.Close(ctx); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if got := saver.savedIDs(); len(got) != 4 {
+				t.Errorf("expected 4 people saved but got %v", got)
+			}
+		})
+	}
+}
+
+func TestWriteBehindSaver_DynamoDB(t *testing.T) {
+	fake := ddbfake.New()
+	if err := fake.CreateTable("people", "ID", ""); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	saver := &mypackage.DynamoDBSaver{Client: fake, Table: table, Versioned: true}
+	w, err := mypackage.NewWriteBehindSaver(saver, mypackage.WriteBehindConfig{})
+	if err != nil {
+		t.Fatalf("NewWriteBehindSaver() error = %v", err)
+	}
+
+	johnny := &mypackage.Person{ID: "johnny", Name: "Johnny"}
+	for _, p := range append(people(60), johnny) {
+		if err := w.Save(context.Background(), p); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	items, _ := fake.Items("people")
+	if len(items) != 61 {
+		t.Errorf("expected 61 people stored but got %d", len(items))
+	}
+	if johnny.Version != 0 {
+		t.Errorf("expected the caller's Person to be left alone but got version %d", johnny.Version)
+	}
+}
+
+func TestWriteBehindSaver_SaveCopies(t *testing.T) {
+	fake := ddbfake.New()
+	if err := fake.CreateTable("people", "ID", ""); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	saver := &mypackage.DynamoDBSaver{Client: fake, Table: table}
+	w, err := mypackage.NewWriteBehindSaver(saver, mypackage.WriteBehindConfig{FlushInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewWriteBehindSaver() error = %v", err)
+	}
+
+	p := &mypackage.Person{
+		ID:      "johnny",
+		Name:    "Johnny",
+		Address: &mypackage.Address{City: "Lisbon", Country: "PT"},
+		Tags:    []string{"a", "b"},
+	}
+	if err := w.Save(context.Background(), p); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	// racing with the background save unless Save copied them
+	p.Tags[0] = "changed"
+	p.Address.City = "Porto"
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	got, err := (&mypackage.DynamoDBGetter{Client: fake, Table: table}).Get(context.Background(), "johnny")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Address.City != "Lisbon" || !reflect.DeepEqual(got.Tags, []string{"a", "b"}) {
+		t.Errorf("expected the Person as it was saved but got %+v in %+v", got.Tags, got.Address)
+	}
+}
+
+// namesSaver records the name of every Person it saves, by ID.
+type namesSaver struct {
+	mu    sync.Mutex
+	names map[string][]string
+}
+
+func (s *namesSaver) Save(ctx context.Context, p *mypackage.Person) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.names == nil {
+		s.names = make(map[string][]string)
+	}
+	s.names[p.ID] = append(s.names[p.ID], p.Name)
+	return nil
+}
+
+func TestWriteBehindSaver_SameIDInBatch(t *testing.T) {
+	saver := &namesSaver{}
+	w, err := mypackage.NewWriteBehindSaver(saver, mypackage.WriteBehindConfig{BatchSize: 10, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWriteBehindSaver() error = %v", err)
+	}
+
+	for _, p := range []*mypackage.Person{{ID: "p1", Name: "Old"}, {ID: "p2", Name: "Jane"}, {ID: "p1", Name: "New"}} {
+		if err := w.Save(context.Background(), p); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// saving both copies of p1 concurrently could store the old one last
+	want := map[string][]string{"p1": {"New"}, "p2": {"Jane"}}
+	if !reflect.DeepEqual(saver.names, want) {
+		t.Errorf("expected %v saved but got %v", want, saver.names)
+	}
+}
+
+func TestNewWriteBehindSaver(t *testing.T) {
+	saver := &mypackage.DynamoDBSaver{Client: &testClient{}, Table: table}
+
+	tests := map[string]struct {
+		saver *mypackage.DynamoDBSaver
+		cfg   mypackage.WriteBehindConfig
+	}{
+		"no saver":           {cfg: mypackage.WriteBehindConfig{}},
+		"negative buffer":    {saver: saver, cfg: mypackage.WriteBehindConfig{BufferSize: -1}},
+		"batch above buffer": {saver: saver, cfg: mypackage.WriteBehindConfig{BufferSize: 10, BatchSize: 11}},
+		"negative interval":  {saver: saver, cfg: mypackage.WriteBehindConfig{FlushInterval: -time.Second}},
+		"unknown overflow":   {saver: saver, cfg: mypackage.WriteBehindConfig{Overflow: 7}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var s interface {
+				Save(context.Context, *mypackage.Person) error
+			}
+			if tc.saver != nil {
+				s = tc.saver
+			}
+			if _, err := mypackage.NewWriteBehindSaver(s, tc.cfg); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
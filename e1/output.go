@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e1/mypackage"
+)
+
+// printPerson writes p in format.
+func printPerson(w io.Writer, format string, p *mypackage.Person) error {
+	if format == outputTable {
+		return printTable(w, []*mypackage.Person{p})
+	}
+	return printJSON(w, p)
+}
+
+// printPeople writes people in format.
+func printPeople(w io.Writer, format string, people []*mypackage.Person) error {
+	if format == outputTable {
+		return printTable(w, people)
+	}
+	if people == nil {
+		// an empty array rather than null
+		people = []*mypackage.Person{}
+	}
+	return printJSON(w, people)
+}
+
+func printJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printTable(w io.Writer, people []*mypackage.Person) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tEMAIL\tBIRTH DATE\tCITY\tCOUNTRY\tTAGS\tVERSION\tUPDATED")
+	for _, p := range people {
+		var city, country string
+		if p.Address != nil {
+			city, country = p.Address.City, p.Address.Country
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			p.ID, p.Name, p.Email, p.BirthDate, city, country,
+			strings.Join(p.Tags, ","), p.Version, p.UpdatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"time"
+
+	"github.com/idiomat/dodtnyt/e2/history"
+	"github.com/idiomat/dodtnyt/e2/scanner"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func recordHistory(dsn, profile string, startedAt, finishedAt time.Time, summary *scanner.Summary) error {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return err
+	}
+
+	service := history.NewHistoryService(db)
+	if err := service.Migrate(); err != nil {
+		return err
+	}
+
+	_, err = service.RecordSummary(profile, startedAt, finishedAt, summary)
+	return err
+}
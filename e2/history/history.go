@@ -0,0 +1,151 @@
+package history
+
+import (
+	"time"
+
+	"github.com/idiomat/dodtnyt/e2/scanner"
+	"gorm.io/gorm"
+)
+
+// Port states recorded for a scanned port.
+const (
+	StateOpen    = "open"
+	StateSkipped = "skipped"
+)
+
+// Run is a single invocation of the scanner.
+type Run struct {
+	gorm.Model
+	Profile    string
+	StartedAt  time.Time `gorm:"index"`
+	FinishedAt time.Time
+	Incomplete bool
+	Targets    []Target
+}
+
+// Target is a host scanned as part of a run.
+type Target struct {
+	gorm.Model
+	RunID uint   `gorm:"index"`
+	Host  string `gorm:"index"`
+	Ports []PortResult
+}
+
+// PortResult is what the scanner found on a single port of a target.
+type PortResult struct {
+	gorm.Model
+	TargetID uint `gorm:"index"`
+	Port     int
+	State    string
+	Rule     string
+	Latency  time.Duration
+	Banner   *Banner
+}
+
+// Banner is the response a probe got from an open port.
+type Banner struct {
+	gorm.Model
+	PortResultID uint `gorm:"uniqueIndex"`
+	Probe        string
+	Text         string
+}
+
+// OpenedPort is a port first seen open at FirstSeen.
+type OpenedPort struct {
+	Host      string
+	Port      int
+	FirstSeen time.Time
+}
+
+type HistoryService struct {
+	db *gorm.DB
+}
+
+func NewHistoryService(db *gorm.DB) *HistoryService {
+	return &HistoryService{db: db}
+}
+
+// Migrate creates or updates the scan history tables.
+func (s *HistoryService) Migrate() error {
+	return s.db.AutoMigrate(&Run{}, &Target{}, &PortResult{}, &Banner{})
+}
+
+func (s *HistoryService) CreateRun(run *Run) error {
+	return s.db.Create(run).Error
+}
+
+// RecordSummary stores a scan summary as a run, with one target per host it covers.
+// Hosts scanned without finding an open or skipped port get a target without ports,
+// so their latest state shows the ports that closed.
+func (s *HistoryService) RecordSummary(profile string, startedAt, finishedAt time.Time, summary *scanner.Summary) (*Run, error) {
+	run := &Run{Profile: profile, StartedAt: startedAt, FinishedAt: finishedAt, Incomplete: summary.Incomplete}
+
+	targets := make(map[string]*Target)
+	var hosts []string
+	target := func(host string) *Target {
+		t, ok := targets[host]
+		if !ok {
+			t = &Target{Host: host}
+			targets[host] = t
+			hosts = append(hosts, host)
+		}
+		return t
+	}
+
+	for _, h := range summary.Hosts {
+		target(h)
+	}
+	for _, o := range summary.Open {
+		pr := PortResult{Port: o.Port, State: StateOpen, Latency: o.Latency}
+		if o.Banner != "" {
+			pr.Banner = &Banner{Probe: o.Probe, Text: o.Banner}
+		}
+		t := target(o.Host)
+		t.Ports = append(t.Ports, pr)
+	}
+	for _, sk := range summary.Skipped {
+		t := target(sk.Host)
+		t.Ports = append(t.Ports, PortResult{Port: sk.Port, State: StateSkipped, Rule: sk.Rule})
+	}
+
+	for _, h := range hosts {
+		run.Targets = append(run.Targets, *targets[h])
+	}
+
+	return run, s.CreateRun(run)
+}
+
+func (s *HistoryService) GetRun(id uint) (*Run, error) {
+	var run Run
+	err := s.db.Preload("Targets.Ports.Banner").First(&run, id).Error
+	return &run, err
+}
+
+// LatestState returns the most recent scan of host.
+func (s *HistoryService) LatestState(host string) (*Target, error) {
+	var target Target
+	err := s.db.
+		Joins("JOIN runs ON runs.id = targets.run_id AND runs.deleted_at IS NULL").
+		Where("targets.host = ?", host).
+		Order("runs.started_at DESC, targets.id DESC").
+		Preload("Ports.Banner").
+		First(&target).Error
+	return &target, err
+}
+
+// OpenedSince returns the ports whose first recorded open state is at or after since,
+// ordered by when they were first seen.
+func (s *HistoryService) OpenedSince(since time.Time) ([]OpenedPort, error) {
+	var opened []OpenedPort
+	err := s.db.
+		Table("port_results").
+		Select("targets.host AS host, port_results.port AS port, MIN(runs.started_at) AS first_seen").
+		Joins("JOIN targets ON targets.id = port_results.target_id AND targets.deleted_at IS NULL").
+		Joins("JOIN runs ON runs.id = targets.run_id AND runs.deleted_at IS NULL").
+		Where("port_results.state = ? AND port_results.deleted_at IS NULL", StateOpen).
+		Group("targets.host, port_results.port").
+		Having("MIN(runs.started_at) >= ?", since).
+		Order("first_seen, host, port").
+		Scan(&opened).Error
+	return opened, err
+}
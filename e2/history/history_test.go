@@ -0,0 +1,190 @@
+package history_test
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e2/history"
+	"github.com/idiomat/dodtnyt/e2/scanner"
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go"
+	tpg "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var db *gorm.DB
+var runIntegrationTests = flag.Bool("integration", false, "run integration tests")
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	if *runIntegrationTests {
+		ctx := context.Background()
+		var err error
+
+		pgUser := "user"
+		pgPass := "password"
+		pgDB := "test"
+		pgc, err := tpg.RunContainer(ctx,
+			testcontainers.WithImage("postgres:16-alpine"),
+			tpg.WithDatabase(pgDB),
+			tpg.WithUsername(pgUser),
+			tpg.WithPassword(pgPass),
+			testcontainers.WithWaitStrategy(
+				wait.ForLog("database system is ready to accept connections").
+					WithOccurrence(2).
+					WithStartupTimeout(5*time.Second)),
+		)
+		if err != nil {
+			slog.Error("failed to start postgres container", "error", err)
+			os.Exit(1)
+		}
+
+		defer pgc.Terminate(ctx) // nolint:errcheck
+
+		dsn, err := pgc.ConnectionString(ctx, "sslmode=disable")
+		if err != nil {
+			slog.Error("failed to get connection string", "error", err)
+			os.Exit(1)
+		}
+
+		db, err = gorm.Open(
+			postgres.Open(dsn),
+			&gorm.Config{},
+		)
+		if err != nil {
+			slog.Error("failed to connect to database", "error", err)
+			os.Exit(1)
+		}
+
+		if err := history.NewHistoryService(db).Migrate(); err != nil {
+			slog.Error("failed to migrate database", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Run the tests
+	exitCode := m.Run()
+
+	os.Exit(exitCode)
+}
+
+func TestRecordSummary_Integration(t *testing.T) {
+	if !*runIntegrationTests {
+		t.Skip("skipping integration test")
+	}
+
+	service := history.NewHistoryService(db)
+
+	start := time.Now()
+	summary := &scanner.Summary{
+		Open: []scanner.OpenPort{
+			{Endpoint: scanner.Endpoint{Host: "record.example", Port: 22}, Probe: "banner", Banner: "SSH-2.0-OpenSSH_9.6"},
+			{Endpoint: scanner.Endpoint{Host: "record.example", Port: 80}},
+		},
+		Skipped: []scanner.Skipped{
+			{Endpoint: scanner.Endpoint{Host: "record.example", Port: 502}, Rule: "502"},
+		},
+	}
+
+	run, err := service.RecordSummary("web-quick", start, start.Add(time.Second), summary)
+	assert.Nil(t, err)
+
+	run, err = service.GetRun(run.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "web-quick", run.Profile)
+	assert.Len(t, run.Targets, 1)
+	assert.Equal(t, "record.example", run.Targets[0].Host)
+	assert.Len(t, run.Targets[0].Ports, 3)
+
+	var banners int
+	for _, p := range run.Targets[0].Ports {
+		if p.Banner != nil {
+			banners++
+			assert.Equal(t, "SSH-2.0-OpenSSH_9.6", p.Banner.Text)
+		}
+	}
+	assert.Equal(t, 1, banners)
+}
+
+func TestLatestState_Integration(t *testing.T) {
+	if !*runIntegrationTests {
+		t.Skip("skipping integration test")
+	}
+
+	service := history.NewHistoryService(db)
+
+	older := time.Now().Add(-time.Hour)
+	newer := time.Now()
+	open := func(port int) scanner.OpenPort {
+		return scanner.OpenPort{Endpoint: scanner.Endpoint{Host: "latest.example", Port: port}}
+	}
+
+	_, err := service.RecordSummary("", older, older, &scanner.Summary{Open: []scanner.OpenPort{open(22), open(80)}})
+	assert.Nil(t, err)
+	_, err = service.RecordSummary("", newer, newer, &scanner.Summary{Open: []scanner.OpenPort{open(443)}})
+	assert.Nil(t, err)
+
+	target, err := service.LatestState("latest.example")
+	assert.Nil(t, err)
+	assert.Len(t, target.Ports, 1)
+	assert.Equal(t, 443, target.Ports[0].Port)
+	assert.Equal(t, history.StateOpen, target.Ports[0].State)
+}
+
+func TestLatestState_AllClosed_Integration(t *testing.T) {
+	if !*runIntegrationTests {
+		t.Skip("skipping integration test")
+	}
+
+	service := history.NewHistoryService(db)
+
+	older := time.Now().Add(-time.Hour)
+	newer := time.Now()
+	open := scanner.OpenPort{Endpoint: scanner.Endpoint{Host: "closed.example", Port: 22}}
+
+	_, err := service.RecordSummary("", older, older, &scanner.Summary{Hosts: []string{"closed.example"}, Open: []scanner.OpenPort{open}})
+	assert.Nil(t, err)
+	_, err = service.RecordSummary("", newer, newer, &scanner.Summary{Hosts: []string{"closed.example"}})
+	assert.Nil(t, err)
+
+	target, err := service.LatestState("closed.example")
+	assert.Nil(t, err)
+	assert.Empty(t, target.Ports)
+}
+
+func TestOpenedSince_Integration(t *testing.T) {
+	if !*runIntegrationTests {
+		t.Skip("skipping integration test")
+	}
+
+	service := history.NewHistoryService(db)
+
+	dayAgo := time.Now().Add(-24 * time.Hour)
+	hourAgo := time.Now().Add(-time.Hour)
+	open := func(port int) scanner.OpenPort {
+		return scanner.OpenPort{Endpoint: scanner.Endpoint{Host: "opened.example", Port: port}}
+	}
+
+	_, err := service.RecordSummary("", dayAgo, dayAgo, &scanner.Summary{Open: []scanner.OpenPort{open(22)}})
+	assert.Nil(t, err)
+	_, err = service.RecordSummary("", hourAgo, hourAgo, &scanner.Summary{Open: []scanner.OpenPort{open(22), open(8080)}})
+	assert.Nil(t, err)
+
+	opened, err := service.OpenedSince(time.Now().Add(-2 * time.Hour))
+	assert.Nil(t, err)
+
+	var found []int
+	for _, o := range opened {
+		if o.Host == "opened.example" {
+			found = append(found, o.Port)
+		}
+	}
+	assert.Equal(t, []int{8080}, found)
+}
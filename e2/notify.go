@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e2/notify"
+	"github.com/idiomat/dodtnyt/e2/scanner"
+)
+
+// monitor tracks what a scan looked at so its results can be compared with the previous scan.
+type monitor struct {
+	notifier  *notify.Notifier
+	statePath string
+	previous  notify.State
+
+	scannedHosts map[string]bool
+	// scanned ports are only tracked for hosts in the previous state,
+	// the only ones that can have closed ports
+	scannedPorts map[string]map[int]bool
+}
+
+// newMonitor returns nil when no notification sink is configured.
+func newMonitor(webhookURL, secret, execHook, statePath, notifyOn string) (*monitor, error) {
+	var sinks []notify.Sink
+
+	if webhookURL != "" {
+		endpoint, err := url.Parse(webhookURL)
+		if err != nil {
+			return nil, err
+		}
+		webhook, err := notify.NewWebhook(&http.Client{Timeout: 10 * time.Second}, endpoint, secret)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, webhook)
+	}
+
+	if execHook != "" {
+		fields := strings.Fields(execHook)
+		if len(fields) == 0 {
+			return nil, errors.New("-exec-hook needs a command")
+		}
+		hook, err := notify.NewExecHook(fields[0], fields[1:]...)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, hook)
+	}
+
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+
+	types, err := notify.ParseEventTypes(notifyOn)
+	if err != nil {
+		return nil, err
+	}
+	notifier, err := notify.NewNotifier(sinks, types...)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := notify.LoadState(statePath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", statePath, err)
+	}
+
+	return &monitor{
+		notifier:     notifier,
+		statePath:    statePath,
+		previous:     previous,
+		scannedHosts: make(map[string]bool),
+		scannedPorts: make(map[string]map[int]bool),
+	}, nil
+}
+
+// observe is a scanner result hook.
+func (m *monitor) observe(r scanner.Result) {
+	m.scannedHosts[r.Host] = true
+	if _, ok := m.previous[r.Host]; !ok || r.ExcludedBy != "" {
+		return
+	}
+	if m.scannedPorts[r.Host] == nil {
+		m.scannedPorts[r.Host] = make(map[int]bool)
+	}
+	m.scannedPorts[r.Host][r.Port] = true
+}
+
+// finish notifies about what changed since the previous scan and saves the new state.
+// An incomplete scan only reports a failure, since what it didn't reach would look closed.
+func (m *monitor) finish(ctx context.Context, summary *scanner.Summary, scanErr error) error {
+	now := time.Now()
+	if scanErr != nil {
+		if errors.Is(scanErr, context.Canceled) {
+			return nil
+		}
+		return m.notifier.Notify(ctx, notify.Event{Type: notify.ScanFailed, Error: scanErr.Error(), Time: now})
+	}
+
+	current := notify.State{}
+	banners := make(map[string]map[int]string)
+	for _, o := range summary.Open {
+		current[o.Host] = append(current[o.Host], o.Port)
+		if o.Banner != "" {
+			if banners[o.Host] == nil {
+				banners[o.Host] = make(map[int]string)
+			}
+			banners[o.Host][o.Port] = o.Banner
+		}
+	}
+
+	scanned := func(host string, port int) bool { return m.scannedPorts[host][port] }
+	events := notify.Diff(m.previous, current, banners, scanned, now)
+
+	next := m.previous.Update(current, func(host string) bool { return m.scannedHosts[host] })
+	if err := notify.SaveState(m.statePath, next); err != nil {
+		return err
+	}
+
+	return m.notifier.Notify(ctx, events...)
+}
@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultExecTimeout = 30 * time.Second
+
+// ExecHook runs a local command for every event.
+// The event is written to the command's stdin as JSON and also exposed
+// in the SCAN_EVENT_TYPE, SCAN_EVENT_HOST and SCAN_EVENT_PORT environment variables.
+type ExecHook struct {
+	name    string
+	args    []string
+	timeout time.Duration
+}
+
+func (h *ExecHook) validate() error {
+	if h.name == "" {
+		return errors.New("command is required")
+	}
+	if h.timeout <= 0 {
+		return fmt.Errorf("invalid timeout: %s", h.timeout)
+	}
+	return nil
+}
+
+// NewExecHook returns an ExecHook running name with args, killing it after DefaultExecTimeout.
+func NewExecHook(name string, args ...string) (*ExecHook, error) {
+	h := &ExecHook{name: name, args: args, timeout: DefaultExecTimeout}
+	return h, h.validate()
+}
+
+// Notify runs the command for e and waits for it to exit.
+func (h *ExecHook) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.name, h.args...)
+	cmd.Stdin = bytes.NewReader(append(body, '\n'))
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(),
+		"SCAN_EVENT_TYPE="+string(e.Type),
+		"SCAN_EVENT_HOST="+e.Host,
+		"SCAN_EVENT_PORT="+strconv.Itoa(e.Port),
+	)
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", h.name, err, msg)
+		}
+		return fmt.Errorf("%s: %w", h.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/idiomat/dodtnyt/e2/notify"
+)
+
+func TestExecHook_Notify(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	out := filepath.Join(t.TempDir(), "event")
+	hook, err := notify.NewExecHook("sh", "-c", `cat > "$1"; echo "$SCAN_EVENT_TYPE $SCAN_EVENT_HOST $SCAN_EVENT_PORT" >> "$1"`, "sh", out)
+	if err != nil {
+		t.Fatalf("NewExecHook() error = %v", err)
+	}
+
+	event := notify.Event{Type: notify.PortOpened, Host: "10.0.0.1", Port: 22}
+	if err := hook.Notify(context.Background(), event); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	bs, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read hook output: %v", err)
+	}
+	stdin, env, _ := strings.Cut(string(bs), "\n")
+
+	var got notify.Event
+	if err := json.Unmarshal([]byte(stdin), &got); err != nil {
+		t.Fatalf("hook stdin %q is not an event: %v", stdin, err)
+	}
+	if got.Type != event.Type || got.Host != event.Host || got.Port != event.Port {
+		t.Errorf("hook stdin = %+v, want %+v", got, event)
+	}
+	if strings.TrimSpace(env) != "port_opened 10.0.0.1 22" {
+		t.Errorf("hook environment = %q, want %q", env, "port_opened 10.0.0.1 22")
+	}
+}
+
+func TestExecHook_NotifyFailure(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	hook, err := notify.NewExecHook("sh", "-c", "echo paging failed >&2; exit 3")
+	if err != nil {
+		t.Fatalf("NewExecHook() error = %v", err)
+	}
+
+	err = hook.Notify(context.Background(), notify.Event{Type: notify.HostDown, Host: "10.0.0.1"})
+	if err == nil || !strings.Contains(err.Error(), "paging failed") {
+		t.Errorf("Notify() error = %v, want the command's stderr", err)
+	}
+
+	if _, err := notify.NewExecHook(""); err == nil {
+		t.Errorf("NewExecHook() without a command expected error")
+	}
+}
@@ -0,0 +1,167 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EventType is the kind of change a scan found.
+type EventType string
+
+const (
+	PortOpened EventType = "port_opened"
+	PortClosed EventType = "port_closed"
+	HostDown   EventType = "host_down"
+	ScanFailed EventType = "scan_failed"
+)
+
+// EventTypes are all the event types, in the order they are documented.
+var EventTypes = []EventType{PortOpened, PortClosed, HostDown, ScanFailed}
+
+// Event is a single notification.
+type Event struct {
+	Type   EventType `json:"type"`
+	Host   string    `json:"host,omitempty"`
+	Port   int       `json:"port,omitempty"`
+	Banner string    `json:"banner,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Sink delivers events somewhere.
+type Sink interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// Notifier sends events to every sink, keeping only the event types it was asked for.
+type Notifier struct {
+	sinks []Sink
+	types map[EventType]bool
+}
+
+func (n *Notifier) validate() error {
+	if len(n.sinks) == 0 {
+		return errors.New("at least one sink is required")
+	}
+	for i, s := range n.sinks {
+		if s == nil {
+			return fmt.Errorf("sink %d is nil", i)
+		}
+	}
+	return nil
+}
+
+// NewNotifier returns a Notifier delivering to sinks. With no types, every event type is delivered.
+func NewNotifier(sinks []Sink, types ...EventType) (*Notifier, error) {
+	n := &Notifier{sinks: sinks, types: make(map[EventType]bool)}
+	if len(types) == 0 {
+		types = EventTypes
+	}
+	for _, t := range types {
+		n.types[t] = true
+	}
+	return n, n.validate()
+}
+
+// ParseEventTypes parses a comma-separated list of event types.
+func ParseEventTypes(list string) ([]EventType, error) {
+	known := make(map[EventType]bool)
+	var names []string
+	for _, t := range EventTypes {
+		known[t] = true
+		names = append(names, string(t))
+	}
+
+	var types []EventType
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !known[EventType(name)] {
+			return nil, fmt.Errorf("unknown event type %q (want one of %s)", name, strings.Join(names, ", "))
+		}
+		types = append(types, EventType(name))
+	}
+	return types, nil
+}
+
+// Notify delivers each event to every sink. A failing sink doesn't stop delivery to the others;
+// all failures are returned together.
+func (n *Notifier) Notify(ctx context.Context, events ...Event) error {
+	var errs []error
+	for _, e := range events {
+		if !n.types[e.Type] {
+			continue
+		}
+		for _, s := range n.sinks {
+			if err := s.Notify(ctx, e); err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", e.Type, e.Host, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Diff compares the open ports of the previous scan with the current one and returns the events between them.
+// Ports closed are only reported when scanned(host, port) says the current scan looked at them,
+// and a host that had open ports and now has none is reported as down instead of port by port.
+func Diff(previous, current State, banners map[string]map[int]string, scanned func(host string, port int) bool, now time.Time) []Event {
+	var events []Event
+
+	for _, host := range current.Hosts() {
+		was := toSet(previous[host])
+		for _, p := range current[host] {
+			if !was[p] {
+				events = append(events, Event{Type: PortOpened, Host: host, Port: p, Banner: banners[host][p], Time: now})
+			}
+		}
+	}
+
+	for _, host := range previous.Hosts() {
+		is := toSet(current[host])
+		var closed []int
+		for _, p := range previous[host] {
+			if !is[p] && scanned(host, p) {
+				closed = append(closed, p)
+			}
+		}
+		if len(closed) == 0 {
+			continue
+		}
+		if len(current[host]) == 0 && len(closed) == len(previous[host]) {
+			events = append(events, Event{Type: HostDown, Host: host, Time: now})
+			continue
+		}
+		for _, p := range closed {
+			events = append(events, Event{Type: PortClosed, Host: host, Port: p, Time: now})
+		}
+	}
+
+	return events
+}
+
+func toSet(ports []int) map[int]bool {
+	set := make(map[int]bool, len(ports))
+	for _, p := range ports {
+		set[p] = true
+	}
+	return set
+}
+
+// State is the open ports of every host, as last seen.
+type State map[string][]int
+
+// Hosts returns the hosts in s in sorted order.
+func (s State) Hosts() []string {
+	hosts := make([]string, 0, len(s))
+	for h := range s {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
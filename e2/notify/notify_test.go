@@ -0,0 +1,144 @@
+package notify_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e2/notify"
+)
+
+func TestDiff(t *testing.T) {
+	now := time.Unix(100, 0)
+	all := func(string, int) bool { return true }
+
+	tests := map[string]struct {
+		previous notify.State
+		current  notify.State
+		scanned  func(string, int) bool
+		want     []notify.Event
+	}{
+		"first scan": {
+			previous: notify.State{},
+			current:  notify.State{"a": {22}},
+			scanned:  all,
+			want: []notify.Event{
+				{Type: notify.PortOpened, Host: "a", Port: 22, Banner: "SSH-2.0", Time: now},
+			},
+		},
+		"no change": {
+			previous: notify.State{"a": {22, 80}},
+			current:  notify.State{"a": {80, 22}},
+			scanned:  all,
+		},
+		"opened and closed": {
+			previous: notify.State{"a": {22, 80}},
+			current:  notify.State{"a": {22, 443}},
+			scanned:  all,
+			want: []notify.Event{
+				{Type: notify.PortOpened, Host: "a", Port: 443, Time: now},
+				{Type: notify.PortClosed, Host: "a", Port: 80, Time: now},
+			},
+		},
+		"host down": {
+			previous: notify.State{"a": {22, 80}},
+			current:  notify.State{},
+			scanned:  all,
+			want: []notify.Event{
+				{Type: notify.HostDown, Host: "a", Time: now},
+			},
+		},
+		"ports not scanned this time": {
+			previous: notify.State{"a": {22, 80}, "b": {22}},
+			current:  notify.State{"a": {22}},
+			scanned:  func(host string, port int) bool { return host == "a" && port == 22 },
+		},
+	}
+
+	banners := map[string]map[int]string{"a": {22: "SSH-2.0"}}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := notify.Diff(tt.previous, tt.current, banners, tt.scanned, now)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// recordingSink keeps every event it is sent.
+type recordingSink struct {
+	events []notify.Event
+	err    error
+}
+
+func (s *recordingSink) Notify(ctx context.Context, e notify.Event) error {
+	s.events = append(s.events, e)
+	return s.err
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	failing := &recordingSink{err: errors.New("unreachable")}
+	working := &recordingSink{}
+
+	types, err := notify.ParseEventTypes("port_opened, scan_failed")
+	if err != nil {
+		t.Fatalf("ParseEventTypes() error = %v", err)
+	}
+	notifier, err := notify.NewNotifier([]notify.Sink{failing, working}, types...)
+	if err != nil {
+		t.Fatalf("NewNotifier() error = %v", err)
+	}
+
+	err = notifier.Notify(context.Background(),
+		notify.Event{Type: notify.PortOpened, Host: "a", Port: 22},
+		notify.Event{Type: notify.PortClosed, Host: "a", Port: 80},
+		notify.Event{Type: notify.ScanFailed, Error: "boom"},
+	)
+	if err == nil {
+		t.Errorf("Notify() expected the failing sink's error")
+	}
+	if len(working.events) != 2 || len(failing.events) != 2 {
+		t.Errorf("sinks got %d and %d events, want 2 each", len(failing.events), len(working.events))
+	}
+
+	if _, err := notify.ParseEventTypes("port_opened,port_flapped"); err == nil {
+		t.Errorf("ParseEventTypes() expected error for unknown type")
+	}
+	if _, err := notify.NewNotifier(nil); err == nil {
+		t.Errorf("NewNotifier() without sinks expected error")
+	}
+}
+
+func TestState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	s, err := notify.LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState() of a missing file error = %v", err)
+	}
+	if len(s) != 0 {
+		t.Errorf("LoadState() of a missing file = %v, want empty", s)
+	}
+
+	previous := notify.State{"a": {22}, "b": {80}, "c": {443}}
+	next := previous.Update(notify.State{"a": {443, 22}}, func(host string) bool { return host != "c" })
+	want := notify.State{"a": {22, 443}, "c": {443}}
+	if !reflect.DeepEqual(next, want) {
+		t.Errorf("Update() = %v, want %v", next, want)
+	}
+
+	if err := notify.SaveState(path, next); err != nil {
+		t.Fatalf("SaveState() error = %v", err)
+	}
+	loaded, err := notify.LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, want) {
+		t.Errorf("LoadState() = %v, want %v", loaded, want)
+	}
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// LoadState reads a state file written by SaveState. A missing file is an empty state,
+// so the first monitored scan reports every open port as opened.
+func LoadState(path string) (State, error) {
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return State{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var s State
+	if err := json.Unmarshal(bs, &s); err != nil {
+		return nil, err
+	}
+	if s == nil {
+		s = State{}
+	}
+	return s, nil
+}
+
+// SaveState writes s to path, replacing the file atomically so an interrupted write
+// never leaves a truncated state behind.
+func SaveState(path string, s State) error {
+	bs, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Update returns the state after a scan: hosts the scan covered take their current open ports,
+// every other host keeps what was seen before.
+func (s State) Update(current State, scannedHost func(host string) bool) State {
+	next := State{}
+	for host, ports := range s {
+		if !scannedHost(host) {
+			next[host] = ports
+		}
+	}
+	for host, ports := range current {
+		if len(ports) > 0 {
+			sorted := append([]int(nil), ports...)
+			sort.Ints(sorted)
+			next[host] = sorted
+		}
+	}
+	return next
+}
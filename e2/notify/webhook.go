@@ -0,0 +1,136 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body, prefixed with "sha256=".
+const SignatureHeader = "X-Scan-Signature-256"
+
+const DefaultWebhookRetries = 3
+const DefaultWebhookBackoff = 500 * time.Millisecond
+
+// Webhook POSTs events as JSON to an HTTP endpoint.
+// When a secret is set, every request is signed so receivers can verify it came from us.
+type Webhook struct {
+	httpClient   *http.Client
+	httpEndpoint *url.URL
+	secret       []byte
+	retries      int
+	backoff      time.Duration
+}
+
+func (w *Webhook) validate() error {
+	if w.httpClient == nil {
+		return errors.New("httpClient is required")
+	}
+	if w.httpEndpoint == nil {
+		return errors.New("httpEndpoint is required")
+	}
+	if w.retries < 0 {
+		return fmt.Errorf("invalid number of retries: %d", w.retries)
+	}
+	return nil
+}
+
+// NewWebhook returns a Webhook posting to endpoint, retrying failed deliveries
+// DefaultWebhookRetries times. An empty secret leaves requests unsigned.
+func NewWebhook(httpClient *http.Client, endpoint *url.URL, secret string) (*Webhook, error) {
+	w := &Webhook{
+		httpClient:   httpClient,
+		httpEndpoint: endpoint,
+		secret:       []byte(secret),
+		retries:      DefaultWebhookRetries,
+		backoff:      DefaultWebhookBackoff,
+	}
+	return w, w.validate()
+}
+
+// SetRetries sets how many times a failed delivery is retried,
+// waiting backoff, doubled each time and jittered, between attempts.
+func (w *Webhook) SetRetries(retries int, backoff time.Duration) error {
+	if retries < 0 {
+		return fmt.Errorf("invalid number of retries: %d", retries)
+	}
+	if backoff < 0 {
+		return fmt.Errorf("invalid backoff: %s", backoff)
+	}
+	w.retries, w.backoff = retries, backoff
+	return nil
+}
+
+// Sign returns the signature of body under secret, as sent in SignatureHeader.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify delivers e. Network errors and 5xx or 429 responses are retried;
+// any other non-2xx response is final.
+func (w *Webhook) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := w.post(ctx, body)
+		if err == nil || !retryable || attempt == w.retries {
+			return err
+		}
+
+		// full jitter keeps many scanners from retrying in lockstep
+		wait := time.Duration(rand.Int63n(int64(backoff) + 1))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if backoff < math.MaxInt64/2 {
+			backoff *= 2
+		}
+	}
+}
+
+func (w *Webhook) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		w.httpEndpoint.String(),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(w.secret, body))
+	}
+
+	res, err := w.httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		retryable := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+		return retryable, fmt.Errorf("unexpected status code: %s", res.Status)
+	}
+	return false, nil
+}
@@ -0,0 +1,146 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e2/notify"
+)
+
+func TestWebhook_Notify(t *testing.T) {
+	tests := map[string]struct {
+		statuses     []int // status returned on each attempt; the last one repeats
+		secret       string
+		wantErr      bool
+		wantAttempts int32
+	}{
+		"delivered": {
+			statuses:     []int{http.StatusOK},
+			secret:       "s3cret",
+			wantAttempts: 1,
+		},
+		"unsigned": {
+			statuses:     []int{http.StatusNoContent},
+			wantAttempts: 1,
+		},
+		"retried after server errors": {
+			statuses:     []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK},
+			secret:       "s3cret",
+			wantAttempts: 3,
+		},
+		"gives up after retries": {
+			statuses:     []int{http.StatusServiceUnavailable},
+			wantErr:      true,
+			wantAttempts: 3,
+		},
+		"client errors are not retried": {
+			statuses:     []int{http.StatusBadRequest},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+	}
+
+	event := notify.Event{Type: notify.PortOpened, Host: "10.0.0.1", Port: 22, Time: time.Unix(0, 0).UTC()}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var attempts atomic.Int32
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(attempts.Add(1))
+
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("failed to read body: %v", err)
+				}
+
+				sig := r.Header.Get(notify.SignatureHeader)
+				if tt.secret == "" && sig != "" {
+					t.Errorf("unsigned webhook sent signature %q", sig)
+				}
+				if tt.secret != "" && sig != notify.Sign([]byte(tt.secret), body) {
+					t.Errorf("signature %q does not match body", sig)
+				}
+
+				var got notify.Event
+				if err := json.Unmarshal(body, &got); err != nil {
+					t.Errorf("failed to decode event: %v", err)
+				}
+				if got != event {
+					t.Errorf("received %+v, want %+v", got, event)
+				}
+
+				status := tt.statuses[len(tt.statuses)-1]
+				if n <= len(tt.statuses) {
+					status = tt.statuses[n-1]
+				}
+				w.WriteHeader(status)
+			}))
+			defer mockServer.Close()
+
+			endpointURL, err := url.Parse(mockServer.URL)
+			if err != nil {
+				t.Fatalf("Failed to parse mock server URL: %v", err)
+			}
+
+			webhook, err := notify.NewWebhook(mockServer.Client(), endpointURL, tt.secret)
+			if err != nil {
+				t.Fatalf("Failed to create webhook: %v", err)
+			}
+			if err := webhook.SetRetries(2, time.Millisecond); err != nil {
+				t.Fatalf("SetRetries() error = %v", err)
+			}
+
+			err = webhook.Notify(context.Background(), event)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestNewWebhook(t *testing.T) {
+	endpointURL, _ := url.Parse("http://localhost/hook")
+
+	if _, err := notify.NewWebhook(nil, endpointURL, ""); err == nil {
+		t.Errorf("NewWebhook() with nil client expected error")
+	}
+	if _, err := notify.NewWebhook(http.DefaultClient, nil, ""); err == nil {
+		t.Errorf("NewWebhook() with nil endpoint expected error")
+	}
+}
+
+func TestWebhook_SetRetries(t *testing.T) {
+	endpointURL, _ := url.Parse("http://localhost/hook")
+	webhook, err := notify.NewWebhook(http.DefaultClient, endpointURL, "")
+	if err != nil {
+		t.Fatalf("NewWebhook() error = %v", err)
+	}
+
+	tests := map[string]struct {
+		retries int
+		backoff time.Duration
+		wantErr bool
+	}{
+		"valid":            {retries: 3, backoff: time.Second},
+		"no backoff":       {retries: 3},
+		"negative retries": {retries: -1, backoff: time.Second, wantErr: true},
+		"negative backoff": {retries: 3, backoff: -time.Second, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := webhook.SetRetries(tt.retries, tt.backoff); (err != nil) != tt.wantErr {
+				t.Errorf("SetRetries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e2/profile"
+)
+
+func loadProfile(path, name string) (*profile.Profile, error) {
+	file, err := profile.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file.Get(name)
+}
+
+// explicitFlags returns the names of the flags set on the command line.
+func explicitFlags() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// applyProfile copies the profile into the flag variables, except for flags set explicitly,
+// and returns the hosts to scan.
+func applyProfile(p *profile.Profile, explicit map[string]bool) []string {
+	if p.Ports != "" && !explicit["ports"] {
+		ports = p.Ports
+	}
+	if p.Workers > 0 && !explicit["workers"] {
+		numWorkers = p.Workers
+	}
+	if p.Timeouts.Connect > 0 && !explicit["timeout"] {
+		connectTimeout = time.Duration(p.Timeouts.Connect)
+	}
+	if p.Timeouts.Probe > 0 && !explicit["probe-timeout"] {
+		probeTimeout = time.Duration(p.Timeouts.Probe)
+	}
+	if p.RateLimit > 0 && !explicit["rate"] {
+		rateLimit = p.RateLimit
+	}
+	if len(p.Probes) > 0 && !explicit["probes"] {
+		probes = strings.Join(p.Probes, ",")
+	}
+	if p.Output != "" && !explicit["output"] {
+		output = p.Output
+	}
+
+	if len(p.Targets) == 0 || explicit["host"] {
+		return []string{host}
+	}
+	return p.Targets
+}
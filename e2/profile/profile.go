@@ -0,0 +1,190 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e2/scanner"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats understood by the scan CLI.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// Duration is a time.Duration written as a string (e.g. 500ms, 2s) in config files.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Timeouts bound how long the scanner waits on a single port.
+type Timeouts struct {
+	Connect Duration `yaml:"connect" json:"connect"`
+	Probe   Duration `yaml:"probe" json:"probe"`
+}
+
+// Profile bundles the parameters of a scan under a name.
+type Profile struct {
+	Name      string   `yaml:"-" json:"-"`
+	Targets   []string `yaml:"targets" json:"targets"`
+	Ports     string   `yaml:"ports" json:"ports"`
+	Workers   int      `yaml:"workers" json:"workers"`
+	Timeouts  Timeouts `yaml:"timeouts" json:"timeouts"`
+	RateLimit float64  `yaml:"rate_limit" json:"rate_limit"`
+	Probes    []string `yaml:"probes" json:"probes"`
+	Output    string   `yaml:"output" json:"output"`
+}
+
+// File is the on-disk layout of a profiles config file.
+type File struct {
+	Profiles map[string]*Profile `yaml:"profiles" json:"profiles"`
+}
+
+// FieldError is a validation error for a single config key.
+type FieldError struct {
+	Key string
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Load reads a profiles file, choosing the format by extension (.json, .yaml or .yml).
+func Load(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		return Decode(f, "json")
+	case ".yaml", ".yml":
+		return Decode(f, "yaml")
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q", ext)
+	}
+}
+
+// Decode reads profiles in the given format ("json" or "yaml") and validates every one of them.
+// Unknown keys are rejected so a typo doesn't silently fall back to a default.
+func Decode(rdr io.Reader, format string) (*File, error) {
+	var file File
+	switch format {
+	case "json":
+		dec := json.NewDecoder(rdr)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&file); err != nil {
+			return nil, err
+		}
+	case "yaml":
+		dec := yaml.NewDecoder(rdr)
+		dec.KnownFields(true)
+		if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format %q", format)
+	}
+
+	names := make([]string, 0, len(file.Profiles))
+	for name := range file.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := file.Profiles[name]
+		if p == nil {
+			p = &Profile{}
+			file.Profiles[name] = p
+		}
+		p.Name = name
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &file, nil
+}
+
+// Get returns the profile with the given name.
+func (f *File) Get(name string) (*Profile, error) {
+	p, ok := f.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found", name)
+	}
+	return p, nil
+}
+
+// Validate checks every field of the profile, reporting the first bad one by its config key.
+func (p *Profile) Validate() error {
+	key := func(field string) string {
+		return fmt.Sprintf("profiles.%s.%s", p.Name, field)
+	}
+
+	for i, t := range p.Targets {
+		if strings.TrimSpace(t) == "" {
+			return &FieldError{Key: fmt.Sprintf("%s[%d]", key("targets"), i), Err: errors.New("target must not be empty")}
+		}
+		if _, err := scanner.NewTargetReader(strings.NewReader(t)).Next(); err != nil {
+			return &FieldError{Key: fmt.Sprintf("%s[%d]", key("targets"), i), Err: err}
+		}
+	}
+	if p.Ports != "" {
+		if _, err := scanner.ParsePorts(p.Ports); err != nil {
+			return &FieldError{Key: key("ports"), Err: err}
+		}
+	}
+	if p.Workers < 0 {
+		return &FieldError{Key: key("workers"), Err: fmt.Errorf("invalid number of workers: %d", p.Workers)}
+	}
+	if p.Timeouts.Connect < 0 {
+		return &FieldError{Key: key("timeouts.connect"), Err: errors.New("timeout must not be negative")}
+	}
+	if p.Timeouts.Probe < 0 {
+		return &FieldError{Key: key("timeouts.probe"), Err: errors.New("timeout must not be negative")}
+	}
+	if p.RateLimit < 0 {
+		return &FieldError{Key: key("rate_limit"), Err: fmt.Errorf("invalid rate limit: %v", p.RateLimit)}
+	}
+	for i, name := range p.Probes {
+		if _, ok := scanner.Probes[name]; !ok {
+			return &FieldError{
+				Key: fmt.Sprintf("%s[%d]", key("probes"), i),
+				Err: fmt.Errorf("unknown probe %q (want one of %s)", name, strings.Join(scanner.ProbeNames(), ", ")),
+			}
+		}
+	}
+	switch p.Output {
+	case "", OutputText, OutputJSON:
+	default:
+		return &FieldError{Key: key("output"), Err: fmt.Errorf("unknown output format %q (want %s or %s)", p.Output, OutputText, OutputJSON)}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package profile_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e2/profile"
+)
+
+func TestDecode(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		format  string
+		wantKey string
+		wantErr bool
+	}{
+		"valid yaml": {
+			format: "yaml",
+			input: `
+profiles:
+  web-quick:
+    targets: [10.0.0.1, example.com]
+    ports: "80,443,8000-8100"
+    workers: 8
+    timeouts:
+      connect: 500ms
+      probe: 1s
+    rate_limit: 200
+    probes: [http]
+    output: json
+`,
+		},
+		"valid json": {
+			format: "json",
+			input:  `{"profiles": {"web-quick": {"ports": "80", "timeouts": {"connect": "2s"}}}}`,
+		},
+		"unknown key": {
+			format:  "yaml",
+			input:   "profiles:\n  web-quick:\n    wokers: 8\n",
+			wantErr: true,
+		},
+		"bad target": {
+			format:  "yaml",
+			input:   "profiles:\n  web-quick:\n    targets: [10.0.0.1, 10.0.0.0/40]\n",
+			wantKey: "profiles.web-quick.targets[1]",
+			wantErr: true,
+		},
+		"bad ports": {
+			format:  "yaml",
+			input:   "profiles:\n  web-quick:\n    ports: 80-http\n",
+			wantKey: "profiles.web-quick.ports",
+			wantErr: true,
+		},
+		"negative workers": {
+			format:  "json",
+			input:   `{"profiles": {"web-quick": {"workers": -1}}}`,
+			wantKey: "profiles.web-quick.workers",
+			wantErr: true,
+		},
+		"bad timeout": {
+			format:  "yaml",
+			input:   "profiles:\n  web-quick:\n    timeouts:\n      connect: soon\n",
+			wantErr: true,
+		},
+		"unknown probe": {
+			format:  "yaml",
+			input:   "profiles:\n  web-quick:\n    probes: [http, gopher]\n",
+			wantKey: "profiles.web-quick.probes[1]",
+			wantErr: true,
+		},
+		"unknown output": {
+			format:  "yaml",
+			input:   "profiles:\n  web-quick:\n    output: xml\n",
+			wantKey: "profiles.web-quick.output",
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			file, err := profile.Decode(strings.NewReader(tt.input), tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantKey != "" {
+				var fieldErr *profile.FieldError
+				if !errors.As(err, &fieldErr) || fieldErr.Key != tt.wantKey {
+					t.Errorf("Decode() error = %v, want error for key %s", err, tt.wantKey)
+				}
+			}
+			if err != nil {
+				return
+			}
+			if _, err := file.Get("web-quick"); err != nil {
+				t.Errorf("Get() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestDecode_Fields(t *testing.T) {
+	input := `
+profiles:
+  web-quick:
+    targets: [10.0.0.1]
+    timeouts:
+      connect: 500ms
+    rate_limit: 50
+`
+	file, err := profile.Decode(strings.NewReader(input), "yaml")
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	p, err := file.Get("web-quick")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if p.Name != "web-quick" {
+		t.Errorf("Name = %q, want web-quick", p.Name)
+	}
+	if time.Duration(p.Timeouts.Connect) != 500*time.Millisecond {
+		t.Errorf("Timeouts.Connect = %v, want 500ms", time.Duration(p.Timeouts.Connect))
+	}
+	if p.RateLimit != 50 {
+		t.Errorf("RateLimit = %v, want 50", p.RateLimit)
+	}
+	if _, err := file.Get("missing"); err == nil {
+		t.Errorf("Get(missing) expected error")
+	}
+}
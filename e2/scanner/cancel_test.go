@@ -0,0 +1,93 @@
+package scanner_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e2/scanner"
+)
+
+// SlowDialer takes delay to connect to every port and honors cancellation of DialContext.
+type SlowDialer struct {
+	delay  time.Duration
+	dialed atomic.Int32
+}
+
+func (d *SlowDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+func (d *SlowDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.dialed.Add(1)
+	select {
+	case <-time.After(d.delay):
+		return &MockConn{}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestTCPScanner_RunTargets_Cancel(t *testing.T) {
+	tests := map[string]struct {
+		delay       time.Duration
+		gracePeriod time.Duration
+		wantOpen    bool
+	}{
+		"in-flight dials finish within the grace period": {
+			delay:       20 * time.Millisecond,
+			gracePeriod: time.Second,
+			wantOpen:    true,
+		},
+		"in-flight dials are aborted after the grace period": {
+			delay:       time.Minute,
+			gracePeriod: 10 * time.Millisecond,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dialer := &SlowDialer{delay: tt.delay}
+			tcpScanner, err := scanner.New(
+				scanner.WithWorkers(2),
+				scanner.WithDialer(dialer),
+				scanner.WithGracePeriod(tt.gracePeriod),
+			)
+			if err != nil {
+				t.Fatalf("failed to create scanner: %v", err)
+			}
+
+			ports := make([]int, 1000)
+			for i := range ports {
+				ports[i] = i + 1
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				time.Sleep(5 * time.Millisecond)
+				cancel()
+			}()
+
+			start := time.Now()
+			summary, err := tcpScanner.RunTargets(ctx, scanner.Targets(scanner.Target{Host: "127.0.0.1"}), ports)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("RunTargets() error = %v, want context.Canceled", err)
+			}
+			if elapsed := time.Since(start); elapsed > tt.gracePeriod+time.Second {
+				t.Errorf("RunTargets() took %s, want it bounded by the grace period", elapsed)
+			}
+			if !summary.Incomplete {
+				t.Errorf("Incomplete = false, want true")
+			}
+			if got := int(dialer.dialed.Load()); got >= len(ports) {
+				t.Errorf("dialed %d ports after cancellation, want fewer than %d", got, len(ports))
+			}
+			if (len(summary.Open) > 0) != tt.wantOpen {
+				t.Errorf("Open = %v, want open ports %v", summary.Open, tt.wantOpen)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package scanner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrExcluded is returned when a dial is refused because the target
+// matches an exclusion rule.
+var ErrExcluded = errors.New("target is excluded")
+
+// Exclusions is a set of rules describing hosts and ports that must never be dialed.
+//
+// A rule is one of:
+//   - a CIDR or a single IP address (10.0.0.0/8, 192.168.1.7)
+//   - a hostname (plc1.example.com), which also matches the addresses it resolves to
+//     when the rule is added
+//   - a port or port range that applies to every host (502, 8000-8100)
+//   - a host:port pair, where host may be an IP, CIDR or hostname
+//     and port may be a range (10.0.0.5:502, payments.internal:443, [::1]:22)
+//
+// Targets given by name are resolved so address rules apply to them too. A target that
+// can't be resolved is excluded by any rule on its port that matches addresses, since
+// there is no telling whether it would be.
+type Exclusions struct {
+	// LookupHost resolves hostnames, net.LookupHost if nil.
+	// Set it before adding rules, as hostname rules are resolved when added.
+	LookupHost func(host string) ([]string, error)
+
+	rules []exclusionRule
+
+	mu       sync.Mutex
+	resolved map[string][]net.IP
+}
+
+type exclusionRule struct {
+	raw      string
+	network  *net.IPNet
+	hostname string
+	ips      []net.IP // hostname resolved to
+	minPort  int
+	maxPort  int
+}
+
+// NewExclusions parses the given rules into a set of exclusions.
+func NewExclusions(rules ...string) (*Exclusions, error) {
+	ex := &Exclusions{}
+	for _, r := range rules {
+		if err := ex.Add(r); err != nil {
+			return nil, err
+		}
+	}
+	return ex, nil
+}
+
+// ReadExclusions parses one rule per line from rdr.
+// Blank lines and anything after a '#' are ignored.
+func (ex *Exclusions) ReadExclusions(rdr io.Reader) error {
+	scanner := bufio.NewScanner(rdr)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := ex.Add(line); err != nil {
+			return fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Add parses a single rule and adds it to the set.
+func (ex *Exclusions) Add(rule string) error {
+	rule = strings.TrimSpace(rule)
+	if rule == "" {
+		return errors.New("empty exclusion rule")
+	}
+
+	r := exclusionRule{raw: rule}
+
+	// port or port range on every host
+	if strings.Trim(rule, "0123456789-") == "" {
+		minPort, maxPort, err := parsePortRange(rule)
+		if err != nil {
+			return fmt.Errorf("invalid exclusion %q: %w", rule, err)
+		}
+		r.minPort, r.maxPort = minPort, maxPort
+		ex.rules = append(ex.rules, r)
+		return nil
+	}
+
+	hostPart := rule
+	if h, p, err := splitHostPortRule(rule); err == nil {
+		minPort, maxPort, err := parsePortRange(p)
+		if err != nil {
+			return fmt.Errorf("invalid exclusion %q: %w", rule, err)
+		}
+		hostPart = h
+		r.minPort, r.maxPort = minPort, maxPort
+	}
+
+	switch {
+	case strings.Contains(hostPart, "/"):
+		_, network, err := net.ParseCIDR(hostPart)
+		if err != nil {
+			return fmt.Errorf("invalid exclusion %q: %w", rule, err)
+		}
+		r.network = network
+	case net.ParseIP(hostPart) != nil:
+		ip := net.ParseIP(hostPart)
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		r.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	default:
+		r.hostname = normalizeHostname(hostPart)
+		if r.hostname == "" {
+			return fmt.Errorf("invalid exclusion %q", rule)
+		}
+		// a name that can't be resolved now is still matched by name
+		r.ips, _ = ex.resolve(r.hostname)
+	}
+
+	ex.rules = append(ex.rules, r)
+	return nil
+}
+
+// Len returns the number of rules in the set.
+func (ex *Exclusions) Len() int {
+	if ex == nil {
+		return 0
+	}
+	return len(ex.rules)
+}
+
+// Match reports the first rule excluding host:port, if any.
+func (ex *Exclusions) Match(host string, port int) (string, bool) {
+	if ex == nil {
+		return "", false
+	}
+
+	name := normalizeHostname(host)
+	var (
+		ips         []net.IP
+		resolvable  bool
+		ipsResolved bool
+	)
+	matchesIP := func(r exclusionRule) bool {
+		if !ipsResolved {
+			ips, resolvable = ex.resolve(host)
+			ipsResolved = true
+		}
+		for _, ip := range ips {
+			if r.network != nil && r.network.Contains(ip) {
+				return true
+			}
+			for _, ruleIP := range r.ips {
+				if ruleIP.Equal(ip) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for _, r := range ex.rules {
+		if r.maxPort != 0 && (port < r.minPort || port > r.maxPort) {
+			continue
+		}
+		switch {
+		case r.network != nil:
+			if matchesIP(r) {
+				return r.raw, true
+			}
+		case r.hostname != "":
+			if r.hostname == name || len(r.ips) > 0 && matchesIP(r) {
+				return r.raw, true
+			}
+		default:
+			return r.raw, true
+		}
+	}
+
+	// fail closed when the rules on addresses can't be checked
+	if ipsResolved && !resolvable {
+		for _, r := range ex.rules {
+			if r.maxPort != 0 && (port < r.minPort || port > r.maxPort) {
+				continue
+			}
+			if r.network != nil || len(r.ips) > 0 {
+				return r.raw + " (target could not be resolved)", true
+			}
+		}
+	}
+	return "", false
+}
+
+// resolve returns the IPs for host, and whether it resolved to any,
+// caching lookups so each name is resolved once.
+func (ex *Exclusions) resolve(host string) ([]net.IP, bool) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, true
+	}
+
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	if ips, ok := ex.resolved[host]; ok {
+		return ips, len(ips) > 0
+	}
+
+	lookupHost := ex.LookupHost
+	if lookupHost == nil {
+		lookupHost = net.LookupHost
+	}
+	var ips []net.IP
+	addrs, _ := lookupHost(host)
+	for _, a := range addrs {
+		if ip := net.ParseIP(a); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+
+	if ex.resolved == nil {
+		ex.resolved = make(map[string][]net.IP)
+	}
+	ex.resolved[host] = ips
+	return ips, len(ips) > 0
+}
+
+// splitHostPortRule splits host:port rules, leaving bare IPv6 addresses and CIDRs alone.
+func splitHostPortRule(rule string) (string, string, error) {
+	if strings.HasPrefix(rule, "[") {
+		return net.SplitHostPort(rule)
+	}
+	if strings.Count(rule, ":") != 1 {
+		return "", "", errors.New("not a host:port pair")
+	}
+	i := strings.LastIndexByte(rule, ':')
+	return rule[:i], rule[i+1:], nil
+}
+
+func parsePortRange(s string) (int, int, error) {
+	minStr, maxStr, isRange := strings.Cut(s, "-")
+	minPort, err := parsePort(minStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return minPort, minPort, nil
+	}
+	maxPort, err := parsePort(maxStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if minPort > maxPort {
+		return 0, 0, fmt.Errorf("invalid port range %s", s)
+	}
+	return minPort, maxPort, nil
+}
+
+func parsePort(s string) (int, error) {
+	p, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert %s to a valid port number", s)
+	}
+	if p <= 0 || p > 65535 {
+		return 0, fmt.Errorf("port %d out of range", p)
+	}
+	return p, nil
+}
+
+func normalizeHostname(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
@@ -0,0 +1,176 @@
+package scanner_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/idiomat/dodtnyt/e2/scanner"
+)
+
+// newExclusions returns exclusions resolving names with hosts only, so tests don't depend on DNS.
+func newExclusions(t *testing.T, hosts map[string][]string, rules ...string) *scanner.Exclusions {
+	t.Helper()
+	ex := &scanner.Exclusions{
+		LookupHost: func(host string) ([]string, error) {
+			if addrs, ok := hosts[host]; ok {
+				return addrs, nil
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		},
+	}
+	for _, r := range rules {
+		if err := ex.Add(r); err != nil {
+			t.Fatalf("Add(%q) error = %v", r, err)
+		}
+	}
+	return ex
+}
+
+func TestExclusions_Match(t *testing.T) {
+	ex := newExclusions(t, map[string][]string{"plc1.example.com": {"192.168.5.5"}},
+		"10.0.0.0/8",
+		"192.168.1.7",
+		"PLC1.example.com.",
+		"502",
+		"8000-8100",
+		"172.16.0.5:22",
+		"payments.internal:443-444",
+		"[::1]:25",
+	)
+
+	tests := map[string]struct {
+		host     string
+		port     int
+		wantRule string
+	}{
+		"cidr":                   {host: "10.1.2.3", port: 80, wantRule: "10.0.0.0/8"},
+		"single ip":              {host: "192.168.1.7", port: 80, wantRule: "192.168.1.7"},
+		"neighbouring ip":        {host: "192.168.1.8", port: 80},
+		"hostname":               {host: "plc1.example.com", port: 80, wantRule: "PLC1.example.com."},
+		"ip of hostname":         {host: "192.168.5.5", port: 80, wantRule: "PLC1.example.com."},
+		"port on any host":       {host: "192.168.1.8", port: 502, wantRule: "502"},
+		"port range":             {host: "192.168.1.8", port: 8050, wantRule: "8000-8100"},
+		"host port pair":         {host: "172.16.0.5", port: 22, wantRule: "172.16.0.5:22"},
+		"host other port":        {host: "172.16.0.5", port: 23},
+		"hostname port range":    {host: "payments.internal", port: 444, wantRule: "payments.internal:443-444"},
+		"unresolvable hostname":  {host: "payments.internal", port: 80, wantRule: "10.0.0.0/8 (target could not be resolved)"},
+		"ipv6 host port pair":    {host: "::1", port: 25, wantRule: "[::1]:25"},
+		"ipv6 host another port": {host: "::1", port: 26},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rule, ok := ex.Match(tt.host, tt.port)
+			if ok != (tt.wantRule != "") || rule != tt.wantRule {
+				t.Errorf("Match(%s, %d) = %q, %v, want %q", tt.host, tt.port, rule, ok, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestExclusions_MatchResolved(t *testing.T) {
+	ex := newExclusions(t, map[string][]string{"localhost": {"127.0.0.1", "::1"}}, "localhost:8443", "10.0.0.0/8:22")
+
+	tests := map[string]struct {
+		host     string
+		port     int
+		wantRule string
+	}{
+		"ip of excluded hostname":       {host: "127.0.0.1", port: 8443, wantRule: "localhost:8443"},
+		"ip of hostname on other port":  {host: "127.0.0.1", port: 80},
+		"resolvable hostname":           {host: "localhost", port: 22},
+		"unresolvable hostname":         {host: "plc1.invalid", port: 22, wantRule: "10.0.0.0/8:22 (target could not be resolved)"},
+		"unresolvable hostname by name": {host: "plc1.invalid", port: 8443, wantRule: "localhost:8443 (target could not be resolved)"},
+		"unresolvable without rules":    {host: "plc1.invalid", port: 80},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rule, ok := ex.Match(tt.host, tt.port)
+			if ok != (tt.wantRule != "") || rule != tt.wantRule {
+				t.Errorf("Match(%s, %d) = %q, %v, want %q", tt.host, tt.port, rule, ok, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestExclusions_ReadExclusions(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		wantLen int
+		wantErr bool
+	}{
+		"comments and blank lines": {
+			input:   "# fragile PLCs\n10.0.0.0/8\n\n  plc1.example.com # line 3\n",
+			wantLen: 2,
+		},
+		"invalid cidr": {
+			input:   "10.0.0.0/99\n",
+			wantErr: true,
+		},
+		"invalid port": {
+			input:   "10.0.0.5:http\n",
+			wantErr: true,
+		},
+		"inverted port range": {
+			input:   "100-10\n",
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ex, _ := scanner.NewExclusions()
+			err := ex.ReadExclusions(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadExclusions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && ex.Len() != tt.wantLen {
+				t.Errorf("Len() = %d, want %d", ex.Len(), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestTCPScanner_Run_Exclusions(t *testing.T) {
+	mockDialer := &MockDialer{
+		openPorts: map[int]bool{80: true, 443: true, 502: true},
+	}
+	ex, err := scanner.NewExclusions("502", "127.0.0.1:443")
+	if err != nil {
+		t.Fatalf("NewExclusions() error = %v", err)
+	}
+
+	tcpScanner, err := scanner.New(
+		scanner.WithHost("127.0.0.1"),
+		scanner.WithWorkers(2),
+		scanner.WithDialer(mockDialer),
+		scanner.WithExclusions(ex),
+	)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	summary, err := tcpScanner.Run([]int{80, 443, 502})
+	if err != nil {
+		t.Fatalf("TCPScanner.Run() error = %v", err)
+	}
+
+	if len(summary.Open) != 1 || summary.Open[0].Port != 80 {
+		t.Errorf("Open = %v, want only port 80", summary.Open)
+	}
+	if len(summary.Skipped) != 2 {
+		t.Fatalf("Skipped = %v, want 2 entries", summary.Skipped)
+	}
+	for _, sk := range summary.Skipped {
+		if sk.Rule == "" {
+			t.Errorf("Skipped %v has no rule", sk)
+		}
+	}
+	for _, addr := range mockDialer.dialed() {
+		if addr != "127.0.0.1:80" {
+			t.Errorf("excluded address %s was dialed", addr)
+		}
+	}
+}
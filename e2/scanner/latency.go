@@ -0,0 +1,118 @@
+package scanner
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// OutlierThreshold is how many median absolute deviations above the median
+// a port's connect time must be before it is reported as slow.
+const OutlierThreshold = 5.0
+
+// minOutlierSamples is the fewest open ports on a host for outliers to mean anything.
+const minOutlierSamples = 4
+
+// LatencyReport aggregates the connect times of a host's open ports.
+// Durations are in nanoseconds in the structured output.
+type LatencyReport struct {
+	Host  string        `json:"host"`
+	Count int           `json:"count"`
+	Min   time.Duration `json:"min_ns"`
+	Max   time.Duration `json:"max_ns"`
+	Mean  time.Duration `json:"mean_ns"`
+	P50   time.Duration `json:"p50_ns"`
+	P95   time.Duration `json:"p95_ns"`
+	P99   time.Duration `json:"p99_ns"`
+	Slow  []SlowPort    `json:"slow,omitempty"`
+}
+
+// SlowPort is an open port whose connect time was anomalously high for its host.
+type SlowPort struct {
+	Port    int           `json:"port"`
+	Latency time.Duration `json:"latency_ns"`
+}
+
+// LatencyReports builds one report per host from the open ports, ordered by host.
+func LatencyReports(open []OpenPort) []LatencyReport {
+	byHost := make(map[string][]OpenPort)
+	for _, o := range open {
+		byHost[o.Host] = append(byHost[o.Host], o)
+	}
+
+	hosts := make([]string, 0, len(byHost))
+	for h := range byHost {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+
+	reports := make([]LatencyReport, 0, len(hosts))
+	for _, h := range hosts {
+		reports = append(reports, latencyReport(h, byHost[h]))
+	}
+	return reports
+}
+
+func latencyReport(host string, open []OpenPort) LatencyReport {
+	sorted := make([]OpenPort, len(open))
+	copy(sorted, open)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Latency < sorted[j].Latency })
+
+	latencies := make([]time.Duration, len(sorted))
+	var total time.Duration
+	for i, o := range sorted {
+		latencies[i] = o.Latency
+		total += o.Latency
+	}
+
+	r := LatencyReport{
+		Host:  host,
+		Count: len(latencies),
+		Min:   latencies[0],
+		Max:   latencies[len(latencies)-1],
+		Mean:  total / time.Duration(len(latencies)),
+		P50:   percentile(latencies, 50),
+		P95:   percentile(latencies, 95),
+		P99:   percentile(latencies, 99),
+	}
+
+	if len(latencies) < minOutlierSamples {
+		return r
+	}
+
+	// The median absolute deviation isn't dragged up by the outliers
+	// themselves the way a standard deviation would be.
+	deviations := make([]time.Duration, len(latencies))
+	for i, l := range latencies {
+		deviations[i] = absDuration(l - r.P50)
+	}
+	sort.Slice(deviations, func(i, j int) bool { return deviations[i] < deviations[j] })
+	mad := percentile(deviations, 50)
+	if mad == 0 {
+		return r
+	}
+
+	limit := r.P50 + time.Duration(OutlierThreshold*float64(mad))
+	for _, o := range sorted {
+		if o.Latency > limit {
+			r.Slow = append(r.Slow, SlowPort{Port: o.Port, Latency: o.Latency})
+		}
+	}
+	return r
+}
+
+// percentile returns the nearest-rank percentile p of sorted.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,59 @@
+package scanner_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e2/scanner"
+)
+
+func TestLatencyReports(t *testing.T) {
+	open := func(host string, port int, ms int) scanner.OpenPort {
+		return scanner.OpenPort{
+			Endpoint: scanner.Endpoint{Host: host, Port: port},
+			Latency:  time.Duration(ms) * time.Millisecond,
+		}
+	}
+
+	reports := scanner.LatencyReports([]scanner.OpenPort{
+		open("b.example", 22, 10),
+		open("a.example", 80, 10),
+		open("a.example", 81, 11),
+		open("a.example", 82, 9),
+		open("a.example", 83, 12),
+		open("a.example", 84, 10),
+		open("a.example", 85, 400),
+	})
+
+	if len(reports) != 2 {
+		t.Fatalf("LatencyReports() returned %d reports, want 2", len(reports))
+	}
+
+	a := reports[0]
+	if a.Host != "a.example" {
+		t.Fatalf("reports[0].Host = %s, want a.example", a.Host)
+	}
+	if a.Count != 6 {
+		t.Errorf("Count = %d, want 6", a.Count)
+	}
+	if a.Min != 9*time.Millisecond || a.Max != 400*time.Millisecond {
+		t.Errorf("Min, Max = %s, %s, want 9ms, 400ms", a.Min, a.Max)
+	}
+	if a.Mean != 452*time.Millisecond/6 {
+		t.Errorf("Mean = %s, want %s", a.Mean, 452*time.Millisecond/6)
+	}
+	if a.P50 != 10*time.Millisecond {
+		t.Errorf("P50 = %s, want 10ms", a.P50)
+	}
+	if a.P95 != 400*time.Millisecond || a.P99 != 400*time.Millisecond {
+		t.Errorf("P95, P99 = %s, %s, want 400ms", a.P95, a.P99)
+	}
+	if len(a.Slow) != 1 || a.Slow[0].Port != 85 {
+		t.Errorf("Slow = %v, want port 85", a.Slow)
+	}
+
+	b := reports[1]
+	if b.Count != 1 || b.P99 != 10*time.Millisecond || len(b.Slow) != 0 {
+		t.Errorf("reports[1] = %+v, want a single 10ms sample and no slow ports", b)
+	}
+}
@@ -0,0 +1,189 @@
+package scanner
+
+import (
+	"io"
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+// Option configures a TCPScanner built with New.
+type Option func(*TCPScanner)
+
+// Result is the outcome of scanning a single endpoint, as passed to result hooks.
+type Result struct {
+	Endpoint
+	Open       bool
+	Latency    time.Duration
+	Probe      string
+	Banner     string
+	ExcludedBy string
+	Err        string
+}
+
+// Metrics receives counters from a scan. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// DialCompleted is called once per dialed endpoint, after any retries.
+	DialCompleted(open bool, latency time.Duration)
+	// DialRetried is called every time a dial is retried.
+	DialRetried()
+	// EndpointSkipped is called for every endpoint matching an exclusion rule.
+	EndpointSkipped()
+}
+
+// Strategy decides the order in which a target's ports are scanned.
+type Strategy interface {
+	Order(ports []int) []int
+}
+
+// SequentialStrategy scans ports in the order they were given.
+type SequentialStrategy struct{}
+
+func (SequentialStrategy) Order(ports []int) []int {
+	return ports
+}
+
+// RandomStrategy scans ports in a random order, which spreads the load
+// on a host and is less conspicuous to simple port scan detection.
+type RandomStrategy struct {
+	Rand *rand.Rand
+}
+
+func (r RandomStrategy) Order(ports []int) []int {
+	shuffled := make([]int, len(ports))
+	copy(shuffled, ports)
+	shuffle := rand.Shuffle
+	if r.Rand != nil {
+		shuffle = r.Rand.Shuffle
+	}
+	shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	return shuffled
+}
+
+// New returns a TCPScanner configured by opts.
+// Without options it scans with DefaultNumWorkers workers using a *net.Dialer.
+func New(opts ...Option) (*TCPScanner, error) {
+	s := &TCPScanner{
+		workers:     DefaultNumWorkers,
+		dialer:      defaultDialer(),
+		gracePeriod: DefaultGracePeriod,
+		strategy:    SequentialStrategy{},
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		metrics:     noopMetrics{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, s.validate()
+}
+
+// WithHost sets the host scanned by Scan and Run.
+func WithHost(host string) Option {
+	return func(s *TCPScanner) {
+		s.host = host
+	}
+}
+
+// WithWorkers sets the number of concurrent dials.
+func WithWorkers(workers int) Option {
+	return func(s *TCPScanner) {
+		s.workers = workers
+	}
+}
+
+// WithDialer sets the dialer used to open connections.
+func WithDialer(dialer Dialer) Option {
+	return func(s *TCPScanner) {
+		s.dialer = dialer
+	}
+}
+
+// WithTimeout bounds each connect attempt. It requires a ContextDialer.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *TCPScanner) {
+		s.timeout = timeout
+	}
+}
+
+// WithGracePeriod sets how long in-flight dials may finish once a scan is cancelled
+// before they are aborted. Aborting requires a ContextDialer.
+func WithGracePeriod(d time.Duration) Option {
+	return func(s *TCPScanner) {
+		s.gracePeriod = d
+	}
+}
+
+// MaxRateLimit is the highest rate limit, a dial every nanosecond.
+const MaxRateLimit = float64(time.Second)
+
+// WithRateLimit caps the number of dials per second across all workers.
+// A rate of zero means no limit.
+func WithRateLimit(perSecond float64) Option {
+	return func(s *TCPScanner) {
+		s.rateLimit = perSecond
+	}
+}
+
+// WithRetries retries dials that time out up to retries times, doubling backoff between attempts.
+// A refused connection is an answer, not a failure, so it is never retried.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(s *TCPScanner) {
+		s.retries = retries
+		s.retryBackoff = backoff
+	}
+}
+
+// WithExclusions sets the rules for hosts and ports the scanner must never dial.
+func WithExclusions(ex *Exclusions) Option {
+	return func(s *TCPScanner) {
+		s.exclusions = ex
+	}
+}
+
+// WithProbes sets the probes run, in order, against every open port.
+// The first probe that gets a response supplies the banner.
+// A timeout of zero means DefaultProbeTimeout.
+func WithProbes(timeout time.Duration, probes ...Probe) Option {
+	return func(s *TCPScanner) {
+		if timeout == 0 {
+			timeout = DefaultProbeTimeout
+		}
+		s.probeTimeout = timeout
+		s.probes = probes
+	}
+}
+
+// WithResultHook registers a function called with the result of every scanned endpoint.
+// Hooks are called one at a time, in the order results arrive.
+func WithResultHook(hook func(Result)) Option {
+	return func(s *TCPScanner) {
+		s.hooks = append(s.hooks, hook)
+	}
+}
+
+// WithLogger sets the logger for scan progress and dial errors.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *TCPScanner) {
+		s.logger = logger
+	}
+}
+
+// WithMetrics sets the receiver of scan counters.
+func WithMetrics(m Metrics) Option {
+	return func(s *TCPScanner) {
+		s.metrics = m
+	}
+}
+
+// WithStrategy sets the order in which ports are scanned.
+func WithStrategy(strategy Strategy) Option {
+	return func(s *TCPScanner) {
+		s.strategy = strategy
+	}
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) DialCompleted(bool, time.Duration) {}
+func (noopMetrics) DialRetried()                      {}
+func (noopMetrics) EndpointSkipped()                  {}
@@ -0,0 +1,234 @@
+package scanner_test
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/idiomat/dodtnyt/e2/scanner"
+)
+
+func TestNew(t *testing.T) {
+	tests := map[string]struct {
+		opts    []scanner.Option
+		wantErr bool
+	}{
+		"defaults": {},
+		"all options": {
+			opts: []scanner.Option{
+				scanner.WithHost("127.0.0.1"),
+				scanner.WithWorkers(4),
+				scanner.WithDialer(&SlowDialer{}),
+				scanner.WithTimeout(time.Second),
+				scanner.WithGracePeriod(time.Second),
+				scanner.WithRateLimit(100),
+				scanner.WithRetries(2, 10*time.Millisecond),
+				scanner.WithProbes(0, scanner.Probes["banner"]),
+				scanner.WithResultHook(func(scanner.Result) {}),
+				scanner.WithMetrics(&countingMetrics{}),
+				scanner.WithStrategy(scanner.RandomStrategy{}),
+			},
+		},
+		"invalid number of workers": {
+			opts:    []scanner.Option{scanner.WithWorkers(0)},
+			wantErr: true,
+		},
+		"nil dialer": {
+			opts:    []scanner.Option{scanner.WithDialer(nil)},
+			wantErr: true,
+		},
+		"timeout without a context dialer": {
+			opts:    []scanner.Option{scanner.WithDialer(&MockDialer{}), scanner.WithTimeout(time.Second)},
+			wantErr: true,
+		},
+		"retries without a timeout": {
+			opts:    []scanner.Option{scanner.WithRetries(2, time.Millisecond)},
+			wantErr: true,
+		},
+		"negative rate limit": {
+			opts:    []scanner.Option{scanner.WithRateLimit(-1)},
+			wantErr: true,
+		},
+		"rate limit above a dial per nanosecond": {
+			opts:    []scanner.Option{scanner.WithRateLimit(2e9)},
+			wantErr: true,
+		},
+		"NaN rate limit": {
+			opts:    []scanner.Option{scanner.WithRateLimit(math.NaN())},
+			wantErr: true,
+		},
+		"negative grace period": {
+			opts:    []scanner.Option{scanner.WithGracePeriod(-time.Second)},
+			wantErr: true,
+		},
+		"negative probe timeout": {
+			opts:    []scanner.Option{scanner.WithProbes(-time.Second, scanner.Probes["http"])},
+			wantErr: true,
+		},
+		"nil result hook": {
+			opts:    []scanner.Option{scanner.WithResultHook(nil)},
+			wantErr: true,
+		},
+		"nil strategy": {
+			opts:    []scanner.Option{scanner.WithStrategy(nil)},
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := scanner.New(tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// countingMetrics counts what the scanner reports.
+type countingMetrics struct {
+	completed atomic.Int32
+	open      atomic.Int32
+	retried   atomic.Int32
+	skipped   atomic.Int32
+}
+
+func (m *countingMetrics) DialCompleted(open bool, latency time.Duration) {
+	m.completed.Add(1)
+	if open {
+		m.open.Add(1)
+	}
+}
+
+func (m *countingMetrics) DialRetried()     { m.retried.Add(1) }
+func (m *countingMetrics) EndpointSkipped() { m.skipped.Add(1) }
+
+// FlakyDialer times out on the first failures dials to every address, then connects.
+type FlakyDialer struct {
+	failures int
+
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func (d *FlakyDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+func (d *FlakyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.mu.Lock()
+	if d.attempts == nil {
+		d.attempts = make(map[string]int)
+	}
+	d.attempts[address]++
+	n := d.attempts[address]
+	d.mu.Unlock()
+
+	if n <= d.failures {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &MockConn{}, nil
+}
+
+func TestTCPScanner_Retries(t *testing.T) {
+	tests := map[string]struct {
+		failures int
+		retries  int
+		wantOpen bool
+	}{
+		"recovers within retries": {failures: 2, retries: 2, wantOpen: true},
+		"gives up after retries":  {failures: 3, retries: 2, wantOpen: false},
+		"no retries":              {failures: 1, retries: 0, wantOpen: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			metrics := &countingMetrics{}
+			tcpScanner, err := scanner.New(
+				scanner.WithHost("127.0.0.1"),
+				scanner.WithDialer(&FlakyDialer{failures: tt.failures}),
+				scanner.WithTimeout(5*time.Millisecond),
+				scanner.WithRetries(tt.retries, time.Millisecond),
+				scanner.WithMetrics(metrics),
+			)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			openPorts, err := tcpScanner.Scan([]int{22})
+			if err != nil {
+				t.Fatalf("TCPScanner.Scan() error = %v", err)
+			}
+			if (len(openPorts) == 1) != tt.wantOpen {
+				t.Errorf("TCPScanner.Scan() = %v, want open %v", openPorts, tt.wantOpen)
+			}
+
+			wantRetries := tt.retries
+			if tt.failures < tt.retries {
+				wantRetries = tt.failures
+			}
+			if got := int(metrics.retried.Load()); got != wantRetries {
+				t.Errorf("retries = %d, want %d", got, wantRetries)
+			}
+			if got := metrics.completed.Load(); got != 1 {
+				t.Errorf("completed dials = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestTCPScanner_ResultHooksAndMetrics(t *testing.T) {
+	ex, err := scanner.NewExclusions("502")
+	if err != nil {
+		t.Fatalf("NewExclusions() error = %v", err)
+	}
+
+	var results []scanner.Result
+	metrics := &countingMetrics{}
+	tcpScanner, err := scanner.New(
+		scanner.WithHost("127.0.0.1"),
+		scanner.WithDialer(&MockDialer{openPorts: map[int]bool{80: true}}),
+		scanner.WithRateLimit(1000),
+		scanner.WithExclusions(ex),
+		scanner.WithResultHook(func(r scanner.Result) { results = append(results, r) }),
+		scanner.WithMetrics(metrics),
+		scanner.WithStrategy(scanner.RandomStrategy{Rand: rand.New(rand.NewSource(1))}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if _, err := tcpScanner.Scan([]int{80, 81, 502}); err != nil {
+		t.Fatalf("TCPScanner.Scan() error = %v", err)
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Port < results[j].Port })
+	if len(results) != 3 {
+		t.Fatalf("hook got %d results, want 3", len(results))
+	}
+	if !results[0].Open || results[1].Open || results[1].Err == "" || results[2].ExcludedBy != "502" {
+		t.Errorf("results = %+v, want 80 open, 81 closed with an error, 502 excluded", results)
+	}
+	if metrics.completed.Load() != 2 || metrics.open.Load() != 1 || metrics.skipped.Load() != 1 {
+		t.Errorf("metrics = %d completed, %d open, %d skipped, want 2, 1, 1",
+			metrics.completed.Load(), metrics.open.Load(), metrics.skipped.Load())
+	}
+}
+
+func TestRandomStrategy(t *testing.T) {
+	ports := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	ordered := scanner.RandomStrategy{Rand: rand.New(rand.NewSource(1))}.Order(ports)
+	if !equal(ordered, ports) {
+		t.Errorf("Order() = %v, want a permutation of %v", ordered, ports)
+	}
+	if ports[0] != 1 || ports[9] != 10 {
+		t.Errorf("Order() modified its input: %v", ports)
+	}
+}
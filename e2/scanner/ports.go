@@ -0,0 +1,32 @@
+package scanner
+
+import (
+	"errors"
+	"strings"
+)
+
+// ParsePorts parses a comma-separated list of ports and port ranges (e.g. 80, 22-100, 22,80,8000-8100).
+func ParsePorts(spec string) ([]int, error) {
+	var ports []int
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		minPort, maxPort, err := parsePortRange(part)
+		if err != nil {
+			return nil, err
+		}
+		for p := minPort; p <= maxPort; p++ {
+			if !seen[p] {
+				seen[p] = true
+				ports = append(ports, p)
+			}
+		}
+	}
+	if len(ports) == 0 {
+		return nil, errors.New("unable to determine port(s) to scan")
+	}
+	return ports, nil
+}
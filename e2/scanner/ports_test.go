@@ -0,0 +1,38 @@
+package scanner_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/idiomat/dodtnyt/e2/scanner"
+)
+
+func TestParsePorts(t *testing.T) {
+	tests := map[string]struct {
+		spec    string
+		want    []int
+		wantErr bool
+	}{
+		"single port":   {spec: "80", want: []int{80}},
+		"range":         {spec: "22-25", want: []int{22, 23, 24, 25}},
+		"list":          {spec: "22, 80,443", want: []int{22, 80, 443}},
+		"overlapping":   {spec: "80-82,81", want: []int{80, 81, 82}},
+		"not a number":  {spec: "http", wantErr: true},
+		"zero":          {spec: "0", wantErr: true},
+		"too large":     {spec: "65536", wantErr: true},
+		"reverse range": {spec: "25-22", wantErr: true},
+		"empty":         {spec: "", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := scanner.ParsePorts(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePorts(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePorts(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
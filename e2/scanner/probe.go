@@ -0,0 +1,58 @@
+package scanner
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultProbeTimeout bounds how long a probe waits for a response.
+const DefaultProbeTimeout = 2 * time.Second
+
+// maxBannerSize caps how much of a response is kept as a banner.
+const maxBannerSize = 512
+
+// Probe is a payload written to an open port to elicit a banner.
+// A probe without a payload only listens for what the service sends first.
+type Probe struct {
+	Name    string
+	Payload []byte
+}
+
+// Probes are the built-in probes, keyed by name.
+var Probes = map[string]Probe{
+	"banner": {Name: "banner"},
+	"http":   {Name: "http", Payload: []byte("HEAD / HTTP/1.0\r\n\r\n")},
+	"tls":    {Name: "tls", Payload: []byte{0x16, 0x03, 0x01, 0x00, 0x00}},
+}
+
+// ProbeNames returns the names of the built-in probes in sorted order.
+func ProbeNames() []string {
+	var names []string
+	for name := range Probes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// probe runs the configured probes over conn and returns the first banner received.
+func (s *TCPScanner) probe(conn net.Conn) (string, string) {
+	buf := make([]byte, maxBannerSize)
+	for _, p := range s.probes {
+		if err := conn.SetDeadline(time.Now().Add(s.probeTimeout)); err != nil {
+			return "", ""
+		}
+		if len(p.Payload) > 0 {
+			if _, err := conn.Write(p.Payload); err != nil {
+				return "", ""
+			}
+		}
+		n, _ := conn.Read(buf)
+		if n > 0 {
+			return p.Name, strings.TrimSpace(string(buf[:n]))
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,82 @@
+package scanner_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/idiomat/dodtnyt/e2/scanner"
+)
+
+// BannerDialer returns connections that answer every read with a fixed banner.
+type BannerDialer struct {
+	banner string
+}
+
+func (d *BannerDialer) Dial(network, address string) (net.Conn, error) {
+	return &BannerConn{banner: d.banner}, nil
+}
+
+type BannerConn struct {
+	MockConn
+	banner  string
+	written []byte
+}
+
+func (c *BannerConn) Read(b []byte) (int, error) {
+	if c.banner == "" {
+		return 0, nil
+	}
+	return copy(b, c.banner), nil
+}
+
+func (c *BannerConn) Write(b []byte) (int, error) {
+	c.written = append(c.written, b...)
+	return len(b), nil
+}
+
+func TestTCPScanner_Run_Probes(t *testing.T) {
+	tests := map[string]struct {
+		banner     string
+		probes     []scanner.Probe
+		wantProbe  string
+		wantBanner string
+	}{
+		"banner probe": {
+			banner:     "SSH-2.0-OpenSSH_9.6\r\n",
+			probes:     []scanner.Probe{scanner.Probes["banner"]},
+			wantProbe:  "banner",
+			wantBanner: "SSH-2.0-OpenSSH_9.6",
+		},
+		"silent service": {
+			probes: []scanner.Probe{scanner.Probes["banner"], scanner.Probes["http"]},
+		},
+		"no probes": {
+			banner: "SSH-2.0-OpenSSH_9.6\r\n",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tcpScanner, err := scanner.New(
+				scanner.WithHost("127.0.0.1"),
+				scanner.WithWorkers(1),
+				scanner.WithDialer(&BannerDialer{banner: tt.banner}),
+				scanner.WithProbes(0, tt.probes...),
+			)
+			if err != nil {
+				t.Fatalf("failed to create scanner: %v", err)
+			}
+
+			summary, err := tcpScanner.Run([]int{22})
+			if err != nil {
+				t.Fatalf("TCPScanner.Run() error = %v", err)
+			}
+			if len(summary.Open) != 1 {
+				t.Fatalf("Open = %v, want 1 entry", summary.Open)
+			}
+			if got := summary.Open[0]; got.Probe != tt.wantProbe || got.Banner != tt.wantBanner {
+				t.Errorf("Open[0] = %s %q, want %s %q", got.Probe, got.Banner, tt.wantProbe, tt.wantBanner)
+			}
+		})
+	}
+}
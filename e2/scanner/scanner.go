@@ -1,9 +1,14 @@
 package scanner
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,12 +18,34 @@ type Dialer interface {
 	Dial(network, address string) (net.Conn, error)
 }
 
+// ContextDialer is a Dialer whose dials can be aborted, such as *net.Dialer.
+// The scanner uses DialContext when available so a cancelled scan
+// doesn't have to wait out connect timeouts.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
 var DefaultNumWorkers = runtime.NumCPU()
 
+// DefaultGracePeriod is how long in-flight dials may finish after a scan is cancelled.
+const DefaultGracePeriod = 2 * time.Second
+
 type TCPScanner struct {
-	host    string
-	workers int
-	dialer  Dialer
+	host         string
+	workers      int
+	dialer       Dialer
+	timeout      time.Duration
+	gracePeriod  time.Duration
+	rateLimit    float64
+	retries      int
+	retryBackoff time.Duration
+	exclusions   *Exclusions
+	probes       []Probe
+	probeTimeout time.Duration
+	hooks        []func(Result)
+	logger       *slog.Logger
+	metrics      Metrics
+	strategy     Strategy
 }
 
 func (s *TCPScanner) validate() error {
@@ -28,34 +55,193 @@ func (s *TCPScanner) validate() error {
 	if s.dialer == nil {
 		return fmt.Errorf("dialer is required")
 	}
+	if s.timeout < 0 {
+		return fmt.Errorf("invalid timeout: %s", s.timeout)
+	}
+	if _, ok := s.dialer.(ContextDialer); s.timeout > 0 && !ok {
+		return errors.New("timeout requires a dialer that implements ContextDialer")
+	}
+	if s.gracePeriod < 0 {
+		return fmt.Errorf("invalid grace period: %s", s.gracePeriod)
+	}
+	// also rejects NaN, and rates whose interval between dials would round down to zero
+	if !(s.rateLimit >= 0 && s.rateLimit <= MaxRateLimit) {
+		return fmt.Errorf("invalid rate limit: %v", s.rateLimit)
+	}
+	if s.retries < 0 {
+		return fmt.Errorf("invalid number of retries: %d", s.retries)
+	}
+	if s.retries > 0 && s.timeout == 0 {
+		// without a timeout a dial never fails in a way worth retrying
+		return errors.New("retries require a timeout")
+	}
+	if s.retryBackoff < 0 {
+		return fmt.Errorf("invalid retry backoff: %s", s.retryBackoff)
+	}
+	if len(s.probes) > 0 && s.probeTimeout <= 0 {
+		return fmt.Errorf("invalid probe timeout: %s", s.probeTimeout)
+	}
+	for i, hook := range s.hooks {
+		if hook == nil {
+			return fmt.Errorf("result hook %d is nil", i)
+		}
+	}
+	if s.logger == nil {
+		return errors.New("logger is required")
+	}
+	if s.metrics == nil {
+		return errors.New("metrics are required")
+	}
+	if s.strategy == nil {
+		return errors.New("strategy is required")
+	}
 	return nil
 }
 
+// NewTCPScanner returns a scanner for host. It is shorthand for
+// New(WithHost(host), WithWorkers(workers), WithDialer(dialer)).
 func NewTCPScanner(host string, workers int, dialer Dialer) (*TCPScanner, error) {
-	s := &TCPScanner{host: host, workers: workers, dialer: dialer}
-	return s, s.validate()
+	return New(WithHost(host), WithWorkers(workers), WithDialer(dialer))
+}
+
+func defaultDialer() Dialer {
+	return &net.Dialer{}
+}
+
+// Endpoint is a host and port pair.
+type Endpoint struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+// Skipped is an endpoint that was not dialed because it matched an exclusion rule.
+type Skipped struct {
+	Endpoint
+	Rule string `json:"rule"`
 }
 
+// OpenPort is an endpoint that accepted a connection,
+// along with the banner returned by the first probe that got a response.
+type OpenPort struct {
+	Endpoint
+	Latency time.Duration `json:"latency_ns"`
+	Probe   string        `json:"probe,omitempty"`
+	Banner  string        `json:"banner,omitempty"`
+}
+
+// Summary describes the outcome of a scan run.
+// Incomplete is set when the run stopped before every target was scanned.
+type Summary struct {
+	Incomplete bool            `json:"incomplete,omitempty"`
+	Hosts      []string        `json:"hosts,omitempty"` // every host scanned, open ports or not, in the order first seen
+	Open       []OpenPort      `json:"open"`
+	Skipped    []Skipped       `json:"skipped,omitempty"`
+	Latency    []LatencyReport `json:"latency,omitempty"`
+}
+
+// Scan scans the specified ports and returns the ones that are open.
 func (s *TCPScanner) Scan(ports []int) ([]int, error) {
+	summary, err := s.Run(ports)
+	if err != nil {
+		return nil, err
+	}
+
+	var openPorts []int
+	for _, o := range summary.Open {
+		openPorts = append(openPorts, o.Port)
+	}
+	return openPorts, nil
+}
+
+// Run scans the specified ports on the scanner's host and summarizes what was open and what was skipped.
+func (s *TCPScanner) Run(ports []int) (*Summary, error) {
+	return s.RunTargets(context.Background(), Targets(Target{Host: s.host}), ports)
+}
+
+// RunTargets scans every target from src, pulling targets only as workers are ready for them.
+// Targets without their own ports are scanned on the given ports.
+//
+// When ctx is cancelled no new dials are started, dials in flight get the grace period to finish,
+// and the summary of what was scanned so far is returned, marked incomplete, along with ctx.Err().
+// The same goes if src fails, with its error.
+func (s *TCPScanner) RunTargets(ctx context.Context, src TargetSource, ports []int) (*Summary, error) {
+	if src == nil {
+		return nil, errNoTargets
+	}
+
 	// The done channel will be shared by the entire pipeline
 	// so that when it's closed it serves as a signal
 	// for all the goroutines we started to exit.
 	done := make(chan struct{})
 	defer close(done)
 
-	in := s.gen(done, ports...)
+	// Dials outlive ctx by the grace period, after which they are aborted.
+	dialCtx, cancelDials := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelDials()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		grace := time.NewTimer(s.gracePeriod)
+		defer grace.Stop()
+		select {
+		case <-grace.C:
+			cancelDials()
+		case <-done:
+		}
+	}()
+
+	errc := make(chan error, 1)
+	in := s.gen(ctx, done, errc, src, ports)
+
+	var tick <-chan time.Time
+	s.logger.Info("scan started", "workers", s.workers)
+	defer func(start time.Time) {
+		s.logger.Info("scan finished", "elapsed", time.Since(start))
+	}(time.Now())
+
+	if s.rateLimit > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / s.rateLimit))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
 
 	// fan-out
 	var chans []<-chan scanOp
 	for i := 0; i < s.workers; i++ {
-		chans = append(chans, s.scan(done, in))
+		chans = append(chans, s.scan(ctx, dialCtx, done, tick, in))
 	}
 
-	var openPorts []int
+	summary := &Summary{}
+	hosts := make(map[string]bool)
 
-	for s := range s.filterOpen(done, s.merge(done, chans...)) {
-		openPorts = append(openPorts, s.port)
+	for scan := range s.merge(done, chans...) {
+		e := Endpoint{Host: scan.host, Port: scan.port}
+		if !hosts[scan.host] {
+			hosts[scan.host] = true
+			summary.Hosts = append(summary.Hosts, scan.host)
+		}
+		for _, hook := range s.hooks {
+			hook(Result{
+				Endpoint:   e,
+				Open:       scan.open,
+				Latency:    scan.scanDuration,
+				Probe:      scan.probe,
+				Banner:     scan.banner,
+				ExcludedBy: scan.excludedBy,
+				Err:        scan.scanErr,
+			})
+		}
+		switch {
+		case scan.excludedBy != "":
+			summary.Skipped = append(summary.Skipped, Skipped{Endpoint: e, Rule: scan.excludedBy})
+		case scan.open:
+			summary.Open = append(summary.Open, OpenPort{Endpoint: e, Latency: scan.scanDuration, Probe: scan.probe, Banner: scan.banner})
+		}
 	}
+	summary.Latency = LatencyReports(summary.Open)
 
 	// for s := range s.filterErr(done, s.merge(done, chans...)) {
 	// 	fmt.Printf("%#v\n", s)
@@ -64,47 +250,173 @@ func (s *TCPScanner) Scan(ports []int) ([]int, error) {
 
 	// done chan is closed by the deferred call here
 
-	return openPorts, nil
+	// gen has exited by now, so errc holds its error if there was one
+	select {
+	case err := <-errc:
+		summary.Incomplete = true
+		return summary, err
+	default:
+	}
+
+	if err := ctx.Err(); err != nil {
+		summary.Incomplete = true
+		return summary, err
+	}
+
+	return summary, nil
 }
 
 type scanOp struct {
+	host         string
 	port         int
 	open         bool
+	excludedBy   string
+	probe        string
+	banner       string
 	scanErr      string
 	scanDuration time.Duration
 }
 
-func (s *TCPScanner) gen(done <-chan struct{}, ports ...int) <-chan scanOp {
-	out := make(chan scanOp, len(ports))
+// errStopped is returned when the scan is cancelled while a dial waits on the rate limit.
+var errStopped = errors.New("scan stopped")
+
+// dial is the only place the scanner opens connections,
+// so exclusions hold no matter how a port reached the pipeline.
+// Excluded endpoints are rejected before they consume any of the rate limit.
+// The returned duration covers the connect only, not time spent waiting on the rate limit.
+func (s *TCPScanner) dial(ctx, dialCtx context.Context, tick <-chan time.Time, host string, port int) (net.Conn, time.Duration, error) {
+	if rule, ok := s.exclusions.Match(host, port); ok {
+		s.metrics.EndpointSkipped()
+		return nil, 0, &ExcludedError{Endpoint: Endpoint{Host: host, Port: port}, Rule: rule}
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	backoff := s.retryBackoff
+	for attempt := 0; ; attempt++ {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				return nil, 0, errStopped
+			}
+		}
+
+		conn, elapsed, err := s.dialOnce(dialCtx, address)
+		if err == nil || attempt == s.retries || !isTimeout(err) || dialCtx.Err() != nil {
+			s.metrics.DialCompleted(err == nil, elapsed)
+			if err != nil {
+				s.logger.Debug("dial failed", "address", address, "attempts", attempt+1, "error", err)
+			}
+			return conn, elapsed, err
+		}
+
+		s.metrics.DialRetried()
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, 0, errStopped
+		}
+		backoff *= 2
+	}
+}
+
+func (s *TCPScanner) dialOnce(ctx context.Context, address string) (net.Conn, time.Duration, error) {
+	cd, ok := s.dialer.(ContextDialer)
+	if !ok {
+		start := time.Now()
+		conn, err := s.dialer.Dial("tcp", address)
+		return conn, time.Since(start), err
+	}
+
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	conn, err := cd.DialContext(ctx, "tcp", address)
+	return conn, time.Since(start), err
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// ExcludedError reports the rule that prevented an endpoint from being dialed.
+type ExcludedError struct {
+	Endpoint
+	Rule string
+}
+
+func (e *ExcludedError) Error() string {
+	return fmt.Sprintf("%s excluded by rule %q", net.JoinHostPort(e.Host, strconv.Itoa(e.Port)), e.Rule)
+}
+
+func (e *ExcludedError) Unwrap() error {
+	return ErrExcluded
+}
+
+func (s *TCPScanner) gen(ctx context.Context, done <-chan struct{}, errc chan<- error, src TargetSource, ports []int) <-chan scanOp {
+	out := make(chan scanOp, s.workers)
 	go func() {
 		defer close(out)
-		for _, p := range ports {
-			select {
-			case out <- scanOp{port: p}:
-			case <-done:
+		for ctx.Err() == nil {
+			t, err := src.Next()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				errc <- err
 				return
 			}
+
+			targetPorts := ports
+			if len(t.Ports) > 0 {
+				targetPorts = t.Ports
+			}
+			for _, p := range s.strategy.Order(targetPorts) {
+				select {
+				case out <- scanOp{host: t.Host, port: p}:
+				case <-ctx.Done():
+					return
+				case <-done:
+					return
+				}
+			}
 		}
 	}()
 	return out
 }
 
-func (s *TCPScanner) scan(done <-chan struct{}, in <-chan scanOp) <-chan scanOp {
+func (s *TCPScanner) scan(ctx, dialCtx context.Context, done <-chan struct{}, tick <-chan time.Time, in <-chan scanOp) <-chan scanOp {
 	out := make(chan scanOp)
 	go func() {
 		defer close(out)
 		for scan := range in {
+			// once cancelled, drain what gen already queued without dialing it
+			if ctx.Err() != nil {
+				continue
+			}
 			select {
 			default:
-				address := fmt.Sprintf("%s:%d", s.host, scan.port)
-				start := time.Now()
-				conn, err := s.dialer.Dial("tcp", address)
-				scan.scanDuration = time.Since(start)
-				if err != nil {
+				conn, elapsed, err := s.dial(ctx, dialCtx, tick, scan.host, scan.port)
+				scan.scanDuration = elapsed
+				// a dial that was stopped or aborted tells us nothing about the port
+				if err != nil && (errors.Is(err, errStopped) || dialCtx.Err() != nil) {
+					continue
+				}
+				var excluded *ExcludedError
+				if errors.As(err, &excluded) {
+					scan.excludedBy = excluded.Rule
+				} else if err != nil {
 					scan.scanErr = err.Error()
 				} else {
-					conn.Close()
 					scan.open = true
+					if len(s.probes) > 0 {
+						scan.probe, scan.banner = s.probe(conn)
+					}
+					conn.Close()
 				}
 				out <- scan
 			case <-done:
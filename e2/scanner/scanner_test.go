@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
@@ -153,9 +154,16 @@ func (mc *MockConn) SetWriteDeadline(t time.Time) error {
 // MockDialer is a mock implementation of the dialer interface.
 type MockDialer struct {
 	openPorts map[int]bool
+
+	mu        sync.Mutex
+	addresses []string
 }
 
 func (m *MockDialer) Dial(network, address string) (net.Conn, error) {
+	m.mu.Lock()
+	m.addresses = append(m.addresses, address)
+	m.mu.Unlock()
+
 	var port int
 	fmt.Sscanf(address, "127.0.0.1:%d", &port)
 	if m.openPorts[port] {
@@ -163,3 +171,10 @@ func (m *MockDialer) Dial(network, address string) (net.Conn, error) {
 	}
 	return nil, errors.New("connection refused")
 }
+
+// dialed returns every address the scanner attempted to dial.
+func (m *MockDialer) dialed() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.addresses...)
+}
@@ -0,0 +1,160 @@
+package scanner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// Target is a host to scan. Ports, when set, override the ports given to the scan.
+type Target struct {
+	Host  string
+	Ports []int
+}
+
+// TargetSource yields targets one at a time.
+// Next returns io.EOF once there are no more targets.
+type TargetSource interface {
+	Next() (Target, error)
+}
+
+// TargetReader reads targets from a stream, one per line:
+//
+//	10.0.0.1            # a single address
+//	10.0.0.0/24         # every address in a network
+//	example.com:22,80   # a hostname, scanning only ports 22 and 80
+//	[::1]:8000-8100     # IPv6 addresses take brackets when ports are given
+//
+// Blank lines and anything after a '#' are ignored.
+// Networks are expanded lazily, so large lists are never held in memory.
+type TargetReader struct {
+	scanner *bufio.Scanner
+	lineNum int
+
+	// the network being expanded, if any
+	network *net.IPNet
+	next    net.IP
+	ports   []int
+}
+
+// maxIPv6Prefix bounds how large an IPv6 network may be expanded.
+const maxIPv6Prefix = 112
+
+// NewTargetReader returns a TargetReader reading from rdr.
+func NewTargetReader(rdr io.Reader) *TargetReader {
+	return &TargetReader{scanner: bufio.NewScanner(rdr)}
+}
+
+// Next returns the next target, or io.EOF when the stream is exhausted.
+// Errors for malformed lines carry the line number.
+func (r *TargetReader) Next() (Target, error) {
+	for {
+		if r.network != nil {
+			if r.network.Contains(r.next) {
+				t := Target{Host: r.next.String(), Ports: r.ports}
+				r.next = nextIP(r.next)
+				return t, nil
+			}
+			r.network = nil
+		}
+
+		if !r.scanner.Scan() {
+			if err := r.scanner.Err(); err != nil {
+				return Target{}, err
+			}
+			return Target{}, io.EOF
+		}
+		r.lineNum++
+
+		line := r.scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		t, network, err := parseTarget(line)
+		if err != nil {
+			return Target{}, fmt.Errorf("line %d: %w", r.lineNum, err)
+		}
+		if network == nil {
+			return t, nil
+		}
+		r.network, r.next, r.ports = network, network.IP, t.Ports
+	}
+}
+
+// parseTarget parses a single target line. When the host is a network
+// it is returned separately so the caller can expand it.
+func parseTarget(line string) (Target, *net.IPNet, error) {
+	var t Target
+	host := line
+	if h, p, err := splitHostPortRule(line); err == nil {
+		ports, err := ParsePorts(p)
+		if err != nil {
+			return t, nil, fmt.Errorf("invalid target %q: %w", line, err)
+		}
+		host, t.Ports = h, ports
+	}
+
+	if host == "" {
+		return t, nil, fmt.Errorf("invalid target %q", line)
+	}
+
+	if strings.Contains(host, "/") {
+		ip, network, err := net.ParseCIDR(host)
+		if err != nil {
+			return t, nil, fmt.Errorf("invalid target %q: %w", line, err)
+		}
+		if ones, bits := network.Mask.Size(); ip.To4() == nil && bits-ones > 128-maxIPv6Prefix {
+			return t, nil, fmt.Errorf("invalid target %q: IPv6 networks larger than /%d are not expanded", line, maxIPv6Prefix)
+		}
+		if ip4 := network.IP.To4(); ip4 != nil {
+			network.IP = ip4
+		}
+		return t, network, nil
+	}
+
+	t.Host = host
+	return t, nil, nil
+}
+
+// nextIP returns the address following ip, or nil past the last address.
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next
+		}
+	}
+	return nil
+}
+
+// targetList is a TargetSource over targets already in memory.
+type targetList struct {
+	targets []Target
+}
+
+// Targets returns a TargetSource yielding the given targets in order.
+func Targets(targets ...Target) TargetSource {
+	return &targetList{targets: targets}
+}
+
+func (l *targetList) Next() (Target, error) {
+	if len(l.targets) == 0 {
+		return Target{}, io.EOF
+	}
+	t := l.targets[0]
+	l.targets = l.targets[1:]
+	return t, nil
+}
+
+// errNoTargets is returned when a scan is started without a target source.
+var errNoTargets = errors.New("targets are required")
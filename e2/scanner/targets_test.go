@@ -0,0 +1,122 @@
+package scanner_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/idiomat/dodtnyt/e2/scanner"
+)
+
+func TestTargetReader(t *testing.T) {
+	tests := map[string]struct {
+		input   string
+		want    []scanner.Target
+		wantErr string
+	}{
+		"mixed targets": {
+			input: "# office\n10.0.0.1\n\nexample.com:22,80 # ssh and http\n[::1]:8000-8001\n::2\n",
+			want: []scanner.Target{
+				{Host: "10.0.0.1"},
+				{Host: "example.com", Ports: []int{22, 80}},
+				{Host: "::1", Ports: []int{8000, 8001}},
+				{Host: "::2"},
+			},
+		},
+		"cidr expansion": {
+			input: "192.168.1.1/30:443\n",
+			want: []scanner.Target{
+				{Host: "192.168.1.0", Ports: []int{443}},
+				{Host: "192.168.1.1", Ports: []int{443}},
+				{Host: "192.168.1.2", Ports: []int{443}},
+				{Host: "192.168.1.3", Ports: []int{443}},
+			},
+		},
+		"last network": {
+			input: "255.255.255.254/31\n",
+			want: []scanner.Target{
+				{Host: "255.255.255.254"},
+				{Host: "255.255.255.255"},
+			},
+		},
+		"bad port": {
+			input:   "10.0.0.1\nexample.com:ssh\n",
+			want:    []scanner.Target{{Host: "10.0.0.1"}},
+			wantErr: "line 2",
+		},
+		"bad cidr": {
+			input:   "10.0.0.0/40\n",
+			wantErr: "line 1",
+		},
+		"ipv6 network too large": {
+			input:   "2001:db8::/64\n",
+			wantErr: "line 1",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rdr := scanner.NewTargetReader(strings.NewReader(tt.input))
+
+			var got []scanner.Target
+			var err error
+			for {
+				var target scanner.Target
+				target, err = rdr.Next()
+				if err != nil {
+					break
+				}
+				got = append(got, target)
+			}
+
+			if tt.wantErr == "" && !errors.Is(err, io.EOF) {
+				t.Fatalf("Next() error = %v, want io.EOF", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Next() error = %v, want error containing %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("targets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTCPScanner_RunTargets(t *testing.T) {
+	mockDialer := &MockDialer{openPorts: map[int]bool{22: true, 80: true, 443: true}}
+	tcpScanner, err := scanner.NewTCPScanner("127.0.0.1", 2, mockDialer)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	src := scanner.NewTargetReader(strings.NewReader("127.0.0.1\n127.0.0.1:443\n127.0.0.2\n"))
+	openPorts := make(map[int]int)
+	summary, err := tcpScanner.RunTargets(context.Background(), src, []int{22, 80})
+	if err != nil {
+		t.Fatalf("TCPScanner.RunTargets() error = %v", err)
+	}
+	for _, o := range summary.Open {
+		openPorts[o.Port]++
+	}
+	if want := map[int]int{22: 1, 80: 1, 443: 1}; !reflect.DeepEqual(openPorts, want) {
+		t.Errorf("open ports = %v, want %v", openPorts, want)
+	}
+	// 127.0.0.2 has no open ports, but was scanned
+	sort.Strings(summary.Hosts)
+	if want := []string{"127.0.0.1", "127.0.0.2"}; !reflect.DeepEqual(summary.Hosts, want) {
+		t.Errorf("hosts = %v, want %v", summary.Hosts, want)
+	}
+
+	src = scanner.NewTargetReader(strings.NewReader("127.0.0.1:80\n127.0.0.1:http\n"))
+	summary, err = tcpScanner.RunTargets(context.Background(), src, []int{22})
+	if err == nil {
+		t.Fatalf("TCPScanner.RunTargets() expected error for malformed target")
+	}
+	if summary == nil || len(summary.Open) != 1 {
+		t.Errorf("summary = %v, want the target scanned before the error", summary)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/idiomat/dodtnyt/e2/scanner"
+)
+
+// targetSource picks where targets come from: the -iL file, stdin when it or
+// the only argument is "-", or else the hosts from the -host flag or profile.
+// The returned func closes any file that was opened.
+func targetSource(inputList string, args []string, hosts []string) (scanner.TargetSource, func(), error) {
+	if inputList == "" && len(args) == 1 && args[0] == "-" {
+		inputList = "-"
+	}
+
+	switch inputList {
+	case "":
+		return scanner.NewTargetReader(strings.NewReader(strings.Join(hosts, "\n"))), func() {}, nil
+	case "-":
+		return scanner.NewTargetReader(os.Stdin), func() {}, nil
+	}
+
+	f, err := os.Open(inputList)
+	if err != nil {
+		return nil, nil, err
+	}
+	return scanner.NewTargetReader(f), func() { f.Close() }, nil
+}